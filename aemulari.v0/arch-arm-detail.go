@@ -0,0 +1,446 @@
+package aemulari
+
+import (
+	"encoding/binary"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cs "github.com/lunixbochs/capstr"
+)
+
+// Arm condition codes, indexed by their encoding. AL (always) is represented
+// by an empty string.
+var armConditions = []string{
+	"eq", "ne", "hs", "lo", "mi", "pl", "vs", "vc",
+	"hi", "ls", "ge", "lt", "gt", "le", "",
+}
+
+// Floating point and SIMD registers, which aren't included in the register map
+var armExtRegister = regexp.MustCompile(`^[sdq][0-9]+$`)
+
+// Instructions that write their first operand, but also read it
+var armReadsDest = map[string]bool{"movt": true, "bfi": true, "bfc": true}
+
+// Thumb instructions whose mnemonics end in a condition code, which isn't one
+// imposed by an IT block
+var armCondSuffixed = map[string]bool{
+	"teq": true, "mls": true, "cls": true, "svc": true, "lsls": true,
+	"vmls": true, "vnmls": true,
+	"vcge": true, "vcgt": true, "vcle": true, "vclt": true, "vcls": true,
+	"vacge": true, "vacgt": true, "vacle": true, "vaclt": true,
+}
+
+// Instructions that don't write their register operands
+var armNoDest = map[string]bool{
+	"cmp": true, "cmn": true, "tst": true, "teq": true,
+	"nop": true, "svc": true, "bkpt": true, "udf": true,
+	"wfi": true, "wfe": true, "sev": true, "yield": true,
+	"dmb": true, "dsb": true, "isb": true,
+}
+
+// Returns the condition encoded in an instruction, excluding those imposed by
+// a Thumb IT block, which are given by pendingCondition().
+func (a *archArm) encodedCondition(instr []byte, mode processorMode) string {
+	if mode.cs != cs.MODE_THUMB {
+		if len(instr) != 4 {
+			return ""
+		}
+
+		// 0b1111 denotes unconditional instructions
+		if c := binary.LittleEndian.Uint32(instr) >> 28; c < 14 {
+			return armConditions[c]
+		}
+		return ""
+	}
+
+	switch len(instr) {
+	case 2:
+		hw := binary.LittleEndian.Uint16(instr)
+		if hw&0xf000 == 0xd000 && hw>>8&0xf < 14 { // B<c>
+			return armConditions[hw>>8&0xf]
+		}
+	case 4:
+		hw1 := binary.LittleEndian.Uint16(instr)
+		hw2 := binary.LittleEndian.Uint16(instr[2:])
+		if hw1&0xf800 == 0xf000 && hw2&0xd000 == 0x8000 && hw1>>6&0xf < 14 { // B<c>.W
+			return armConditions[hw1>>6&0xf]
+		}
+	}
+
+	return ""
+}
+
+// Returns the condition the current Thumb IT block imposes on the next
+// instruction, or "" if there is none.
+func (a *archArm) pendingCondition(regs []Register) string {
+	for _, r := range regs {
+		if r.attr.name == "cpsr" {
+			// ITSTATE[7:2] is held in bits 15:10, and ITSTATE[1:0] in bits 26:25
+			it := (r.Value>>8)&0xfc | (r.Value>>25)&0x3
+			if it&0xf == 0 || it>>4 >= 14 {
+				return ""
+			}
+			return armConditions[it>>4]
+		}
+	}
+
+	return ""
+}
+
+// Returns true if the condition `cond` (e.g., "eq") passes, given the
+// condition flags in `regs`.
+func (a *archArm) conditionPasses(cond string, regs []Register) bool {
+	var cpsr uint64
+	for _, r := range regs {
+		if r.attr.name == "cpsr" {
+			cpsr = r.Value
+		}
+	}
+
+	n, z := cpsr&(1<<31) != 0, cpsr&(1<<30) != 0
+	c, v := cpsr&(1<<29) != 0, cpsr&(1<<28) != 0
+
+	switch cond {
+	case "eq":
+		return z
+	case "ne":
+		return !z
+	case "hs", "cs":
+		return c
+	case "lo", "cc":
+		return !c
+	case "mi":
+		return n
+	case "pl":
+		return !n
+	case "vs":
+		return v
+	case "vc":
+		return !v
+	case "hi":
+		return c && !z
+	case "ls":
+		return !c || z
+	case "ge":
+		return n == v
+	case "lt":
+		return n != v
+	case "gt":
+		return !z && n == v
+	case "le":
+		return z || n != v
+	default:
+		return true
+	}
+}
+
+// Split operands at commas that aren't within brackets or braces
+func splitOperands(s string) []string {
+	var ret []string
+	depth, start := 0, 0
+
+	for i, c := range s {
+		switch c {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				ret = append(ret, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		ret = append(ret, rest)
+	}
+	return ret
+}
+
+// Returns the canonical name of a register operand, and false if `s` isn't one.
+// Status register fields (e.g., "cpsr_fc" and "apsr_nzcv") refer to CPSR.
+func (a *archArm) operandRegister(s string) (string, bool) {
+	s = strings.TrimSuffix(strings.ToLower(s), "!")
+
+	if i := strings.Index(s, "_"); i > 0 && strings.HasSuffix(s[:i], "psr") {
+		return "cpsr", true
+	} else if s == "apsr" {
+		return "cpsr", true
+	} else if attr, err := a.register(s); err == nil {
+		return attr.name, true
+	} else if armExtRegister.MatchString(s) {
+		return s, true
+	}
+
+	return "", false
+}
+
+// Parse an immediate operand (e.g., "#0x10" or "#-4")
+func parseImmediate(s string) (int64, bool) {
+	if !strings.HasPrefix(s, "#") {
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(s[1:], 0, 64)
+	if err != nil {
+		// Large unsigned values (e.g., branch targets)
+		u, err := strconv.ParseUint(s[1:], 0, 64)
+		return int64(u), err == nil
+	}
+	return value, true
+}
+
+// Parse a memory operand (e.g., "[r1, -r2, lsl #2]!")
+func (a *archArm) parseMemOperand(s string) MemOperand {
+	var m MemOperand
+
+	end := strings.Index(s, "]")
+	m.Writeback = strings.HasSuffix(s, "!")
+
+	parts := splitOperands(s[1:end])
+	if len(parts) > 0 {
+		m.Base, _ = a.operandRegister(parts[0])
+	}
+
+	for _, part := range parts[1:] {
+		if disp, ok := parseImmediate(part); ok {
+			m.Disp = disp
+		} else if fields := strings.Fields(part); len(fields) == 2 {
+			shift, _ := parseImmediate(fields[1])
+			m.Shift = uint(shift)
+		} else if reg, ok := a.operandRegister(strings.TrimPrefix(part, "-")); ok {
+			m.Index = reg
+			m.Subtract = strings.HasPrefix(part, "-")
+		}
+	}
+
+	return m
+}
+
+// Returns the number of bytes transferred by a load or store, given the
+// remainder of its mnemonic following "ldr" or "str"
+func armAccessSize(suffix string) uint64 {
+	suffix = strings.TrimPrefix(suffix, "ex")
+	suffix = strings.TrimPrefix(suffix, "s")
+
+	switch {
+	case strings.HasPrefix(suffix, "b"):
+		return 1
+	case strings.HasPrefix(suffix, "h"):
+		return 2
+	case strings.HasPrefix(suffix, "d"):
+		return 8
+	default:
+		return 4
+	}
+}
+
+// Add `reg` to `regs`, if not already present
+func addRegister(regs []string, reg string) []string {
+	for _, r := range regs {
+		if r == reg {
+			return regs
+		}
+	}
+	return append(regs, reg)
+}
+
+// Operand register usage and memory operands are determined from the
+// disassembly, while conditions and branch targets are decoded from the
+// instruction itself.
+func (a *archArm) instrDetail(instr Disassembly, bytes []byte, mode processorMode) InstrDetail {
+	var detail InstrDetail
+
+	detail.Condition = a.encodedCondition(bytes, mode)
+	detail.Target, _, detail.HasTarget = a.branchTarget(instr.AddressU64, bytes, mode)
+
+	// Reduce the mnemonic to its base form (e.g., "ldrbhi.w" -> "ldrb")
+	mnemonic := strings.ToLower(instr.Mnemonic)
+	if i := strings.Index(mnemonic, "."); i > 0 {
+		mnemonic = mnemonic[:i]
+	}
+	if detail.Condition != "" && len(mnemonic) > len(detail.Condition) {
+		mnemonic = strings.TrimSuffix(mnemonic, detail.Condition)
+	} else if mode.cs == cs.MODE_THUMB && !armCondSuffixed[mnemonic] {
+		// The condition imposed by an IT block (e.g., "bxeq")
+		for _, cond := range armConditions {
+			if cond != "" && len(mnemonic) > len(cond) && strings.HasSuffix(mnemonic, cond) {
+				mnemonic = strings.TrimSuffix(mnemonic, cond)
+				break
+			}
+		}
+	}
+
+	// The PC reads as the address of the current instruction plus 8 in Arm
+	// state, or plus 4 in Thumb state (word-aligned when used as a base).
+	pc := instr.AddressU64 + 8
+	if mode.cs == cs.MODE_THUMB {
+		pc = (instr.AddressU64 + 4) &^ 3
+	}
+
+	load := strings.HasPrefix(mnemonic, "ldr") || strings.HasPrefix(mnemonic, "lda")
+	store := strings.HasPrefix(mnemonic, "str") || strings.HasPrefix(mnemonic, "stl")
+	multiple := strings.HasPrefix(mnemonic, "ldm") || strings.HasPrefix(mnemonic, "stm") ||
+		mnemonic == "push" || mnemonic == "pop"
+
+	read := func(reg string) { detail.RegsRead = addRegister(detail.RegsRead, reg) }
+	write := func(reg string) { detail.RegsWritten = addRegister(detail.RegsWritten, reg) }
+
+	operands := splitOperands(instr.Operands)
+
+	switch {
+	case mnemonic == "b" || mnemonic == "bl" || mnemonic == "blx" || mnemonic == "bx" ||
+		mnemonic == "cbz" || mnemonic == "cbnz":
+		detail.Branch = true
+		for _, op := range operands {
+			if target, ok := parseImmediate(op); ok && !detail.HasTarget {
+				detail.Target, detail.HasTarget = uint64(target), true
+			} else if reg, ok := a.operandRegister(op); ok {
+				read(reg)
+				if !strings.HasPrefix(mnemonic, "cb") {
+					detail.TargetReg = reg
+				}
+			}
+		}
+		if strings.HasPrefix(mnemonic, "bl") {
+			write("lr")
+		}
+		write("pc")
+
+	case multiple:
+		var list []string
+		base := "sp"
+
+		for _, op := range operands {
+			if strings.HasPrefix(op, "{") {
+				for _, r := range splitOperands(strings.Trim(op, "{}")) {
+					if reg, ok := a.operandRegister(r); ok {
+						list = append(list, reg)
+					}
+				}
+			} else if reg, ok := a.operandRegister(op); ok {
+				base = reg
+			}
+		}
+
+		m := MemOperand{Base: base, Size: uint64(4 * len(list)), pc: pc}
+		m.Writeback = mnemonic == "push" || mnemonic == "pop" ||
+			(len(operands) > 0 && strings.HasSuffix(operands[0], "!"))
+
+		switch {
+		case mnemonic == "push" || strings.HasSuffix(mnemonic, "db"):
+			m.Disp = -int64(m.Size)
+		case strings.HasSuffix(mnemonic, "da"):
+			m.Disp = 4 - int64(m.Size)
+		case strings.HasSuffix(mnemonic, "ib"):
+			m.Disp = 4
+		}
+
+		read(base)
+		if m.Writeback {
+			write(base)
+		}
+
+		m.Write = mnemonic == "push" || strings.HasPrefix(mnemonic, "stm")
+		for _, reg := range list {
+			if m.Write {
+				read(reg)
+			} else {
+				write(reg)
+			}
+		}
+		detail.Mem = append(detail.Mem, m)
+
+	case load || store || mnemonic == "tbb" || mnemonic == "tbh":
+		for i, op := range operands {
+			if strings.HasPrefix(op, "[") {
+				m := a.parseMemOperand(op)
+				m.pc = pc
+				m.Write = store
+
+				switch {
+				case mnemonic == "tbb":
+					m.Size = 1
+				case mnemonic == "tbh":
+					m.Size = 2
+				default:
+					m.Size = armAccessSize(mnemonic[3:])
+				}
+
+				// Post-indexed offset (e.g., "[r1], #4")
+				if i+1 < len(operands) {
+					m.PostIndex, m.Writeback = true, true
+					if disp, ok := parseImmediate(operands[i+1]); ok {
+						m.Disp = disp
+					} else if reg, ok := a.operandRegister(strings.TrimPrefix(operands[i+1], "-")); ok {
+						m.Index = reg
+						m.Subtract = strings.HasPrefix(operands[i+1], "-")
+					}
+				}
+
+				read(m.Base)
+				if m.Index != "" {
+					read(m.Index)
+				}
+				if m.Writeback {
+					write(m.Base)
+				}
+
+				detail.Mem = append(detail.Mem, m)
+				break
+			}
+
+			reg, ok := a.operandRegister(op)
+			if !ok {
+				continue
+			}
+
+			// The first operand of a store-exclusive receives its status
+			if load || (i == 0 && strings.Contains(mnemonic, "ex")) {
+				write(reg)
+			} else {
+				read(reg)
+			}
+		}
+
+		if mnemonic == "tbb" || mnemonic == "tbh" {
+			detail.Branch = true
+			write("pc")
+		}
+
+	default:
+		longMul := strings.HasPrefix(mnemonic, "umull") || strings.HasPrefix(mnemonic, "smull") ||
+			strings.HasPrefix(mnemonic, "umlal") || strings.HasPrefix(mnemonic, "smlal")
+
+		for i, op := range operands {
+			fields := strings.Fields(op)
+			if len(fields) == 2 { // Shifted register (e.g., "lsl r3")
+				op = fields[1]
+			}
+
+			reg, ok := a.operandRegister(op)
+			if !ok {
+				continue
+			}
+
+			dest := !armNoDest[mnemonic] && (i == 0 || (i == 1 && longMul))
+			if !dest || armReadsDest[mnemonic] || strings.Contains(mnemonic, "mlal") {
+				read(reg)
+			}
+			if dest {
+				write(reg)
+			}
+		}
+	}
+
+	for _, reg := range detail.RegsWritten {
+		if reg == "pc" {
+			detail.Branch = true
+		}
+	}
+
+	return detail
+}
@@ -0,0 +1,143 @@
+package aemulari
+
+import (
+	"reflect"
+	"testing"
+
+	ks "github.com/keystone-engine/keystone/bindings/go/keystone"
+	cs "github.com/lunixbochs/capstr"
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+func newTestArm(t *testing.T) *archArm {
+	t.Helper()
+
+	a, err := NewArchitecture("arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*archArm)
+}
+
+func TestArmInstrDetail(t *testing.T) {
+	armMode := processorMode{uc.MODE_ARM, cs.MODE_ARM, int(ks.MODE_ARM)}
+	thumbMode := processorMode{uc.MODE_THUMB, cs.MODE_THUMB, int(ks.MODE_THUMB)}
+
+	tests := []struct {
+		mode     processorMode
+		addr     uint64
+		instr    []byte
+		mnemonic string
+		operands string
+		expected InstrDetail
+	}{
+		{armMode, 0x10000, []byte{0x04, 0x00, 0x91, 0xe5}, "ldr", "r0, [r1, #4]", InstrDetail{
+			RegsRead:    []string{"r1"},
+			RegsWritten: []string{"r0"},
+			Mem:         []MemOperand{{Base: "r1", Disp: 4, Size: 4}},
+		}},
+		{armMode, 0x10000, []byte{0x08, 0x20, 0x2d, 0xe5}, "str", "r2, [sp, #-8]!", InstrDetail{
+			RegsRead:    []string{"r2", "sp"},
+			RegsWritten: []string{"sp"},
+			Mem:         []MemOperand{{Base: "sp", Disp: -8, Size: 4, Write: true, Writeback: true}},
+		}},
+		{armMode, 0x10000, []byte{0x10, 0x40, 0x2d, 0xe9}, "push", "{r4, lr}", InstrDetail{
+			RegsRead:    []string{"sp", "r4", "lr"},
+			RegsWritten: []string{"sp"},
+			Mem:         []MemOperand{{Base: "sp", Disp: -8, Size: 8, Write: true, Writeback: true}},
+		}},
+		{armMode, 0x10000, []byte{0x3e, 0x00, 0x00, 0xeb}, "bl", "#0x10100", InstrDetail{
+			RegsWritten: []string{"lr", "pc"},
+			Branch:      true,
+			Target:      0x10100,
+			HasTarget:   true,
+		}},
+		{armMode, 0x10000, []byte{0x02, 0x00, 0x81, 0x00}, "addeq", "r0, r1, r2", InstrDetail{
+			RegsRead:    []string{"r1", "r2"},
+			RegsWritten: []string{"r0"},
+			Condition:   "eq",
+		}},
+		{armMode, 0x10000, []byte{0x01, 0x00, 0x50, 0xe3}, "cmp", "r0, #1", InstrDetail{
+			RegsRead: []string{"r0"},
+		}},
+		{thumbMode, 0x10000, []byte{0x02, 0xd0}, "beq", "#0x10008", InstrDetail{
+			RegsWritten: []string{"pc"},
+			Condition:   "eq",
+			Branch:      true,
+			Target:      0x10008,
+			HasTarget:   true,
+		}},
+		{thumbMode, 0x10000, []byte{0x00, 0xf0, 0x7e, 0xf8}, "bl", "#0x10100", InstrDetail{
+			RegsWritten: []string{"lr", "pc"},
+			Branch:      true,
+			Target:      0x10100,
+			HasTarget:   true,
+		}},
+
+		// Within an IT block, the condition is appended to the mnemonic
+		{thumbMode, 0x10002, []byte{0x70, 0x47}, "bxeq", "lr", InstrDetail{
+			RegsRead:    []string{"lr"},
+			RegsWritten: []string{"pc"},
+			Branch:      true,
+			TargetReg:   "lr",
+		}},
+		{thumbMode, 0x10002, []byte{0x00, 0xbd}, "popeq", "{pc}", InstrDetail{
+			RegsRead:    []string{"sp"},
+			RegsWritten: []string{"sp", "pc"},
+			Mem:         []MemOperand{{Base: "sp", Size: 4, Writeback: true}},
+			Branch:      true,
+		}},
+		{thumbMode, 0x10002, []byte{0x01, 0x28}, "cmpeq", "r0, #1", InstrDetail{
+			RegsRead: []string{"r0"},
+		}},
+
+		// Mnemonics that end in a condition code regardless
+		{thumbMode, 0x10000, []byte{0x90, 0xea, 0x01, 0x0f}, "teq.w", "r0, r1", InstrDetail{
+			RegsRead: []string{"r0", "r1"},
+		}},
+		{thumbMode, 0x10000, []byte{0x88, 0x00}, "lsls", "r0, r1, #2", InstrDetail{
+			RegsRead:    []string{"r1"},
+			RegsWritten: []string{"r0"},
+		}},
+	}
+
+	arm := newTestArm(t)
+
+	for _, test := range tests {
+		instr := Disassembly{AddressU64: test.addr, Mnemonic: test.mnemonic, Operands: test.operands}
+		detail := arm.instrDetail(instr, test.instr, test.mode)
+
+		// The PC value used by memory operands isn't of interest here
+		for i := range detail.Mem {
+			detail.Mem[i].pc = 0
+		}
+
+		if !reflect.DeepEqual(detail, test.expected) {
+			t.Errorf("%s %s:\n got %+v\nwant %+v", test.mnemonic, test.operands, detail, test.expected)
+		}
+	}
+}
+
+func TestArmPendingCondition(t *testing.T) {
+	tests := []struct {
+		cpsr     uint64
+		expected string
+	}{
+		{0x00000030, ""},   // Thumb state, outside of an IT block
+		{0x00000830, "eq"}, // ITSTATE = 0b00001000 (IT EQ)
+		{0x00001830, "ne"}, // ITSTATE = 0b00011000 (IT NE)
+	}
+
+	arm := newTestArm(t)
+
+	for _, test := range tests {
+		regs := []Register{{attr: &arm_cpsr, Value: test.cpsr}}
+		if cond := arm.pendingCondition(regs); cond != test.expected {
+			t.Errorf("CPSR 0x%08x: got \"%s\", expected \"%s\"", test.cpsr, cond, test.expected)
+		}
+	}
+
+	if cond := arm.pendingCondition(nil); cond != "" {
+		t.Errorf("Without CPSR: got \"%s\", expected \"\"", cond)
+	}
+}
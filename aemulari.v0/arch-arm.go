@@ -1,7 +1,9 @@
 package aemulari
 
 import (
+	"encoding/binary"
 	"fmt"
+	ks "github.com/keystone-engine/keystone/bindings/go/keystone"
 	cs "github.com/lunixbochs/capstr"
 	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
 )
@@ -50,6 +52,43 @@ var excpStr map[uint32]string = map[uint32]string{
 	arm_excp_vfiq:           "Virtual FIQ",
 }
 
+// Unicorn/QEMU ARM interrupt number to the short name reported by Exception.Kind()
+var excpKind map[uint32]string = map[uint32]string{
+	arm_excp_udef:           "udef",
+	arm_excp_swi:            "swi",
+	arm_excp_prefetch_abort: "prefetch-abort",
+	arm_excp_data_abort:     "data-abort",
+	arm_excp_irq:            "irq",
+	arm_excp_fiq:            "fiq",
+	arm_excp_bkpt:           "bkpt",
+	arm_excp_exit:           "exit",
+	arm_excp_kernel_trap:    "kernel-trap",
+	arm_excp_strex:          "strex",
+	arm_excp_hyp_call:       "hvc",
+	arm_excp_hyp_trap:       "hyp-trap",
+	arm_excp_smc:            "smc",
+	arm_excp_virq:           "virq",
+	arm_excp_vfiq:           "vfiq",
+}
+
+// POSIX signal numbers used to describe exceptions to external tools
+const (
+	sigint  = 2
+	sigill  = 4
+	sigtrap = 5
+	sigsegv = 11
+)
+
+// Unicorn/QEMU ARM interrupt number to the POSIX signal most closely
+// describing it. Exceptions not listed here are reported as SIGTRAP.
+var excpSignal map[uint32]int = map[uint32]int{
+	arm_excp_udef:           sigill,
+	arm_excp_prefetch_abort: sigsegv,
+	arm_excp_data_abort:     sigsegv,
+	arm_excp_irq:            sigint,
+	arm_excp_fiq:            sigint,
+}
+
 // Per: http://infocenter.arm.com/help/index.jsp?topic=/com.arm.doc.dui0473m/dom1359731136117.html
 
 var arm_r0 registerAttr = registerAttr{
@@ -279,20 +318,26 @@ var arm_cpsr registerAttr = registerAttr{
 
 func armConstructor(mode string) (Architecture, error) {
 	var modeInfo processorMode
+	var modeName string
 
 	switch mode {
 	case "arm", "":
-		modeInfo = processorMode{uc.MODE_ARM, cs.MODE_ARM}
+		modeInfo = processorMode{uc.MODE_ARM, cs.MODE_ARM, int(ks.MODE_ARM)}
+		modeName = "arm"
 	case "thumb", "thumb2":
-		modeInfo = processorMode{uc.MODE_THUMB, cs.MODE_THUMB}
+		modeInfo = processorMode{uc.MODE_THUMB, cs.MODE_THUMB, int(ks.MODE_THUMB)}
+		modeName = "thumb"
 	default:
 		return nil, fmt.Errorf("Invalid Arm mode specified (\"%s\")", mode)
 	}
 
 	arm := &archArm{
 		archBase{
-			processor:   processorType{uc.ARCH_ARM, cs.ARCH_ARM},
+			name:        "arm",
+			modeName:    modeName,
+			processor:   processorType{uc.ARCH_ARM, cs.ARCH_ARM, int(ks.ARCH_ARM)},
 			mode:        modeInfo,
+			minInstrLen: 2,
 			maxInstrLen: 4,
 		},
 	}
@@ -392,11 +437,136 @@ func (a *archArm) currentMode(regs []Register) processorMode {
 	t_bit := a.getTBit(regs)
 
 	if t_bit {
-		return processorMode{uc.MODE_THUMB, cs.MODE_THUMB}
+		return processorMode{uc.MODE_THUMB, cs.MODE_THUMB, int(ks.MODE_THUMB)}
 	}
 
-	return processorMode{uc.MODE_ARM, cs.MODE_ARM}
+	return processorMode{uc.MODE_ARM, cs.MODE_ARM, int(ks.MODE_ARM)}
+
+}
+
+func (a *archArm) statusRegister() string {
+	return "cpsr"
+}
 
+// Per the AAPCS, the first four word-sized arguments are passed in r0-r3 and
+// the remainder on the stack, which must be 8-byte aligned at a call.
+//
+// Frame records follow GCC's Arm-state layout, in which fp points to the
+// saved lr, immediately preceded by the caller's fp.
+func (a *archArm) callingConvention() callingConvention {
+	return callingConvention{
+		args:       []string{"r0", "r1", "r2", "r3"},
+		ret:        []string{"r0", "r1"},
+		sp:         "sp",
+		wordSize:   4,
+		stackAlign: 8,
+
+		lr:       "lr",
+		fp:       "fp",
+		fpRet:    0,
+		fpPrev:   -4,
+		codeMask: ^uint64(1),
+	}
+}
+
+// Recognizes BL and BLX in Arm state, and BL, BLX <imm>, and BLX <reg> in
+// Thumb state. Instructions are assumed to be stored little-endian, which is
+// also the case for BE-8 big-endian code.
+func (a *archArm) isCall(instr []byte, regs func() []Register) bool {
+	switch len(instr) {
+	case 2:
+		hw := binary.LittleEndian.Uint16(instr)
+		return hw&0xff87 == 0x4780 // BLX <reg>
+
+	case 4:
+		w := binary.LittleEndian.Uint32(instr)
+		hw1, hw2 := uint16(w), uint16(w>>16)
+
+		armCall := (w&0x0f000000 == 0x0b000000 && w>>28 != 0xf) || // BL
+			w&0xfe000000 == 0xfa000000 || // BLX <imm>
+			(w&0x0ffffff0 == 0x012fff30 && w>>28 != 0xf) // BLX <reg>
+
+		thumbCall := hw1&0xf800 == 0xf000 && hw2&0xc000 == 0xc000 // BL, BLX <imm>
+
+		// Only consult the T bit if just one interpretation is a call
+		if armCall != thumbCall {
+			return a.getTBit(regs()) == thumbCall
+		}
+		return armCall
+	}
+
+	return false
+}
+
+// Recognizes BL and BLX <imm> in both states. BLX <imm> switches state, so its
+// target is decoded in the other one. As with isCall(), instructions are
+// assumed to be stored little-endian.
+func (a *archArm) branchTarget(addr uint64, instr []byte, mode processorMode) (uint64, processorMode, bool) {
+	armMode := processorMode{uc.MODE_ARM, cs.MODE_ARM, int(ks.MODE_ARM)}
+	thumbMode := processorMode{uc.MODE_THUMB, cs.MODE_THUMB, int(ks.MODE_THUMB)}
+
+	if len(instr) != 4 {
+		return 0, mode, false
+	}
+	w := binary.LittleEndian.Uint32(instr)
+
+	if mode.cs != cs.MODE_THUMB {
+		offset := uint64(int64(int32(w<<8) >> 6)) // imm24, sign-extended and scaled
+
+		if w&0x0f000000 == 0x0b000000 && w>>28 != 0xf { // BL
+			return addr + 8 + offset, armMode, true
+		} else if w&0xfe000000 == 0xfa000000 { // BLX <imm>, with H as bit 1
+			return addr + 8 + offset + uint64(w>>23&2), thumbMode, true
+		}
+		return 0, mode, false
+	}
+
+	hw1, hw2 := w&0xffff, w>>16
+	if hw1&0xf800 != 0xf000 || hw2&0xc000 != 0xc000 {
+		return 0, mode, false
+	}
+
+	// imm32 = SignExtend(S:I1:I2:imm10:imm11:'0'), where Ix = NOT(Jx XOR S)
+	s := hw1 >> 10 & 1
+	i1 := ^(hw2>>13 ^ s) & 1
+	i2 := ^(hw2>>11 ^ s) & 1
+	imm := s<<24 | i1<<23 | i2<<22 | (hw1&0x3ff)<<12 | (hw2&0x7ff)<<1
+	offset := uint64(int64(int32(imm<<7) >> 7))
+
+	if hw2&0x1000 != 0 { // BL
+		return addr + 4 + offset, thumbMode, true
+	} else if hw2&1 == 0 { // BLX <imm>, relative to the word-aligned PC
+		return (addr+4)&^3 + offset, armMode, true
+	}
+	return 0, mode, false
+}
+
+// Bit 0 of the function address selects Thumb state, as it would for a BLX.
+// The return address carries the same state so that the function returns
+// to code executing in the state it was called in.
+func (a *archArm) callRegisters(addr, retAddr uint64, regs []Register) []Register {
+	var ret []Register
+	thumb := addr&1 != 0
+
+	for _, r := range regs {
+		switch r.attr.name {
+		case "cpsr":
+			if thumb {
+				r.setFlagValueByName("T", 1)
+			} else {
+				r.setFlagValueByName("T", 0)
+			}
+			ret = append([]Register{r}, ret...)
+		case "lr":
+			r.Value = retAddr | (addr & 1)
+			ret = append(ret, r)
+		case "pc":
+			r.Value = addr &^ 1
+			ret = append(ret, r)
+		}
+	}
+
+	return ret
 }
 
 func (a *archArm) exception(intno uint32, regs []Register, instr []byte) Exception {
@@ -423,6 +593,18 @@ func (a *archArm) exception(intno uint32, regs []Register, instr []byte) Excepti
 
 	e.intno = intno
 
+	if kind, found := excpKind[intno]; found {
+		e.kind = kind
+	} else {
+		e.kind = "unknown"
+	}
+
+	if sig, found := excpSignal[intno]; found {
+		e.signal = sig
+	} else {
+		e.signal = sigtrap
+	}
+
 	switch intno {
 	case arm_excp_bkpt:
 		var bkpt uint
@@ -1,10 +1,29 @@
 package aemulari
 
+import (
+	ks "github.com/keystone-engine/keystone/bindings/go/keystone"
+	cs "github.com/lunixbochs/capstr"
+)
+
 type archBase struct {
+	name        string
+	modeName    string
 	processor   processorType
 	mode        processorMode
+	minInstrLen uint
 	maxInstrLen uint
 	registerMap
+
+	engines    map[int]*cs.Engine   // Capstone mode ID -> disassembly engine
+	assemblers map[int]*ks.Keystone // Keystone mode ID -> assembler
+}
+
+func (b *archBase) Name() string {
+	return b.name
+}
+
+func (b *archBase) Spec() string {
+	return b.name + ":" + b.modeName
 }
 
 func (b *archBase) id() processorType {
@@ -15,6 +34,64 @@ func (b *archBase) initialMode() processorMode {
 	return b.mode
 }
 
+func (b *archBase) minInstructionSize() uint {
+	return b.minInstrLen
+}
+
 func (b *archBase) maxInstructionSize() uint {
 	return b.maxInstrLen
 }
+
+func (b *archBase) disassembler(mode processorMode) (*cs.Engine, error) {
+	if engine, found := b.engines[mode.cs]; found {
+		return engine, nil
+	}
+
+	engine, err := cs.New(b.processor.cs, mode.cs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Represent undecodable data as .byte entries, rather than stopping
+	if err = engine.Option(cs.OPT_TYPE_SKIPDATA, cs.OPT_ON); err != nil {
+		engine.Close()
+		return nil, err
+	}
+
+	if b.engines == nil {
+		b.engines = make(map[int]*cs.Engine)
+	}
+	b.engines[mode.cs] = engine
+
+	return engine, nil
+}
+
+func (b *archBase) assembler(mode processorMode) (*ks.Keystone, error) {
+	if asm, found := b.assemblers[mode.ks]; found {
+		return asm, nil
+	}
+
+	asm, err := ks.New(ks.Architecture(b.processor.ks), ks.Mode(mode.ks))
+	if err != nil {
+		return nil, err
+	}
+
+	if b.assemblers == nil {
+		b.assemblers = make(map[int]*ks.Keystone)
+	}
+	b.assemblers[mode.ks] = asm
+
+	return asm, nil
+}
+
+func (b *archBase) closeEngines() {
+	for _, engine := range b.engines {
+		engine.Close()
+	}
+	b.engines = nil
+
+	for _, asm := range b.assemblers {
+		asm.Close()
+	}
+	b.assemblers = nil
+}
@@ -4,18 +4,23 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	ks "github.com/keystone-engine/keystone/bindings/go/keystone"
+	cs "github.com/lunixbochs/capstr"
 )
 
 // Processor type ID
 type processorType struct {
 	uc int // Unicorn ID for processor type
 	cs int // Capstone ID for processor type
+	ks int // Keystone ID for processor type
 }
 
 // Processor mode ID
 type processorMode struct {
 	uc int // Unicorn ID for the initial mode
 	cs int // Capstone ID for for the initial mode
+	ks int // Keystone ID for the initial mode
 }
 
 type archConstructor func(mode string) (Architecture, error)
@@ -24,6 +29,13 @@ type archConstructor func(mode string) (Architecture, error)
 // working with architectures-specific properties, such as register
 // definitions.
 type Architecture interface {
+	// Return the name of the architecture (e.g., "arm")
+	Name() string
+
+	// Return the architecture and initial mode (e.g., "arm:thumb") in the
+	// form accepted by NewArchitecture()
+	Spec() string
+
 	// Return the architecture's processor type ID
 	id() processorType
 
@@ -33,13 +45,32 @@ type Architecture interface {
 	// Return the processor's current mode
 	currentMode(regs []Register) processorMode
 
+	// Return the name of the status register that determines the current
+	// mode. Passing only this register to currentMode() is sufficient.
+	statusRegister() string
+
 	// Adjust, if necessary (e.g., based upon mode or alignment), and return
 	// the initial PC value.
 	initialPC(pc uint64) uint64
 
+	// Get the minimum length of an instruction, which is also the alignment
+	// required of instruction addresses
+	minInstructionSize() uint
+
 	// Get the maximum length of an instruction
 	maxInstructionSize() uint
 
+	// Return a disassembler for the specified mode. One is created upon first
+	// use of each mode and retained until closeEngines() is called.
+	disassembler(mode processorMode) (*cs.Engine, error)
+
+	// Return an assembler for the specified mode. One is created upon first
+	// use of each mode and retained until closeEngines() is called.
+	assembler(mode processorMode) (*ks.Keystone, error)
+
+	// Release all disassemblers and assemblers
+	closeEngines()
+
 	// Adjust current PC, if necessary.  This allows architecture-specific
 	// information (e.g., current mode denoted by status register) to be
 	// considered before passing the PC the emulator when (re)starting it.
@@ -58,6 +89,37 @@ type Architecture interface {
 	//
 	exception(intno uint32, regs []Register, instr []byte) Exception
 
+	// Return the calling convention used to invoke functions via Debugger.Call()
+	callingConvention() callingConvention
+
+	// Return true if `instr` is a call instruction, which saves a return
+	// address (e.g., Arm BL and BLX). The `regs` function returns the current
+	// state of registers, should it be needed to determine the mode.
+	isCall(instr []byte, regs func() []Register) bool
+
+	// Return the address and mode of the code branched to by `instr`, located
+	// at `addr` and executed in `mode`, if these can be determined from the
+	// instruction alone (e.g., Arm BL and BLX <imm>).
+	branchTarget(addr uint64, instr []byte, mode processorMode) (uint64, processorMode, bool)
+
+	// Return structured details of a disassembled instruction, given its
+	// encoding `bytes` and the mode it was decoded in
+	instrDetail(instr Disassembly, bytes []byte, mode processorMode) InstrDetail
+
+	// Return the condition that processor state (e.g., an Arm Thumb IT block)
+	// imposes upon the next instruction, or "" if there is none. The `regs`
+	// parameter should contain the current state of registers.
+	pendingCondition(regs []Register) string
+
+	// Return true if the condition code `cond` (e.g., "eq") passes, given the
+	// current state of registers
+	conditionPasses(cond string, regs []Register) bool
+
+	// Return the register values that must be written, in order, to begin
+	// executing the function at `addr` such that it returns to `retAddr`.
+	// The `regs` parameter should contain the current state of registers.
+	callRegisters(addr, retAddr uint64, regs []Register) []Register
+
 	// Parse a string and return a Register.
 	// Expected form: <reg name>=<value>
 	ParseRegister(s string) (Register, error)
@@ -0,0 +1,227 @@
+package aemulari
+
+import (
+	"fmt"
+)
+
+// Maximum number of calls retained by the shadow call stack. The oldest
+// calls are discarded first.
+const maxShadowFrames = 1024
+
+// Maximum number of frame records followed via the frame pointer
+const maxFrameRecords = 64
+
+// How a StackFrame was determined
+type FrameSource int
+
+const (
+	FramePC     FrameSource = iota // The current program counter
+	FrameShadow                    // A call observed during execution
+	FrameLR                        // The link register
+	FrameFP                        // A frame record located via the frame pointer
+)
+
+// Returns a short name for the FrameSource
+func (s FrameSource) String() string {
+	switch s {
+	case FramePC:
+		return "pc"
+	case FrameShadow:
+		return "call"
+	case FrameLR:
+		return "lr"
+	case FrameFP:
+		return "fp"
+	default:
+		return "unknown"
+	}
+}
+
+// A single entry in a backtrace
+type StackFrame struct {
+	Address  uint64      // The PC for the innermost frame; otherwise, a return address
+	CallSite uint64      // Address of the call instruction, if known
+	Function uint64      // Address of the called function, if known
+	Symbol   string      // Symbolized form of Address (e.g., "main+0x1c"), if available
+	Source   FrameSource // How the frame was determined
+}
+
+// Returns a string describing the frame
+func (f StackFrame) String() string {
+	ret := fmt.Sprintf("0x%08x", f.Address)
+	if f.Symbol != "" {
+		ret += " " + f.Symbol
+	}
+	return ret
+}
+
+// A call observed by the shadow call stack
+type shadowFrame struct {
+	site   uint64 // Address of the call instruction
+	ret    uint64 // Address following the call instruction
+	target uint64 // Address of the called function
+}
+
+// Shadow call stack, maintained by observing calls and returns
+type shadowStack struct {
+	dbg      *Debugger
+	frames   []shadowFrame
+	pending  bool // The last instruction executed was a call
+	disabled bool
+}
+
+// Enable (the default) or disable maintenance of the shadow call stack used
+// by Backtrace(). Disabling it speeds up execution somewhat, which may be
+// desirable when fuzzing, and discards any calls it contains.
+func (d *Debugger) SetCallTracking(enabled bool) {
+	d.calls.disabled = !enabled
+	d.calls.frames = nil
+	d.calls.pending = false
+}
+
+// Invoked upon reaching the instruction at `addr`, before it executes.
+// A call's return address being reached unwinds the call and any made after
+// it, regardless of how it was reached (e.g., bx lr, pop {pc}, or longjmp).
+func (s *shadowStack) arrive(addr uint64) {
+	if s.disabled || len(s.frames) == 0 {
+		return
+	}
+
+	for i := len(s.frames) - 1; i >= 0; i-- {
+		if s.frames[i].ret == addr {
+			s.frames = s.frames[:i]
+			s.pending = false
+			return
+		}
+	}
+
+	if s.pending {
+		s.frames[len(s.frames)-1].target = addr
+		s.pending = false
+	}
+}
+
+// Invoked as the `size`-byte instruction at `addr` executes
+func (s *shadowStack) execute(addr uint64, size uint32) {
+	if s.disabled {
+		return
+	}
+
+	d := s.dbg
+	instr, err := d.mu.MemRead(addr, uint64(size))
+	if err != nil {
+		return
+	}
+
+	regs := func() []Register {
+		regs, _ := d.ReadRegAll()
+		return regs
+	}
+
+	if !d.arch.isCall(instr, regs) {
+		return
+	}
+
+	if len(s.frames) == maxShadowFrames {
+		s.frames = s.frames[1:]
+	}
+
+	s.frames = append(s.frames, shadowFrame{site: addr, ret: addr + uint64(size)})
+	s.pending = true
+}
+
+// Returns true if `addr` is located in an executable region
+func (d *Debugger) isExecutable(addr uint64) bool {
+	for _, r := range d.mapped.Entries() {
+		if r.perms.Exec && addr >= r.base && addr < r.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the call stack, starting with the current PC, followed by the
+// return address of each caller. Calls observed during execution are used
+// when available. Otherwise, such as when execution began partway through
+// a program, the link register and frame records located via the frame
+// pointer (fp) are used instead, and should be considered best-effort.
+func (d *Debugger) Backtrace() ([]StackFrame, error) {
+	var frames []StackFrame
+
+	cc := d.arch.callingConvention()
+
+	pc, err := d.pc()
+	if err != nil {
+		return nil, err
+	}
+	frames = append(frames, d.stackFrame(pc&cc.codeMask, FramePC))
+
+	// Calls observed during execution, innermost first
+	if !d.calls.disabled && len(d.calls.frames) > 0 {
+		for i := len(d.calls.frames) - 1; i >= 0; i-- {
+			c := d.calls.frames[i]
+
+			f := d.stackFrame(c.ret, FrameShadow)
+			f.CallSite = c.site
+			frames = append(frames, f)
+
+			if c.target != 0 {
+				frames[len(frames)-2].Function = c.target
+			}
+		}
+		return frames, nil
+	}
+
+	lr, err := d.ReadRegByName(cc.lr)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := lr.Value & cc.codeMask
+	if ret != 0 && ret != frames[0].Address && d.isExecutable(ret) {
+		frames = append(frames, d.stackFrame(ret, FrameLR))
+	}
+
+	fp, err := d.ReadRegByName(cc.fp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Follow frame records until they no longer appear valid. Frames must
+	// be located at increasing addresses, as the stack grows downward.
+	for addr, n := fp.Value, 0; addr != 0 && n < maxFrameRecords; n++ {
+		ret, err := d.ReadPointer(uint64(int64(addr) + cc.fpRet))
+		if err != nil {
+			break
+		}
+
+		prev, err := d.ReadPointer(uint64(int64(addr) + cc.fpPrev))
+		if err != nil {
+			break
+		}
+
+		ret &= cc.codeMask
+		if !d.isExecutable(ret) {
+			break
+		}
+
+		// The innermost record may hold the return address already found in lr
+		if ret != frames[len(frames)-1].Address {
+			frames = append(frames, d.stackFrame(ret, FrameFP))
+		}
+
+		if prev <= addr {
+			break
+		}
+		addr = prev
+	}
+
+	return frames, nil
+}
+
+// Create a StackFrame for `addr`, symbolized if possible
+func (d *Debugger) stackFrame(addr uint64, source FrameSource) StackFrame {
+	f := StackFrame{Address: addr, Source: source}
+	f.Symbol, _ = d.Symbolize(addr)
+	return f
+}
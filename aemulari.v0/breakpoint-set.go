@@ -34,13 +34,14 @@ func (bps *breakpointSet) add(addr uint64) Breakpoint {
 	return bp
 }
 
-// Returns true if any BPs at `addr` were triggered
-func (bps *breakpointSet) process(addr uint64) bool {
-	var anyTriggered bool = false
+// Returns the BPs at `addr` that were triggered
+func (bps *breakpointSet) process(addr uint64) []*Breakpoint {
+	var triggered []*Breakpoint
 
 	for _, bp := range bps.byID {
-		triggered := bp.hit(addr)
-		anyTriggered = anyTriggered || triggered
+		if bp.hit(addr) {
+			triggered = append(triggered, bp)
+		}
 
 		if bp.Address != addr {
 			if bp.state == breakpointTriggered {
@@ -51,7 +52,7 @@ func (bps *breakpointSet) process(addr uint64) bool {
 		}
 	}
 
-	return anyTriggered
+	return triggered
 }
 
 // Remove all breakpoints
@@ -8,6 +8,8 @@ type Breakpoint struct {
 	Address uint64          // Address where Breakpoint is placed
 	count   uint            // Number of times the breakpoint's been hit
 	state   breakpointState // Current state of the breakpoint
+
+	callback BreakpointCallback // Invoked when hit, if non-nil
 }
 
 // A list of Breakpoint objects
@@ -56,6 +58,11 @@ func (b *Breakpoint) Enabled() bool {
 	return b.state != breakpointInactive
 }
 
+// Return the number of times the Breakpoint has been hit
+func (b *Breakpoint) HitCount() uint {
+	return b.count
+}
+
 // Register a potential breakpoint hit
 func (b *Breakpoint) hit(addr uint64) bool {
 	if addr != b.Address {
@@ -66,6 +73,11 @@ func (b *Breakpoint) hit(addr uint64) bool {
 		return false
 	}
 
+	// Execution is resuming from this breakpoint, which was already counted
+	if b.state == breakpointTriggered {
+		return false
+	}
+
 	b.count++
 
 	if b.state == breakpointArmed {
@@ -0,0 +1,239 @@
+package aemulari
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Name of the memory region used for the stack and buffer allocations
+// required by Call(). If no such region is mapped, one is created. It must be
+// executable, as functions return to its base address.
+const ScratchRegionName = "scratch"
+
+const (
+	defaultScratchSize = 0x10000 // Size of a scratch region created by Call()
+	callStackSize      = 0x4000  // Bytes at the top of the scratch region used as a stack
+	scratchReserved    = 0x10    // Bytes at the base of the scratch region reserved for the return address
+	allocAlign         = 0x10    // Alignment of allocations
+)
+
+// Describes how arguments and return values are passed to and from
+// functions invoked via Debugger.Call()
+type callingConvention struct {
+	args       []string // Registers used to pass the first arguments, in order
+	ret        []string // Registers containing return values, in order
+	sp         string   // Stack pointer
+	wordSize   uint64   // Size of arguments passed on the stack, in bytes
+	stackAlign uint64   // Required stack alignment at a call
+
+	lr       string // Link register, containing the return address at a call
+	fp       string // Frame pointer
+	fpRet    int64  // Offset from the frame pointer of the saved return address
+	fpPrev   int64  // Offset from the frame pointer of the caller's frame pointer
+	codeMask uint64 // Mask applied to return addresses (e.g., Arm's Thumb bit)
+}
+
+// The outcome of a function invoked via Debugger.Call()
+type CallResult struct {
+	Returned  bool       // True if the function returned
+	Return    []uint64   // Return value registers (e.g., r0 and r1 for Arm)
+	Reason    StopReason // Why execution stopped
+	Exception Exception  // Exception that occurred, if Reason is StopException
+}
+
+// Allocation state of the scratch region
+type scratchAlloc struct {
+	next uint64 // Offset of the next available byte
+}
+
+// Return the scratch region, mapping it above all other regions if needed
+func (d *Debugger) scratch() (MemRegion, error) {
+	if r, err := d.mapped.Get(ScratchRegionName); err == nil {
+		if r.size < scratchReserved+callStackSize+allocAlign {
+			return r, fmt.Errorf("The \"%s\" region must be at least 0x%x bytes.",
+				ScratchRegionName, scratchReserved+callStackSize+allocAlign)
+		} else if !r.perms.Exec {
+			return r, fmt.Errorf("The \"%s\" region must be executable.", ScratchRegionName)
+		}
+		return r, nil
+	}
+
+	var base uint64
+	for _, r := range d.mapped.Entries() {
+		if r.End() > base {
+			base = r.End()
+		}
+	}
+	base = (base + 0xfff) &^ 0xfff
+
+	r, err := NewMemRegionFromFields(ScratchRegionName, base, defaultScratchSize, "rwx", "", "")
+	if err != nil {
+		return r, err
+	}
+
+	if err = d.Map(r); err != nil {
+		return r, err
+	}
+
+	d.alloc.next = scratchReserved
+	return r, nil
+}
+
+// Allocate `size` bytes of zeroed memory in the scratch region, for use as
+// a buffer passed to a function invoked via Call(). Returns its address.
+func (d *Debugger) Alloc(size uint64) (uint64, error) {
+	r, err := d.scratch()
+	if err != nil {
+		return 0, err
+	}
+
+	if d.alloc.next < scratchReserved {
+		d.alloc.next = scratchReserved
+	}
+
+	size = (size + allocAlign - 1) &^ (allocAlign - 1)
+	if size == 0 || d.alloc.next+size > r.size-callStackSize {
+		return 0, fmt.Errorf("Insufficient space in the \"%s\" region to allocate %d bytes.",
+			ScratchRegionName, size)
+	}
+
+	addr := r.base + d.alloc.next
+	if err = d.WriteMem(addr, make([]byte, size)); err != nil {
+		return 0, err
+	}
+
+	d.alloc.next += size
+	return addr, nil
+}
+
+// Allocate memory in the scratch region and initialize it with `data`.
+// Returns its address.
+func (d *Debugger) AllocData(data []byte) (uint64, error) {
+	addr, err := d.Alloc(uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	return addr, d.WriteMem(addr, data)
+}
+
+// Release all allocations made via Alloc() and AllocData()
+func (d *Debugger) FreeAll() {
+	d.alloc.next = scratchReserved
+}
+
+// Invoke the function at `addr` with the provided arguments, per the
+// architecture's calling convention (the AAPCS for Arm), and run until it
+// returns. For Arm, bit 0 of `addr` selects Thumb state. Each argument
+// occupies a single word; those that do not fit in registers are passed on
+// a stack located at the top of the scratch region.
+//
+// If the function returns, all registers other than those containing
+// return values are restored to their prior state. Otherwise (e.g., due to
+// a breakpoint or exception), registers are left as-is for inspection, and
+// the CallResult describes why execution stopped.
+func (d *Debugger) Call(addr uint64, args ...uint64) (CallResult, error) {
+	var result CallResult
+
+	cc := d.arch.callingConvention()
+
+	scratch, err := d.scratch()
+	if err != nil {
+		return result, err
+	}
+
+	saved, err := d.ReadRegAll()
+	if err != nil {
+		return result, err
+	}
+
+	endianness := d.arch.endianness(saved)
+
+	// Arguments beyond those passed in registers are placed on the stack
+	var stackArgs []uint64
+	if len(args) > len(cc.args) {
+		stackArgs = args[len(cc.args):]
+		args = args[:len(cc.args)]
+	}
+
+	sp := scratch.End() - uint64(len(stackArgs))*cc.wordSize
+	sp &^= cc.stackAlign - 1
+
+	for i, arg := range stackArgs {
+		word := make([]byte, 8)
+		if endianness == BigEndian {
+			binary.BigEndian.PutUint64(word, arg<<(64-8*cc.wordSize))
+		} else {
+			binary.LittleEndian.PutUint64(word, arg)
+		}
+
+		if err = d.WriteMem(sp+uint64(i)*cc.wordSize, word[:cc.wordSize]); err != nil {
+			return result, err
+		}
+	}
+
+	for i, arg := range args {
+		if err = d.WriteRegByName(cc.args[i], arg); err != nil {
+			return result, err
+		}
+	}
+
+	if err = d.WriteRegByName(cc.sp, sp); err != nil {
+		return result, err
+	}
+
+	// The function returns to the reserved word at the base of the scratch
+	// region, where execution is stopped before it executes. The emulator
+	// may check that it's fetchable first, so the region is executable.
+	retAddr := scratch.base
+	if err = d.WriteRegs(d.arch.callRegisters(addr, retAddr, saved)); err != nil {
+		return result, err
+	}
+
+	result.Exception, err = d.run(-1, retAddr)
+	result.Reason = d.step.reason
+	if err != nil {
+		return result, err
+	}
+
+	for _, name := range cc.ret {
+		reg, err := d.ReadRegByName(name)
+		if err != nil {
+			return result, err
+		}
+		result.Return = append(result.Return, reg.Value)
+	}
+
+	result.Returned = result.Reason == StopReturn
+	if !result.Returned {
+		return result, nil
+	}
+
+	// Restore the caller's state, retaining the return values
+	var restore []Register
+	for _, reg := range saved {
+		isRet := false
+		for _, name := range cc.ret {
+			if reg.Name() == name {
+				isRet = true
+				break
+			}
+		}
+
+		if !isRet {
+			restore = append(restore, reg)
+		}
+	}
+
+	return result, d.restoreRegs(restore)
+}
+
+// Return a string describing the outcome of a call
+func (r CallResult) String() string {
+	if r.Returned {
+		return "Function returned."
+	} else if r.Reason == StopException {
+		return "Function did not return due to an exception: " + r.Exception.String()
+	}
+	return "Function did not return. Execution stopped: " + r.Reason.String()
+}
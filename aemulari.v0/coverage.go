@@ -0,0 +1,226 @@
+package aemulari
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// Coverage export format
+type CoverageFormat int
+
+const (
+	CoverageDrcov CoverageFormat = iota // drcov (v2), as used by Lighthouse and Cartographer
+	CoverageList                        // List of basic block addresses, one per line
+)
+
+// Return the CoverageFormat associated with the name "drcov" or "list"
+func ParseCoverageFormat(s string) (CoverageFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "drcov", "":
+		return CoverageDrcov, nil
+	case "list":
+		return CoverageList, nil
+	default:
+		return CoverageDrcov, fmt.Errorf("Invalid coverage format: %s", s)
+	}
+}
+
+// A basic block that has been executed
+type BasicBlock struct {
+	Address uint64 // Address of the first instruction in the block
+	Size    uint32 // Size of the block, in bytes
+	Count   uint64 // Number of times the block has been executed
+}
+
+// Returns true if `addr` falls within the BasicBlock
+func (b BasicBlock) Contains(addr uint64) bool {
+	return addr >= b.Address && addr < b.Address+uint64(b.Size)
+}
+
+// Basic block coverage collection
+type coverage struct {
+	dbg     *Debugger
+	hook    uc.Hook
+	enabled bool
+	blocks  map[uint64]*BasicBlock // Block start address -> BasicBlock
+	covered map[uint64]bool        // Addresses within executed blocks
+
+	// A block is entered before its first instruction executes, at which
+	// point execution may yet stop (e.g., at a breakpoint). It's recorded
+	// only once that instruction executes.
+	entered    BasicBlock
+	hasEntered bool
+}
+
+func (c *coverage) reset() {
+	c.blocks = make(map[uint64]*BasicBlock)
+	c.covered = make(map[uint64]bool)
+	c.hasEntered = false
+}
+
+// Begin (or resume) collecting basic block coverage information.
+// Previously collected information is retained; see ResetCoverage().
+func (d *Debugger) StartCoverage() {
+	if d.cov.blocks == nil {
+		d.cov.reset()
+	}
+	d.cov.enabled = true
+}
+
+// Stop collecting coverage information. Collected information is retained.
+func (d *Debugger) StopCoverage() {
+	d.cov.enabled = false
+}
+
+// Discard all collected coverage information
+func (d *Debugger) ResetCoverage() {
+	d.cov.reset()
+}
+
+// Returns true if coverage information is currently being collected.
+func (d *Debugger) CoverageEnabled() bool {
+	return d.cov.enabled
+}
+
+// Retrieve all executed basic blocks, sorted by address (ascending)
+func (d *Debugger) Coverage() []BasicBlock {
+	ret := make([]BasicBlock, 0, len(d.cov.blocks))
+	for _, b := range d.cov.blocks {
+		ret = append(ret, *b)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Address < ret[j].Address
+	})
+
+	return ret
+}
+
+// Returns true if the instruction at `addr` is part of an executed basic block
+func (d *Debugger) Covered(addr uint64) bool {
+	return d.cov.covered[addr]
+}
+
+// Write collected coverage information to `w` in the specified format
+func (d *Debugger) WriteCoverage(w io.Writer, format CoverageFormat) error {
+	switch format {
+	case CoverageList:
+		return d.writeCoverageList(w)
+	case CoverageDrcov:
+		return d.writeCoverageDrcov(w)
+	default:
+		return errors.New("Invalid coverage format.")
+	}
+}
+
+func (d *Debugger) writeCoverageList(w io.Writer) error {
+	for _, b := range d.Coverage() {
+		if _, err := fmt.Fprintln(w, d.FormatAddress(b.Address)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write coverage in the drcov (version 2) format. Each executable memory
+// region is presented as a module, with its input file (if any) as the
+// module path. Blocks outside of executable regions are omitted.
+func (d *Debugger) writeCoverageDrcov(w io.Writer) error {
+	var modules []MemRegion
+	var entries []byte
+
+	for _, r := range d.Mapped() {
+		if r.perms.Exec {
+			modules = append(modules, r)
+		}
+	}
+
+	count := 0
+	entry := make([]byte, 8)
+
+	for _, b := range d.Coverage() {
+		for id, m := range modules {
+			if b.Address < m.base || b.Address >= m.End() {
+				continue
+			}
+
+			// struct { uint32_t start; uint16_t size; uint16_t mod_id; }
+			binary.LittleEndian.PutUint32(entry[0:], uint32(b.Address-m.base))
+			binary.LittleEndian.PutUint16(entry[4:], uint16(b.Size))
+			binary.LittleEndian.PutUint16(entry[6:], uint16(id))
+			entries = append(entries, entry...)
+			count++
+			break
+		}
+	}
+
+	header := "DRCOV VERSION: 2\n" +
+		"DRCOV FLAVOR: drcov\n" +
+		fmt.Sprintf("Module Table: version 2, count %d\n", len(modules)) +
+		"Columns: id, base, end, entry, checksum, timestamp, path\n"
+
+	for id, m := range modules {
+		path := m.inputFile
+		if path == "" {
+			path = m.name
+		}
+
+		header += fmt.Sprintf("%3d, 0x%016x, 0x%016x, 0x%016x, 0x%08x, 0x%08x, %s\n",
+			id, m.base, m.End(), 0, 0, 0, path)
+	}
+
+	header += fmt.Sprintf("BB Table: %d bbs\n", count)
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(entries)
+	return err
+}
+
+// Basic block callback
+func (c *coverage) cb(mu uc.Unicorn, addr uint64, size uint32) {
+	if !c.enabled {
+		return
+	}
+
+	c.entered = BasicBlock{Address: addr, Size: size}
+	c.hasEntered = true
+
+	// Execution only stops before an instruction within the code region,
+	// where the code step callback is installed. Elsewhere, it's certain to
+	// proceed.
+	if code := c.dbg.code(); addr < code.base || addr >= code.End() {
+		c.execute(addr)
+	}
+}
+
+// Called by the code step callback when the instruction at `addr` executes.
+// Records the block just entered, if this is its first instruction.
+func (c *coverage) execute(addr uint64) {
+	if !c.hasEntered || addr != c.entered.Address {
+		return
+	}
+	c.hasEntered = false
+
+	b, found := c.blocks[addr]
+	if !found {
+		b = &BasicBlock{Address: addr}
+		c.blocks[addr] = b
+	}
+
+	b.Count++
+	for a := addr + uint64(b.Size); a < addr+uint64(c.entered.Size); a++ {
+		c.covered[a] = true
+	}
+	if c.entered.Size > b.Size {
+		b.Size = c.entered.Size
+	}
+}
@@ -1,12 +1,11 @@
 package aemulari
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"sync/atomic"
 
-	cs "github.com/lunixbochs/capstr"
 	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
 )
 
@@ -21,13 +20,25 @@ type Debugger struct {
 	bps    breakpointSet  // Breakpoint settings
 	exInfo exceptionInfo  // CPU Exception handling
 	ts     ToolSync       // External tool synchronization
+	trace  instrTrace     // Instruction trace recording
+	cov    coverage       // Basic block coverage collection
+	syms   symbolTable    // Symbols loaded via LoadSymbols()
+	alloc  scratchAlloc   // Scratch region allocations made via Alloc()
+	calls  shadowStack    // Calls observed during execution, for Backtrace()
+	disasm disasmCache    // Decoded instructions and the modes they execute in
+	patch  patchList      // Patches applied via PatchBytes() and PatchAsm()
+
+	memHooks      []*memoryHook // User-supplied memory access hooks
+	nextMemHookID int
 }
 
 // Configuration of Debugger's initial state
 type DebuggerConfig struct {
-	Regs []Register   // Default register values
-	Mem  MemRegionSet // Memory region configuration
-	EnToolSync bool	  // Enable use of external tool synchronization
+	Regs       []Register     // Default register values
+	Mem        MemRegionSet   // Memory region configuration
+	EnToolSync bool           // Enable use of external tool synchronization
+	ToolSync   ToolSyncConfig // External tool synchronization settings
+	PatchFiles []string       // Patch files to apply once memory is loaded
 }
 
 // A single disassembled instruction separated into its components
@@ -37,6 +48,8 @@ type Disassembly struct {
 	Opcode     string // String representation of the binary opcode
 	Mnemonic   string // String representation of the instruction mnemonic
 	Operands   string // String representation of the instruction operands
+
+	Detail InstrDetail // Operands, registers used, and branch target
 }
 
 // Returns true if two instructions are the same, and false otherwise.
@@ -54,6 +67,10 @@ type exceptionInfo struct {
 	dbg  *Debugger
 	hook uc.Hook
 	last Exception // Most recently occurring exception
+
+	faultHook uc.Hook
+	fault     MemFault // Most recent invalid memory access
+	faulted   bool     // An invalid memory access occurred during the last run
 }
 
 // Data used to implement stepping and breakpoints
@@ -63,6 +80,19 @@ type codeStep struct {
 	hook    uc.Hook
 	options uc.UcOptions
 
+	reason      StopReason // Why execution most recently stopped
+	interrupted int32      // Set atomically by Interrupt(), from another goroutine
+	executed    uint64     // Instructions executed since init
+	budget      uint64     // Instruction budget for Continue() and Call(); 0 if unlimited
+	budgeted    bool       // The current run is limited by the budget
+	start       uint64     // Value of `executed` when the current run began
+
+	// Set by runTo() to stop upon reaching `target`, once the shadow call
+	// stack is no more than `depth` calls deep (or at any depth, if < 0)
+	targeted bool
+	target   uint64
+	depth    int
+
 	// Need to backup state prior to stopping emulator and restore it
 	// after we return from our execution. Unclear if this is necessitated
 	// due to a Unicorn defect, or our own misuse of the framework
@@ -125,10 +155,12 @@ func (d *Debugger) init(arch Architecture, cfg DebuggerConfig, reset bool) error
 	d.cfg = cfg
 	d.arch = arch
 
-	// Keep existing breakpoints if we're resetting the debugger
+	// Keep existing breakpoints and symbols if we're resetting the debugger
 	if !reset {
 		d.bps.initialize()
+		d.syms.initialize()
 	}
+	d.alloc.next = scratchReserved
 
 	d.mu, err = uc.NewUnicorn(d.arch.id().uc, d.arch.initialMode().uc)
 	if err != nil {
@@ -180,16 +212,28 @@ func (d *Debugger) init(arch Architecture, cfg DebuggerConfig, reset bool) error
 		}
 	}
 
-	if d.cfg.EnToolSync {
-		if err = d.ts.Open(); err != nil {
+	// The connection is retained across resets of the debugger
+	if d.cfg.EnToolSync && !d.ts.isInitialized {
+		if err = d.ts.Open(d.cfg.ToolSync); err != nil {
 			return d.closeAll(err)
 		}
+	}
+
+	if d.cfg.EnToolSync {
 		d.ts.SendCurrAddress(pcVal)
+		if regs, err := d.ReadRegAll(); err == nil {
+			d.ts.SendRegisters(regs)
+		}
 	}
 
 	// Code stepping setup
 	d.step.options = uc.UcOptions{Timeout: 0, Count: 0}
 	d.step.dbg = d
+	d.step.reason = StopNone
+	d.step.executed = 0
+	d.calls.dbg = d
+	d.calls.frames = nil
+	d.calls.pending = false
 	codeMem := d.code()
 	d.step.hook, err = d.mu.HookAdd(uc.HOOK_CODE, d.step.cb, codeMem.base, codeMem.size)
 	if err != nil {
@@ -202,6 +246,52 @@ func (d *Debugger) init(arch Architecture, cfg DebuggerConfig, reset bool) error
 		return d.closeAll(err)
 	}
 
+	d.exInfo.faultHook, err = d.mu.HookAdd(uc.HOOK_MEM_INVALID, d.exInfo.faultCb, 1, 0)
+	if err != nil {
+		return d.closeAll(err)
+	}
+
+	// Coverage information is only recorded once enabled, but the hook
+	// is always installed so it may be toggled at any time.
+	d.cov.dbg = d
+	d.cov.hook, err = d.mu.HookAdd(uc.HOOK_BLOCK, d.cov.cb, 1, 0)
+	if err != nil {
+		return d.closeAll(err)
+	}
+
+	// Memory contents may differ after a reset, so nothing is retained
+	d.disasm.dbg = d
+	d.disasm.clear()
+	d.patch.list = nil
+	d.disasm.blockHook, err = d.mu.HookAdd(uc.HOOK_BLOCK, d.disasm.blockCb, 1, 0)
+	if err != nil {
+		return d.closeAll(err)
+	}
+
+	d.disasm.writeHook, err = d.mu.HookAdd(uc.HOOK_MEM_WRITE, d.disasm.writeCb, codeMem.base, codeMem.End()-1)
+	if err != nil {
+		return d.closeAll(err)
+	}
+
+	// Memory hooks are retained across resets
+	if !reset {
+		d.memHooks = nil
+	}
+
+	for _, h := range d.memHooks {
+		if err = h.install(); err != nil {
+			return d.closeAll(err)
+		}
+	}
+
+	// Patches are applied last, as assembling code may depend upon the
+	// processor's initial mode
+	for _, filename := range d.cfg.PatchFiles {
+		if err = d.applyPatchFile(filename); err != nil {
+			return d.closeAll(err)
+		}
+	}
+
 	return nil
 }
 
@@ -221,6 +311,7 @@ func (d *Debugger) Close() error {
 }
 
 func (d *Debugger) closeAll(e error) error {
+	d.arch.closeEngines()
 	d.mu.Close()
 	d.ts.Close()
 	return e
@@ -310,6 +401,7 @@ func (d *Debugger) Unmap(name string) error {
 		ret = err
 	}
 
+	d.disasm.invalidate(m.base, m.size)
 	err = d.mu.MemUnmap(m.base, m.size)
 	if ret != nil {
 		ret = err
@@ -318,6 +410,15 @@ func (d *Debugger) Unmap(name string) error {
 	return ret
 }
 
+// Format an address as the architecture's program counter is formatted
+// (e.g., 0x00010000 for Arm).
+func (d *Debugger) FormatAddress(addr uint64) string {
+	if pc, err := d.arch.register("pc"); err == nil {
+		return fmt.Sprintf(pc.fmt, addr)
+	}
+	return fmt.Sprintf("0x%x", addr)
+}
+
 // Retrieve the emulated processor's current Endianness.
 func (d *Debugger) Endianness() (Endianness, error) {
 	regs, err := d.ReadRegAll()
@@ -445,6 +546,7 @@ func (d *Debugger) ReadMemRegion(name string) (uint64, []byte, error) {
 
 // Write `data` to memory at the address specified by `addr`
 func (d *Debugger) WriteMem(addr uint64, data []byte) error {
+	d.disasm.invalidate(addr, uint64(len(data)))
 	return d.mu.MemWrite(addr, data)
 }
 
@@ -468,12 +570,36 @@ func (d *Debugger) DumpMemRegion(filename, regionName string) error {
 	return d.DumpMem(filename, region.base, region.size)
 }
 
-func (d *Debugger) run(stepCount int64) (Exception, error) {
+// Write the current contents of a memory region to its output file, as is
+// otherwise done only when the region is unmapped
+func (d *Debugger) WriteRegionOutput(name string) error {
+	region, err := d.mapped.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if !region.HasOutputFile() {
+		return fmt.Errorf("Memory region \"%s\" has no output file.", name)
+	}
+
+	data, err := d.mu.MemRead(region.base, region.size)
+	if err != nil {
+		return err
+	}
+
+	return region.WriteFile(data)
+}
+
+// Run until `stepCount` instructions have executed (if non-negative), or
+// until execution reaches the address `until`.
+func (d *Debugger) run(stepCount int64, until uint64) (Exception, error) {
 	var err error
 
 	d.step.regs = []Register{}
-	d.step.count = stepCount
+	d.step.reason = StopNone
+	atomic.StoreInt32(&d.step.interrupted, 0)
 	d.exInfo.last = Exception{}
+	d.exInfo.faulted = false
 
 	/* FIXME: Coming back to this code years later, I'm not so certain this
 	 * register writeback still makes sense. I feel like this was me hacking
@@ -484,12 +610,33 @@ func (d *Debugger) run(stepCount int64) (Exception, error) {
 	 */
 	writeback := (stepCount < 0)
 
+	d.step.budgeted = stepCount < 0 && d.step.budget > 0
+	if d.step.budgeted {
+		stepCount = int64(d.step.budget)
+	}
+	d.step.count = stepCount
+	d.step.start = d.step.executed
+
 	pc, pc_err := d.pc()
 	if pc_err != nil {
 		return d.exInfo.last, err
 	}
 
-	err = d.mu.StartWithOptions(pc, d.code().End(), &d.step.options)
+	err = d.mu.StartWithOptions(pc, until, &d.step.options)
+
+	if d.exInfo.last.Occurred() {
+		d.step.reason = StopException
+	} else if d.exInfo.faulted {
+		d.step.reason = StopMemoryFault
+	} else if err != nil {
+		d.step.reason = StopError
+	} else if atomic.LoadInt32(&d.step.interrupted) != 0 {
+		d.step.reason = StopInterrupted
+	} else if d.step.reason == StopNone && until != d.code().End() {
+		d.step.reason = StopReturn
+	} else if d.step.reason == StopNone {
+		d.step.reason = StopEndOfCode
+	}
 
 	if writeback {
 		write_err := d.WriteRegs(d.step.regs)
@@ -498,12 +645,26 @@ func (d *Debugger) run(stepCount int64) (Exception, error) {
 		}
 	}
 
+	// Complete the record of the last instruction executed, now that we
+	// know how it affected register state.
+	d.trace.flush()
+	if d.trace.err != nil && err == nil {
+		err = d.trace.err
+	}
+
 	// Let any externally sync'd tools know where PC is now.
 	pc, pc_err = d.pc()
 	if pc_err == nil {
 		pc_err = d.ts.SendCurrAddress(pc)
 	}
 
+	if pc_err == nil {
+		var regs []Register
+		if regs, pc_err = d.ReadRegAll(); pc_err == nil {
+			pc_err = d.ts.SendRegisters(regs)
+		}
+	}
+
 	if pc_err != nil && err == nil {
 		err = pc_err
 	}
@@ -520,7 +681,7 @@ func (d *Debugger) Step(count int64) (Exception, error) {
 		return Exception{}, errors.New("Debugger.Step() requires that count >= 1.")
 	}
 
-	return d.run(count)
+	return d.run(count, d.code().End())
 }
 
 // Start or continue execution in the debugger. Upon hitting a breakpoint
@@ -531,24 +692,84 @@ func (d *Debugger) Step(count int64) (Exception, error) {
 // Exception.String() method may be used to retrieve information about the
 // exception.
 func (d *Debugger) Continue() (Exception, error) {
-	return d.run(-1)
+	return d.run(-1, d.code().End())
+}
+
+// Stop execution started by Step() or Continue(). This is intended to be
+// called from another goroutine, while execution is in progress, to break
+// out of a long-running (or infinite) loop.
+func (d *Debugger) Interrupt() error {
+	atomic.StoreInt32(&d.step.interrupted, 1)
+	return d.mu.Stop()
+}
+
+// Returns the reason that the most recent call to Step() or Continue()
+// returned, or StopNone if no code has been executed.
+func (d *Debugger) StopReason() StopReason {
+	return d.step.reason
+}
+
+// Returns the number of instructions executed since the Debugger was
+// created or last reset.
+func (d *Debugger) InstructionCount() uint64 {
+	return d.step.executed
+}
+
+// Limit the number of instructions executed by each call to Continue() or
+// Call(). When the budget is exhausted, execution stops with StopBudget.
+// A budget of 0 removes the limit.
+func (d *Debugger) SetInstructionBudget(budget uint64) {
+	d.step.budget = budget
+}
+
+// Returns the invalid memory access that stopped the most recent call to
+// Step(), Continue(), or Call(), if the StopReason is StopMemoryFault.
+func (d *Debugger) MemoryFault() (MemFault, bool) {
+	return d.exInfo.fault, d.exInfo.faulted
 }
 
 // Code step callback
 func (h *codeStep) cb(mu uc.Unicorn, addr uint64, size uint32) {
 	d := h.dbg
+	d.calls.arrive(addr)
 
-	breakpointTriggered := d.bps.process(addr)
+	breakpointTriggered := false
+	for _, bp := range d.bps.process(addr) {
+		if bp.callback == nil || bp.callback(d, *bp) {
+			breakpointTriggered = true
+		}
+	}
+
+	// The instruction at which a run begins doesn't count as reaching it
+	targetReached := d.step.targeted && addr == d.step.target &&
+		d.step.executed > d.step.start &&
+		(d.step.depth < 0 || len(d.calls.frames) <= d.step.depth)
+
+	if breakpointTriggered || targetReached || d.step.count == 0 {
+		if breakpointTriggered {
+			d.step.reason = StopBreakpoint
+		} else if targetReached {
+			d.step.reason = StopTarget
+		} else if d.step.budgeted {
+			d.step.reason = StopBudget
+		} else {
+			d.step.reason = StopStepComplete
+		}
 
-	if breakpointTriggered || d.step.count == 0 {
 		// The state of PC and status registers (e.g., ARM CPSR) will change
 		// after calling mu.Stop(). Back them up and restore them for the next
 		// time we start.
 		d.step.regs, _ = d.ReadRegAll()
 		mu.Stop()
+		return
 	} else if d.step.count > 0 {
 		d.step.count -= 1
 	}
+
+	d.step.executed++
+	d.trace.record(addr)
+	d.calls.execute(addr, size)
+	d.cov.execute(addr)
 }
 
 // Interrupt callback
@@ -580,6 +801,63 @@ func (e *exceptionInfo) cb(mu uc.Unicorn, intno uint32) {
 	d.exInfo.last = d.arch.exception(intno, regs, instr)
 }
 
+// Invalid memory access callback. The access is not handled, so the
+// emulator stops and reports an error.
+func (e *exceptionInfo) faultCb(mu uc.Unicorn, access int, addr uint64, size int, value int64) bool {
+	f := MemFault{Address: addr, Size: size}
+
+	switch access {
+	case uc.MEM_READ_UNMAPPED, uc.MEM_READ_PROT:
+		f.Access = "read"
+	case uc.MEM_WRITE_UNMAPPED, uc.MEM_WRITE_PROT:
+		f.Access = "write"
+	default:
+		f.Access = "fetch"
+	}
+
+	switch access {
+	case uc.MEM_READ_UNMAPPED, uc.MEM_WRITE_UNMAPPED, uc.MEM_FETCH_UNMAPPED:
+		f.Unmapped = true
+	}
+
+	e.fault = f
+	e.faulted = true
+	return false
+}
+
+// Returns the external tool synchronization settings, and whether
+// synchronization is enabled
+func (d *Debugger) ToolSyncConfig() (ToolSyncConfig, bool) {
+	return d.cfg.ToolSync, d.cfg.EnToolSync
+}
+
+// Returns a channel on which commands sent by an external tool are delivered,
+// or nil if tool synchronization is disabled or does not support commands.
+// Commands should be passed to ApplyToolSyncCommand() from the goroutine that
+// otherwise uses the Debugger.
+func (d *Debugger) ToolSyncCommands() <-chan ToolSyncCommand {
+	return d.ts.Commands()
+}
+
+// Carry out a command received from an external tool.
+func (d *Debugger) ApplyToolSyncCommand(c ToolSyncCommand) error {
+	switch c.Type {
+	case ToolSyncSetBreakpoint:
+		d.SetBreakpoint(c.Address)
+		return nil
+	case ToolSyncDeleteBreakpoints:
+		d.DeleteBreakpointsAt(c.Address)
+		return nil
+	case ToolSyncJump:
+		if err := d.WriteRegByName("pc", c.Address); err != nil {
+			return err
+		}
+		return d.ts.SendCurrAddress(c.Address)
+	default:
+		return fmt.Errorf("Unsupported tool sync command: %s", c.String())
+	}
+}
+
 // Disassemble `count` instructions, starting at the current program counter
 func (d *Debugger) Disassemble(count uint64) ([]Disassembly, error) {
 	if rv, err := d.ReadRegByName("pc"); err != nil {
@@ -590,79 +868,158 @@ func (d *Debugger) Disassemble(count uint64) ([]Disassembly, error) {
 }
 
 // Disassemble `count` instructions, starting at the address specified by `addr`.
+//
+// Each instruction is decoded in the mode (e.g., Arm or Thumb) that code at
+// its address was last executed in, so that code mixing modes is shown
+// correctly. Code that hasn't been executed is assumed to be in the mode
+// implied by BL and BLX instructions targeting it, or else in the same mode
+// as the preceding instruction, starting with the processor's current mode.
+// Instructions within the code region are cached until overwritten.
 func (d *Debugger) DisassembleAt(addr uint64, count uint64) ([]Disassembly, error) {
-	var code []byte
 	var ret []Disassembly
-	var err error
-	var disasm *cs.Engine // Capstone disassembly engine (via capstr)
-	var regs []Register
-
-	// If we run outside the bounds of mapped region, keep reducing the
-	// data length until we succeed
-	for len := count * uint64(d.arch.maxInstructionSize()); len > 0; len-- {
-		code, err = d.ReadMem(addr, len)
-		if err == nil {
-			break
-		}
-	}
 
-	regs, err =  d.ReadRegAll()
+	regs, err := d.ReadRegAll()
 	if err != nil {
 		return ret, err
 	}
 
-	// TODO: Don't create (and destory) a new disassembly engine every time
-	//		 we're called. Push this into the Architecture to provide us the handle.
-	//		 Under the hood we can create disassembler for each valid mode and return
-	//		 the one pertaining to the current mode.
-	disasm, err = cs.New(d.arch.id().cs, d.arch.currentMode(regs).cs)
+	pc, err := d.ReadRegByName("pc")
 	if err != nil {
 		return ret, err
 	}
 
-	if err = disasm.Option(cs.OPT_TYPE_SKIPDATA, cs.OPT_ON); err != nil {
-		disasm.Close()
-		return ret, err
+	current := d.arch.currentMode(regs)
+	mode := current
+
+	for uint64(len(ret)) < count {
+		mode = d.modeAt(addr, d.InstructionAddress(pc.Value), current, mode)
+
+		instr, ok, err := d.decode(addr, mode)
+		if err != nil {
+			return ret, err
+		} else if !ok {
+			break
+		}
+
+		ret = append(ret, instr)
+		addr += uint64(len(instr.Opcode) / 2)
 	}
 
-	instrs, err := disasm.Dis(code, addr, count)
-	if err != nil {
-		disasm.Close()
-		return ret, err
+	return ret, nil
+}
+
+// Returns `addr` with any bits that aren't part of an instruction's address
+// cleared, such as the Thumb bit in Arm function pointers.
+func (d *Debugger) InstructionAddress(addr uint64) uint64 {
+	return addr & d.arch.callingConvention().codeMask
+}
+
+// Disassemble up to `count` instructions immediately preceding `addr`.
+//
+// For variable-length instruction sets (e.g., Thumb-2), the start of each
+// instruction can't be determined by reading backward. Instead, disassembly is
+// attempted from several increasingly earlier addresses, as a linear sweep
+// tends to synchronize with the actual instruction stream. The first sweep
+// arriving exactly at `addr` without encountering invalid instructions is
+// used, or failing that, the first arriving at `addr` at all.
+func (d *Debugger) DisassembleBefore(addr uint64, count uint64) ([]Disassembly, error) {
+	var fallback []Disassembly
+
+	maxLen := uint64(d.arch.maxInstructionSize())
+	back := count * maxLen
+
+	// Don't start before the region containing `addr`
+	var base uint64
+	for _, r := range d.mapped.Entries() {
+		if addr > r.base && addr <= r.End() {
+			base = r.base
+		}
 	}
 
-	for _, instr := range instrs {
-		var entry Disassembly
-		entry.AddressU64 = instr.Addr()
-		entry.Address = fmt.Sprintf("%08x", instr.Addr())
-		entry.Opcode = hex.EncodeToString(instr.Bytes())
-		entry.Mnemonic = instr.Mnemonic()
-		entry.Operands = instr.OpStr()
-		ret = append(ret, entry)
+	for extra := uint64(0); extra <= 2*maxLen; extra += 2 {
+		start := base
+		if addr-base > back+extra {
+			start = addr - back - extra
+		}
+
+		// Disassemble through the instruction at `addr`, if possible
+		instrs, err := d.DisassembleAt(start, (addr-start)/2+1)
+		if err != nil {
+			return nil, err
+		}
+
+		end := -1
+		for i, instr := range instrs {
+			if instr.AddressU64 >= addr {
+				if instr.AddressU64 == addr {
+					end = i
+				}
+				break
+			} else if i == len(instrs)-1 && instr.AddressU64+uint64(len(instr.Opcode)/2) == addr {
+				end = len(instrs)
+			}
+		}
+
+		if end < 0 {
+			continue
+		}
+
+		first := 0
+		if uint64(end) > count {
+			first = end - int(count)
+		}
+		instrs = instrs[first:end]
+
+		valid := true
+		for _, instr := range instrs {
+			if instr.Mnemonic == ".byte" {
+				valid = false
+			}
+		}
+
+		if valid {
+			return instrs, nil
+		} else if fallback == nil {
+			fallback = instrs
+		}
+
+		if start == base {
+			break
+		}
 	}
 
-	disasm.Close()
-	return ret, nil
+	return fallback, nil
 }
 
 // Set a breakpoint at the specified address. It will automatically
 // be assigned an ID.
 func (d *Debugger) SetBreakpoint(addr uint64) Breakpoint {
-	return d.bps.add(addr)
+	bp := d.bps.add(addr)
+	d.ts.SendBreakpoint(bp, true)
+	return bp
 }
 
 // Delete all existing breakpoints.
 func (d *Debugger) DeleteAllBreakpoints() {
+	for _, bp := range d.bps.get() {
+		d.ts.SendBreakpoint(bp, false)
+	}
 	d.bps.removeAll()
 }
 
 // Delete all breakpoints at the specified address/
 func (d *Debugger) DeleteBreakpointsAt(addr uint64) {
+	for _, bp := range d.bps.getAllAt(addr) {
+		d.ts.SendBreakpoint(bp, false)
+	}
 	d.bps.removeAllAt(addr)
 }
 
 // Delete the breakpoint associated with the specified ID.
 func (d *Debugger) DeleteBreakpoint(id int) {
+	if bp, present := d.bps.byID[id]; present {
+		d.ts.SendBreakpoint(*bp, false)
+	}
 	d.bps.remove(id)
 }
 
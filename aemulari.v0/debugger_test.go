@@ -0,0 +1,301 @@
+package aemulari
+
+import (
+	"os"
+	"testing"
+)
+
+// Programs built by test-asm, which requires an arm-none-eabi toolchain
+const testAsmDir = "../test-asm/arm/"
+
+// Create a Debugger executing a test-asm program mapped at 0x10000, in the
+// specified architecture (e.g., "arm:thumb"). The test is skipped if the
+// program hasn't been built.
+func newTestDebugger(t *testing.T, arch, program string) *Debugger {
+	t.Helper()
+
+	filename := testAsmDir + program
+	if _, err := os.Stat(filename); err != nil {
+		t.Skipf("%s has not been built. Run \"make test-asm\".", filename)
+	}
+
+	a, err := NewArchitecture(arch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem, err := NewMemRegionSet([]string{"code:0x10000:0x1000:rx:" + filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbg, err := NewDebugger(a, DebuggerConfig{Mem: mem})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dbg
+}
+
+// Fail unless registers have the expected values
+func expectRegs(t *testing.T, dbg *Debugger, expected map[string]uint64) {
+	t.Helper()
+
+	for name, value := range expected {
+		reg, err := dbg.ReadRegByName(name)
+		if err != nil {
+			t.Fatal(err)
+		} else if reg.Value != value {
+			t.Errorf("%s = 0x%x, expected 0x%x", name, reg.Value, value)
+		}
+	}
+}
+
+// Fail unless execution stopped for the expected reason
+func expectStop(t *testing.T, dbg *Debugger, reason StopReason) {
+	t.Helper()
+
+	if dbg.StopReason() != reason {
+		t.Fatalf("Stopped due to \"%s\", expected \"%s\"", dbg.StopReason(), reason)
+	}
+}
+
+func TestContinueToBkpt(t *testing.T) {
+	tests := []struct {
+		arch, program string
+		regs          map[string]uint64
+	}{
+		{"arm", "count.arm.bin", map[string]uint64{
+			"r0": 127, "r1": 7, "r2": 0x84, "r3": 0x78, "r4": 0x2f4,
+			"r5": 0x1f80, "r6": 1, "r7": 0x78, "r8": 0x7e, "r9": 6,
+		}},
+		{"arm:thumb", "count.thumb.bin", map[string]uint64{
+			"r0": 127, "r1": 7, "r2": 132, "r3": 120,
+			"r4": 756, "r5": 120, "r6": 126, "r7": 6,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.program, func(t *testing.T) {
+			dbg := newTestDebugger(t, test.arch, test.program)
+			defer dbg.Close()
+
+			exception, err := dbg.Continue()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectStop(t, dbg, StopException)
+			if kind := exception.Kind(); kind != "bkpt" {
+				t.Errorf("Stopped due to a \"%s\" exception, expected \"bkpt\"", kind)
+			}
+
+			expectRegs(t, dbg, test.regs)
+		})
+	}
+}
+
+func TestStep(t *testing.T) {
+	dbg := newTestDebugger(t, "arm", "count.arm.bin")
+	defer dbg.Close()
+
+	if _, err := dbg.Step(20); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, dbg, StopStepComplete)
+	expectRegs(t, dbg, map[string]uint64{
+		"pc": 0x10024, "r1": 1, "r2": 1, "r3": 0xffffffff, "r8": 1, "r9": 0,
+	})
+
+	if count := dbg.InstructionCount(); count != 20 {
+		t.Errorf("Executed %d instructions, expected 20", count)
+	}
+
+	// Stepping resumes where the last step stopped
+	if _, err := dbg.Step(1); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, dbg, StopStepComplete)
+	expectRegs(t, dbg, map[string]uint64{"pc": 0x10028})
+}
+
+func TestBreakpoint(t *testing.T) {
+	dbg := newTestDebugger(t, "arm", "count.arm.bin")
+	defer dbg.Close()
+
+	dbg.SetBreakpoint(0x10008)
+
+	// The breakpoint is hit upon each iteration of the inner loop
+	for j := uint64(0); j < 3; j++ {
+		if _, err := dbg.Continue(); err != nil {
+			t.Fatal(err)
+		}
+
+		expectStop(t, dbg, StopBreakpoint)
+		expectRegs(t, dbg, map[string]uint64{"pc": 0x10008, "r0": 0, "r1": j})
+	}
+
+	bps := dbg.GetBreakpoints()
+	if len(bps) != 1 || bps[0].HitCount() != 3 {
+		t.Errorf("Expected a single breakpoint, hit 3 times: %v", bps)
+	}
+
+	// Once removed, execution continues to the end of the program
+	dbg.DeleteAllBreakpoints()
+	if _, err := dbg.Continue(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, dbg, StopException)
+	expectRegs(t, dbg, map[string]uint64{"r0": 127})
+}
+
+func TestRunTo(t *testing.T) {
+	dbg := newTestDebugger(t, "arm", "count.arm.bin")
+	defer dbg.Close()
+
+	if _, err := dbg.RunTo(0x10030); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, dbg, StopTarget)
+	expectRegs(t, dbg, map[string]uint64{"pc": 0x10030, "r0": 0, "r1": 1})
+}
+
+func TestReset(t *testing.T) {
+	dbg := newTestDebugger(t, "arm", "count.arm.bin")
+	defer dbg.Close()
+
+	if _, err := dbg.Step(20); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dbg.Reset(false); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStop(t, dbg, StopNone)
+	expectRegs(t, dbg, map[string]uint64{"pc": 0x10000, "r1": 0})
+
+	if count := dbg.InstructionCount(); count != 0 {
+		t.Errorf("Executed %d instructions after a reset, expected 0", count)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	dbg := newTestDebugger(t, "arm", "count.arm.bin")
+	defer dbg.Close()
+
+	count := func(addr uint64) uint64 {
+		for _, b := range dbg.Coverage() {
+			if b.Address == addr {
+				return b.Count
+			}
+		}
+		return 0
+	}
+
+	dbg.StartCoverage()
+	dbg.SetBreakpoint(0x10008)
+
+	// The first hit is within the block at 0x10000. The inner loop's block
+	// is entered by the second and third, but not executed until resuming.
+	for i := 0; i < 3; i++ {
+		if _, err := dbg.Continue(); err != nil {
+			t.Fatal(err)
+		}
+		expectStop(t, dbg, StopBreakpoint)
+	}
+
+	if n := count(0x10008); n != 1 {
+		t.Errorf("Inner loop executed %d times, expected 1", n)
+	}
+
+	if dbg.Covered(0x10034) {
+		t.Error("Outer loop increment reported as covered before it was executed")
+	}
+
+	dbg.DeleteAllBreakpoints()
+	if _, err := dbg.Continue(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[uint64]uint64{0x10000: 1, 0x10004: 126, 0x10008: 127 * 6, 0x10034: 127}
+	for addr, n := range expected {
+		if c := count(addr); c != n {
+			t.Errorf("Block 0x%x executed %d times, expected %d", addr, c, n)
+		}
+	}
+
+	for _, addr := range []uint64{0x10000, 0x10008, 0x10030, 0x10034} {
+		if !dbg.Covered(addr) {
+			t.Errorf("0x%x not reported as covered", addr)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		arch, program string
+		addr          uint64
+		function      []byte
+	}{
+		// add r0, r0, r1; mov r1, #7; bx lr
+		{"arm", "count.arm.bin", 0x10800, []byte{
+			0x01, 0x00, 0x80, 0xe0, 0x07, 0x10, 0xa0, 0xe3, 0x1e, 0xff, 0x2f, 0xe1,
+		}},
+
+		// adds r0, r0, r1; movs r1, #7; bx lr
+		{"arm:thumb", "count.thumb.bin", 0x10801, []byte{
+			0x40, 0x18, 0x07, 0x21, 0x70, 0x47,
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.program, func(t *testing.T) {
+			dbg := newTestDebugger(t, test.arch, test.program)
+			defer dbg.Close()
+
+			if _, err := dbg.PatchBytes(test.addr&^1, test.function); err != nil {
+				t.Fatal(err)
+			}
+
+			// Run part of the program, so that there's state to restore
+			if _, err := dbg.Step(20); err != nil {
+				t.Fatal(err)
+			}
+
+			before, err := dbg.ReadRegAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := dbg.Call(test.addr, 5, 6)
+			if err != nil {
+				t.Fatal(err)
+			} else if !result.Returned || result.Reason != StopReturn {
+				t.Fatalf("Function did not return: %s", result)
+			}
+
+			if len(result.Return) != 2 || result.Return[0] != 11 || result.Return[1] != 7 {
+				t.Errorf("Unexpected return values: %v", result.Return)
+			}
+
+			expected := map[string]uint64{"r0": 11, "r1": 7}
+			for _, r := range before {
+				if r.Name() != "r0" && r.Name() != "r1" {
+					expected[r.Name()] = r.Value
+				}
+			}
+			expectRegs(t, dbg, expected)
+
+			// The program resumes where it left off
+			if _, err = dbg.Continue(); err != nil {
+				t.Fatal(err)
+			}
+			expectStop(t, dbg, StopException)
+		})
+	}
+}
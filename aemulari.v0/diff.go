@@ -0,0 +1,165 @@
+package aemulari
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A contiguous range of bytes whose contents differ from the original data
+type DiffRange struct {
+	Address  uint64
+	Original []byte
+	Current  []byte
+}
+
+// The changes made to a memory region, relative to its original contents
+type RegionDiff struct {
+	Region   MemRegion
+	Original []byte // Original contents of the entire region
+	Current  []byte // Current contents of the entire region
+	Ranges   []DiffRange
+}
+
+// Compare the current contents of a memory region to the data it was
+// initialized with: the contents of its input file, or zeros if it has none.
+func (d *Debugger) DiffRegion(name string) (RegionDiff, error) {
+	region, err := d.mapped.Get(name)
+	if err != nil {
+		return RegionDiff{}, err
+	}
+
+	original, err := region.LoadInputData()
+	if err != nil {
+		return RegionDiff{}, err
+	}
+
+	return d.diffRegion(region, original)
+}
+
+// Compare the current contents of a memory region to those captured by
+// Snapshot(). Only writable regions are included in a snapshot.
+func (d *Debugger) DiffRegionSnapshot(name string, s *Snapshot) (RegionDiff, error) {
+	region, err := d.mapped.Get(name)
+	if err != nil {
+		return RegionDiff{}, err
+	}
+
+	original, found := s.mem[name]
+	if !found {
+		return RegionDiff{}, fmt.Errorf("Memory region \"%s\" is not included in the snapshot.", name)
+	}
+
+	return d.diffRegion(region, original)
+}
+
+func (d *Debugger) diffRegion(region MemRegion, original []byte) (RegionDiff, error) {
+	current, err := d.mu.MemRead(region.base, region.size)
+	if err != nil {
+		return RegionDiff{}, err
+	}
+
+	if uint64(len(original)) != region.size {
+		return RegionDiff{}, fmt.Errorf("Original data for memory region \"%s\" is %d bytes, but the region is %d bytes.",
+			region.name, len(original), region.size)
+	}
+
+	diff := RegionDiff{Region: region, Original: original, Current: current}
+
+	for i := 0; i < len(current); {
+		if current[i] == original[i] {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(current) && current[i] != original[i] {
+			i++
+		}
+
+		diff.Ranges = append(diff.Ranges, DiffRange{
+			Address:  region.base + uint64(start),
+			Original: original[start:i],
+			Current:  current[start:i],
+		})
+	}
+
+	return diff, nil
+}
+
+// Returns the total number of bytes that differ
+func (r RegionDiff) Changed() uint64 {
+	var n uint64
+	for _, c := range r.Ranges {
+		n += uint64(len(c.Current))
+	}
+	return n
+}
+
+// IPS record limits
+const (
+	ipsMaxOffset = 0xffffff
+	ipsMaxSize   = 0xffff
+	ipsEOF       = 0x454f46 // Offset that would be mistaken for the "EOF" marker
+)
+
+// Write the changes as an IPS patch, which may be applied to the region's
+// input file. Offsets are relative to the start of the file, accounting for
+// the region's input file offset, and to the start of the region otherwise.
+// Patches cannot be created for regions loaded from Intel HEX files.
+func (r RegionDiff) WriteIPS(w io.Writer) error {
+	var fileOffset uint64
+
+	if r.Region.HasInputFile() {
+		_, offset, format := r.Region.InputFile()
+		if format != InputRaw {
+			return fmt.Errorf("Memory region \"%s\" was not loaded from a raw binary file. IPS patches cannot be created for it.",
+				r.Region.name)
+		}
+		fileOffset = offset
+	}
+
+	if _, err := io.WriteString(w, "PATCH"); err != nil {
+		return err
+	}
+
+	for _, c := range r.Ranges {
+		start := c.Address - r.Region.base
+		end := start + uint64(len(c.Current))
+
+		for start < end {
+			// Begin a byte earlier, which is unchanged, to avoid the EOF marker
+			if fileOffset+start == ipsEOF {
+				if start == 0 {
+					return errors.New("Changes at file offset 0x454f46 cannot be represented in an IPS patch.")
+				}
+				start--
+			}
+
+			offset := fileOffset + start
+			if offset > ipsMaxOffset {
+				return fmt.Errorf("Changes at file offset 0x%x exceed the IPS limit of 16 MiB.", offset)
+			}
+
+			size := end - start
+			if size > ipsMaxSize {
+				size = ipsMaxSize
+			}
+
+			record := []byte{
+				byte(offset >> 16), byte(offset >> 8), byte(offset),
+				byte(size >> 8), byte(size),
+			}
+			record = append(record, r.Current[start:start+size]...)
+
+			if _, err := w.Write(record); err != nil {
+				return err
+			}
+
+			start += size
+		}
+	}
+
+	_, err := io.WriteString(w, "EOF")
+	return err
+}
@@ -0,0 +1,107 @@
+package aemulari
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Returns an IPS record
+func ipsRecord(offset uint64, data []byte) []byte {
+	record := []byte{
+		byte(offset >> 16), byte(offset >> 8), byte(offset),
+		byte(len(data) >> 8), byte(len(data)),
+	}
+	return append(record, data...)
+}
+
+// Returns a diff of a region at 0x10000 with a single changed range.
+// Each byte of the region's current contents is the low byte of its offset.
+func testRegionDiff(size, start, length uint64, inputFile string, inputOffset uint64, format InputFormat) RegionDiff {
+	region := MemRegion{
+		name:        "data",
+		base:        0x10000,
+		size:        size,
+		inputFile:   inputFile,
+		inputOffset: inputOffset,
+		inputFormat: format,
+	}
+
+	current := make([]byte, size)
+	for i := range current {
+		current[i] = byte(i)
+	}
+
+	return RegionDiff{
+		Region:   region,
+		Original: make([]byte, size),
+		Current:  current,
+		Ranges: []DiffRange{{
+			Address:  region.base + start,
+			Original: make([]byte, length),
+			Current:  current[start : start+length],
+		}},
+	}
+}
+
+func TestWriteIPS(t *testing.T) {
+	split := testRegionDiff(0x20000, 0x10, 0x10002, "", 0, InputRaw)
+
+	tests := []struct {
+		name    string
+		diff    RegionDiff
+		records [][]byte
+	}{
+		{"no input file", testRegionDiff(0x100, 0x10, 2, "", 0, InputRaw),
+			[][]byte{ipsRecord(0x10, []byte{0x10, 0x11})}},
+
+		// Offsets are relative to the start of the input file
+		{"input file offset", testRegionDiff(0x100, 0x10, 2, "data.bin", 0x100, InputRaw),
+			[][]byte{ipsRecord(0x110, []byte{0x10, 0x11})}},
+
+		// A record can't begin at 0x454f46, so it begins a byte earlier
+		{"EOF offset", testRegionDiff(0x100, 0x46, 1, "data.bin", 0x454f00, InputRaw),
+			[][]byte{ipsRecord(0x454f45, []byte{0x45, 0x46})}},
+
+		// Records are limited to 0xffff bytes
+		{"split", split, [][]byte{
+			ipsRecord(0x10, split.Current[0x10:0x1000f]),
+			ipsRecord(0x1000f, split.Current[0x1000f:0x10012]),
+		}},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.diff.WriteIPS(&buf); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		expected := []byte("PATCH")
+		for _, r := range test.records {
+			expected = append(expected, r...)
+		}
+		expected = append(expected, "EOF"...)
+
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Errorf("%s: got %x, expected %x", test.name, buf.Bytes(), expected)
+		}
+	}
+}
+
+func TestWriteIPSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		diff RegionDiff
+	}{
+		{"Intel HEX", testRegionDiff(0x100, 0x10, 2, "data.hex", 0, InputIntelHex)},
+		{"EOF offset at region start", testRegionDiff(0x100, 0, 1, "data.bin", 0x454f46, InputRaw)},
+		{"beyond 16 MiB", testRegionDiff(0x100, 0x10, 2, "data.bin", 0xffffff, InputRaw)},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.diff.WriteIPS(&buf); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
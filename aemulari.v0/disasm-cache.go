@@ -0,0 +1,161 @@
+package aemulari
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// An instruction decoded by DisassembleAt()
+type decodedInstr struct {
+	mode  processorMode // Mode the instruction was decoded in
+	instr Disassembly
+}
+
+// Instructions decoded within the code region, and the mode that code at
+// each address is known (or expected) to execute in. Only the code region
+// is cached, as writes elsewhere aren't observed.
+type disasmCache struct {
+	dbg       *Debugger
+	blockHook uc.Hook
+	writeHook uc.Hook
+
+	decoded map[uint64]decodedInstr  // Address -> decoded instruction
+	modes   map[uint64]processorMode // Address -> mode of executed instructions
+	targets map[uint64]processorMode // Address -> mode implied by a BL or BLX
+}
+
+// Discard all decoded instructions and learned modes
+func (c *disasmCache) clear() {
+	c.decoded = make(map[uint64]decodedInstr)
+	c.modes = make(map[uint64]processorMode)
+	c.targets = make(map[uint64]processorMode)
+}
+
+// Discard decoded instructions overlapping the `size` bytes at `addr`
+func (c *disasmCache) invalidate(addr, size uint64) {
+	if len(c.decoded) == 0 {
+		return
+	}
+
+	// Include instructions that begin before `addr` but extend into it
+	if back := uint64(c.dbg.arch.maxInstructionSize() - 1); addr > back {
+		addr -= back
+		size += back
+	} else {
+		size += addr
+		addr = 0
+	}
+
+	if size > uint64(len(c.decoded)) {
+		for a := range c.decoded {
+			if a >= addr && a-addr < size {
+				delete(c.decoded, a)
+			}
+		}
+	} else {
+		for a := addr; a-addr < size; a++ {
+			delete(c.decoded, a)
+		}
+	}
+}
+
+// Basic block callback, recording the mode of newly executed code. A block
+// ends at any branch, so this also captures the targets of BX and BLX <reg>.
+func (c *disasmCache) blockCb(mu uc.Unicorn, addr uint64, size uint32) {
+	if _, known := c.modes[addr]; known {
+		return
+	}
+
+	d := c.dbg
+	status, err := d.ReadRegByName(d.arch.statusRegister())
+	if err != nil {
+		return
+	}
+
+	mode := d.arch.currentMode([]Register{status})
+	step := uint64(d.arch.minInstructionSize())
+	for a := addr; a < addr+uint64(size); a += step {
+		c.modes[a] = mode
+	}
+}
+
+// Memory write callback, for writes to the code region
+func (c *disasmCache) writeCb(mu uc.Unicorn, access int, addr uint64, size int, value int64) {
+	c.invalidate(addr, uint64(size))
+}
+
+// Returns true if instructions at `addr` may be cached
+func (c *disasmCache) cacheable(addr uint64) bool {
+	code, err := c.dbg.mapped.Get("code")
+	return err == nil && addr >= code.base && addr < code.End()
+}
+
+// Returns the mode in which to decode the instruction at `addr`. The current
+// mode is used at the PC, followed by that of code previously executed at
+// `addr`, the mode implied by a BL or BLX targeting `addr`, and lastly,
+// `prev`, the mode of the preceding instruction.
+func (d *Debugger) modeAt(addr, pc uint64, current, prev processorMode) processorMode {
+	if addr == pc {
+		return current
+	} else if mode, known := d.disasm.modes[addr]; known {
+		return mode
+	} else if mode, known := d.disasm.targets[addr]; known {
+		return mode
+	}
+	return prev
+}
+
+// Decode the instruction at `addr` in the specified mode, returning false if
+// there are no instruction bytes to decode
+func (d *Debugger) decode(addr uint64, mode processorMode) (Disassembly, bool, error) {
+	if entry, found := d.disasm.decoded[addr]; found && entry.mode == mode {
+		return entry.instr, true, nil
+	}
+
+	// Near the end of a mapped region, read as much as remains
+	var code []byte
+	var err error
+	for n := uint64(d.arch.maxInstructionSize()); n > 0; n-- {
+		if code, err = d.ReadMem(addr, n); err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return Disassembly{}, false, nil
+	}
+
+	engine, err := d.arch.disassembler(mode)
+	if err != nil {
+		return Disassembly{}, false, err
+	}
+
+	instrs, err := engine.Dis(code, addr, 1)
+	if err != nil {
+		return Disassembly{}, false, err
+	} else if len(instrs) == 0 {
+		return Disassembly{}, false, nil
+	}
+
+	var entry Disassembly
+	entry.AddressU64 = instrs[0].Addr()
+	entry.Address = fmt.Sprintf("%08x", instrs[0].Addr())
+	entry.Opcode = hex.EncodeToString(instrs[0].Bytes())
+	entry.Mnemonic = instrs[0].Mnemonic()
+	entry.Operands = instrs[0].OpStr()
+	entry.Detail = d.arch.instrDetail(entry, instrs[0].Bytes(), mode)
+
+	if target, targetMode, ok := d.arch.branchTarget(addr, instrs[0].Bytes(), mode); ok {
+		if _, known := d.disasm.targets[target]; !known {
+			d.disasm.targets[target] = targetMode
+		}
+	}
+
+	if d.disasm.cacheable(addr) {
+		d.disasm.decoded[addr] = decodedInstr{mode: mode, instr: entry}
+	}
+
+	return entry, true, nil
+}
@@ -1,10 +1,14 @@
 package aemulari
 
+import "fmt"
+
 // Contains information describing a processor exception
 type Exception struct {
-	intno uint32 // Interrupt/Exception number
-	pc    uint64 // Address at which exception occurred
-	desc  string // Printable string describing the exception
+	intno  uint32 // Interrupt/Exception number
+	pc     uint64 // Address at which exception occurred
+	desc   string // Printable string describing the exception
+	kind   string // Short, architecture-specific name for the exception type
+	signal int    // POSIX signal number most closely describing the exception
 }
 
 // Returns true if the Exception object contains information
@@ -17,3 +21,35 @@ func (e *Exception) Occurred() bool {
 func (e *Exception) String() string {
 	return e.desc
 }
+
+// Return the POSIX signal number that most closely describes the exception
+// (e.g., SIGILL for an undefined instruction), if one occurred.
+// Returns 0 if no exception occurred.
+func (e *Exception) Signal() int {
+	return e.signal
+}
+
+// Return a short, architecture-specific name for the type of exception
+// that occurred (e.g., "bkpt" or "udef" for Arm), or an empty string if no
+// exception occurred.
+func (e *Exception) Kind() string {
+	return e.kind
+}
+
+// Describes an invalid memory access: one to unmapped memory, or one that
+// violates a region's permissions
+type MemFault struct {
+	Access   string // "read", "write", or "fetch"
+	Address  uint64 // Address being accessed
+	Size     int    // Size of the access, in bytes
+	Unmapped bool   // True if the memory is unmapped, false if a permission violation
+}
+
+// Return a string describing the invalid memory access
+func (f MemFault) String() string {
+	why := "protected"
+	if f.Unmapped {
+		why = "unmapped"
+	}
+	return fmt.Sprintf("Invalid %s of %d bytes at 0x%08x (%s)", f.Access, f.Size, f.Address, why)
+}
@@ -0,0 +1,419 @@
+package aemulari
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The result of evaluating an expression
+type ExprValue struct {
+	Value  uint64 // Value, sign-extended to 64 bits if Signed is true
+	Size   uint64 // Size of the value's type, in bytes, or 0 if untyped
+	Signed bool   // The value's type is signed
+}
+
+// Types that may be used in casts and typed dereferences
+var exprTypes = map[string]ExprValue{
+	"u8":  {Size: 1},
+	"u16": {Size: 2},
+	"u32": {Size: 4},
+	"u64": {Size: 8},
+	"i8":  {Size: 1, Signed: true},
+	"i16": {Size: 2, Signed: true},
+	"i32": {Size: 4, Signed: true},
+	"i64": {Size: 8, Signed: true},
+}
+
+// Binary operators, from lowest to highest precedence
+var exprOperators = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// State used to evaluate an expression
+type exprParser struct {
+	dbg    *Debugger
+	expr   string
+	tokens []string
+	pos    int
+}
+
+// Returns a string representation of the value: signed values in decimal,
+// typed values in zero-padded hex, and untyped values in hex if >= 10.
+func (v ExprValue) String() string {
+	if v.Signed {
+		return fmt.Sprintf("%d", int64(v.Value))
+	} else if v.Size > 0 {
+		return fmt.Sprintf("0x%0*x", int(v.Size*2), v.Value)
+	} else if v.Value < 10 {
+		return fmt.Sprintf("%d", v.Value)
+	}
+	return fmt.Sprintf("0x%x", v.Value)
+}
+
+// Truncate the value to the size of its type, sign-extending it if signed
+func (v ExprValue) normalize() ExprValue {
+	if v.Size == 0 || v.Size >= 8 {
+		return v
+	}
+
+	bits := v.Size * 8
+	if v.Signed {
+		v.Value = uint64(int64(v.Value<<(64-bits)) >> (64 - bits))
+	} else {
+		v.Value &= (1 << bits) - 1
+	}
+
+	return v
+}
+
+// Evaluate an expression, consisting of numbers, register names, flags,
+// and symbols, combined via the C operators + - * / % & | ^ ~ << >>.
+// Parentheses group terms, and brackets dereference a pointer-sized value in
+// target memory. A type suffix (u8 ... u64, i8 ... i64) following brackets
+// reads a value of that type instead, as does a C-style cast. For example:
+//
+//	sp+0x20
+//	[sp]
+//	[r4+8]-0x10
+//	[sp+8]:u32
+//	*(u16*)0x20000010
+//	(i8)r0
+//	cpsr.Z
+//	checksum+4
+func (d *Debugger) Evaluate(expr string) (uint64, error) {
+	v, err := d.EvaluateValue(expr)
+	return v.Value, err
+}
+
+// Evaluate an expression (see Evaluate), retaining the type of its result
+func (d *Debugger) EvaluateValue(expr string) (ExprValue, error) {
+	p := exprParser{dbg: d, expr: expr}
+
+	if err := p.tokenize(); err != nil {
+		return ExprValue{}, err
+	} else if len(p.tokens) == 0 {
+		return ExprValue{}, errors.New("Empty expression.")
+	}
+
+	value, err := p.binary(0)
+	if err != nil {
+		return ExprValue{}, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return ExprValue{}, fmt.Errorf("Unexpected \"%s\" in expression: %s", p.tokens[p.pos], expr)
+	}
+
+	return value, nil
+}
+
+// Read a pointer-sized value, in target endianness, from `addr`
+func (d *Debugger) ReadPointer(addr uint64) (uint64, error) {
+	return d.readValue(addr, d.PointerSize())
+}
+
+// Read an unsigned value of `size` bytes, in target endianness, from `addr`
+func (d *Debugger) readValue(addr, size uint64) (uint64, error) {
+	data, err := d.ReadMem(addr, size)
+	if err != nil {
+		return 0, err
+	}
+
+	endianness, err := d.Endianness()
+	if err != nil {
+		return 0, err
+	}
+
+	word := make([]byte, 8)
+	if endianness == BigEndian {
+		copy(word[8-size:], data)
+		return binary.BigEndian.Uint64(word), nil
+	}
+
+	copy(word, data)
+	return binary.LittleEndian.Uint64(word), nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' ||
+		(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Split the expression into operators and operands
+func (p *exprParser) tokenize() error {
+	s := p.expr
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(s[i:], "<<") || strings.HasPrefix(s[i:], ">>"):
+			p.tokens = append(p.tokens, s[i:i+2])
+			i += 2
+		case strings.IndexByte("+-*/%&|^~[]():", c) >= 0:
+			p.tokens = append(p.tokens, s[i:i+1])
+			i++
+		case isIdentChar(c):
+			start := i
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			p.tokens = append(p.tokens, s[start:i])
+		default:
+			return fmt.Errorf("Invalid character '%c' in expression: %s", c, p.expr)
+		}
+	}
+
+	return nil
+}
+
+func (p *exprParser) peek() string {
+	return p.peekAt(0)
+}
+
+func (p *exprParser) peekAt(offset int) string {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset]
+	}
+	return ""
+}
+
+func (p *exprParser) expect(tok string) error {
+	if p.peek() != tok {
+		return fmt.Errorf("Expected \"%s\" in expression: %s", tok, p.expr)
+	}
+	p.pos++
+	return nil
+}
+
+// binary := unary (op unary)*, where op is an operator at or above `level`
+func (p *exprParser) binary(level int) (ExprValue, error) {
+	if level == len(exprOperators) {
+		return p.unary()
+	}
+
+	lhs, err := p.binary(level + 1)
+	if err != nil {
+		return lhs, err
+	}
+
+	for {
+		op := p.peek()
+		if !exprOperator(level, op) {
+			return lhs, nil
+		}
+		p.pos++
+
+		rhs, err := p.binary(level + 1)
+		if err != nil {
+			return rhs, err
+		}
+
+		if lhs, err = p.apply(op, lhs, rhs); err != nil {
+			return lhs, err
+		}
+	}
+}
+
+// Returns true if `tok` is a binary operator at precedence `level`
+func exprOperator(level int, tok string) bool {
+	for _, op := range exprOperators[level] {
+		if tok == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply a binary operator. The result has the larger of the operands' types,
+// and is signed only if both operands are.
+func (p *exprParser) apply(op string, lhs, rhs ExprValue) (ExprValue, error) {
+	result := ExprValue{Size: lhs.Size, Signed: lhs.Signed && rhs.Signed}
+	if rhs.Size > result.Size {
+		result.Size = rhs.Size
+	}
+
+	a, b := lhs.Value, rhs.Value
+
+	switch op {
+	case "|":
+		result.Value = a | b
+	case "^":
+		result.Value = a ^ b
+	case "&":
+		result.Value = a & b
+	case "<<":
+		result.Value = a << b
+	case ">>":
+		if result.Signed {
+			result.Value = uint64(int64(a) >> b)
+		} else {
+			result.Value = a >> b
+		}
+	case "+":
+		result.Value = a + b
+	case "-":
+		result.Value = a - b
+	case "*":
+		result.Value = a * b
+	case "/", "%":
+		if b == 0 {
+			return result, fmt.Errorf("Division by zero in expression: %s", p.expr)
+		}
+
+		if result.Signed && op == "/" {
+			result.Value = uint64(int64(a) / int64(b))
+		} else if result.Signed {
+			result.Value = uint64(int64(a) % int64(b))
+		} else if op == "/" {
+			result.Value = a / b
+		} else {
+			result.Value = a % b
+		}
+	}
+
+	return result.normalize(), nil
+}
+
+// Parse a type name, returning false if `tok` is not one
+func exprType(tok string) (ExprValue, bool) {
+	t, ok := exprTypes[strings.ToLower(tok)]
+	return t, ok
+}
+
+// unary := ('-' | '~' | '*' | '*' '(' type '*' ')' | '(' type ')') unary | operand
+func (p *exprParser) unary() (ExprValue, error) {
+	switch p.peek() {
+	case "-", "~":
+		op := p.peek()
+		p.pos++
+
+		v, err := p.unary()
+		if op == "-" {
+			v.Value = -v.Value
+		} else {
+			v.Value = ^v.Value
+		}
+		return v.normalize(), err
+
+	case "*":
+		p.pos++
+
+		// Typed dereference: *(type*)addr
+		t, typed := exprType(p.peekAt(1))
+		if typed && p.peek() == "(" && p.peekAt(2) == "*" && p.peekAt(3) == ")" {
+			p.pos += 4
+		} else {
+			t = ExprValue{Size: p.dbg.PointerSize()}
+		}
+
+		addr, err := p.unary()
+		if err != nil {
+			return addr, err
+		}
+		return p.deref(addr.Value, t)
+
+	case "(":
+		// Cast: (type)value
+		if t, typed := exprType(p.peekAt(1)); typed && p.peekAt(2) == ")" {
+			p.pos += 3
+
+			v, err := p.unary()
+			t.Value = v.Value
+			return t.normalize(), err
+		}
+	}
+
+	return p.operand()
+}
+
+// Read a value of type `t` from `addr`
+func (p *exprParser) deref(addr uint64, t ExprValue) (ExprValue, error) {
+	value, err := p.dbg.readValue(addr, t.Size)
+	if err != nil {
+		return ExprValue{}, err
+	}
+
+	t.Value = value
+	return t.normalize(), nil
+}
+
+// operand := '(' binary ')' | '[' binary ']' [':' type] | number | register |
+// register.flag | symbol
+func (p *exprParser) operand() (ExprValue, error) {
+	tok := p.peek()
+	if tok == "" {
+		return ExprValue{}, fmt.Errorf("Incomplete expression: %s", p.expr)
+	}
+	p.pos++
+
+	switch tok {
+	case "(":
+		value, err := p.binary(0)
+		if err != nil {
+			return value, err
+		}
+		return value, p.expect(")")
+
+	case "[":
+		addr, err := p.binary(0)
+		if err != nil {
+			return addr, err
+		}
+
+		if err = p.expect("]"); err != nil {
+			return addr, err
+		}
+
+		t := ExprValue{Size: p.dbg.PointerSize()}
+		if p.peek() == ":" {
+			var typed bool
+			if t, typed = exprType(p.peekAt(1)); !typed {
+				return t, fmt.Errorf("Expected a type (e.g., u32) after ':' in expression: %s", p.expr)
+			}
+			p.pos += 2
+		}
+
+		return p.deref(addr.Value, t)
+	}
+
+	if value, err := strconv.ParseUint(tok, 0, 64); err == nil {
+		return ExprValue{Value: value}, nil
+	}
+
+	if reg, err := p.dbg.ReadRegByName(strings.ToLower(tok)); err == nil {
+		return ExprValue{Value: reg.Value, Size: uint64(reg.Size()+7) / 8}, nil
+	}
+
+	if i := strings.Index(tok, "."); i > 0 {
+		if reg, err := p.dbg.ReadRegByName(strings.ToLower(tok[:i])); err == nil {
+			for _, flag := range reg.Flags() {
+				if strings.EqualFold(flag.Name, tok[i+1:]) {
+					return ExprValue{Value: flag.Value}, nil
+				}
+			}
+			return ExprValue{}, fmt.Errorf("No such flag in register %s: %s", reg.Name(), tok[i+1:])
+		}
+	}
+
+	if addr, found := p.dbg.LookupSymbol(tok); found {
+		return ExprValue{Value: addr}, nil
+	}
+
+	return ExprValue{}, fmt.Errorf("\"%s\" is not a number, register, flag, or symbol.", tok)
+}
+
+// Returns the size of a pointer in the emulated architecture, in bytes
+func (d *Debugger) PointerSize() uint64 {
+	return d.arch.callingConvention().wordSize
+}
@@ -0,0 +1,184 @@
+package aemulari
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+type exprTest struct {
+	expr  string
+	value ExprValue
+	valid bool
+}
+
+// Fail unless each expression evaluates to the expected value, or fails to
+// evaluate if it is expected to be invalid
+func expectExprs(t *testing.T, dbg *Debugger, tests []exprTest) {
+	t.Helper()
+
+	for _, test := range tests {
+		value, err := dbg.EvaluateValue(test.expr)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error status: %v", test.expr, err)
+		} else if test.valid && value != test.value {
+			t.Errorf("%s: got %+v, expected %+v", test.expr, value, test.value)
+		}
+	}
+}
+
+// Expressions consisting solely of numbers don't access the target
+func TestEvaluateArithmetic(t *testing.T) {
+	var d Debugger
+	d.syms.initialize()
+
+	expectExprs(t, &d, []exprTest{
+		{"42", ExprValue{Value: 42}, true},
+		{"0x10-1", ExprValue{Value: 15}, true},
+		{"010", ExprValue{Value: 8}, true},
+
+		// Precedence and grouping
+		{"1+2*3", ExprValue{Value: 7}, true},
+		{"(1+2)*3", ExprValue{Value: 9}, true},
+		{"1<<4+1", ExprValue{Value: 0x20}, true},
+		{"1|2^3&4", ExprValue{Value: 3}, true},
+		{"0xff&0xf0>>4", ExprValue{Value: 0xf}, true},
+		{"10/3", ExprValue{Value: 3}, true},
+		{"10%3", ExprValue{Value: 1}, true},
+		{"2*3%4", ExprValue{Value: 2}, true},
+		{"8-2-1", ExprValue{Value: 5}, true},
+
+		// Unary operators
+		{"-1", ExprValue{Value: 0xffffffffffffffff}, true},
+		{"~0", ExprValue{Value: 0xffffffffffffffff}, true},
+		{"-(2-3)", ExprValue{Value: 1}, true},
+
+		// Casts truncate, and sign-extend signed types
+		{"(u8)0x1ff", ExprValue{Value: 0xff, Size: 1}, true},
+		{"(U16)0x12345", ExprValue{Value: 0x2345, Size: 2}, true},
+		{"(i8)0xff", ExprValue{Value: 0xffffffffffffffff, Size: 1, Signed: true}, true},
+		{"(i16)0x7fff", ExprValue{Value: 0x7fff, Size: 2, Signed: true}, true},
+		{"(u8)-1", ExprValue{Value: 0xff, Size: 1}, true},
+		{"~(u8)0", ExprValue{Value: 0xff, Size: 1}, true},
+
+		// Typed results wrap at their size, with the larger operand's type
+		{"(u16)0xffff+1", ExprValue{Value: 0, Size: 2}, true},
+		{"(u8)0xff+(u32)1", ExprValue{Value: 0x100, Size: 4}, true},
+
+		// Signed arithmetic applies only when both operands are signed
+		{"(i8)0x80>>(i8)4", ExprValue{Value: 0xfffffffffffffff8, Size: 1, Signed: true}, true},
+		{"(u8)0x80>>4", ExprValue{Value: 0x08, Size: 1}, true},
+		{"(i32)-7/(i32)2", ExprValue{Value: 0xfffffffffffffffd, Size: 4, Signed: true}, true},
+		{"(i32)-7%(i32)2", ExprValue{Value: 0xffffffffffffffff, Size: 4, Signed: true}, true},
+		{"(u32)-7/2", ExprValue{Value: 0x7ffffffc, Size: 4}, true},
+
+		// Division by zero
+		{"1/0", ExprValue{}, false},
+		{"5%(2-2)", ExprValue{}, false},
+		{"(i32)1/(i32)0", ExprValue{}, false},
+
+		// Syntax errors
+		{"", ExprValue{}, false},
+		{"1+", ExprValue{}, false},
+		{"(1+2", ExprValue{}, false},
+		{"1 2", ExprValue{}, false},
+		{"1)", ExprValue{}, false},
+		{"1 @ 2", ExprValue{}, false},
+		{"(u8)", ExprValue{}, false},
+	})
+}
+
+func TestExprValueString(t *testing.T) {
+	tests := []struct {
+		value    ExprValue
+		expected string
+	}{
+		{ExprValue{Value: 9}, "9"},
+		{ExprValue{Value: 10}, "0xa"},
+		{ExprValue{Value: 1, Size: 4}, "0x00000001"},
+		{ExprValue{Value: 0xff, Size: 1}, "0xff"},
+		{ExprValue{Value: 0xfffffffffffffff0, Size: 2, Signed: true}, "-16"},
+	}
+
+	for _, test := range tests {
+		if s := test.value.String(); s != test.expected {
+			t.Errorf("%+v: got \"%s\", expected \"%s\"", test.value, s, test.expected)
+		}
+	}
+}
+
+// Registers, flags, symbols, and memory, in a Debugger with a data region
+// at 0x20000 and r4 pointing to it
+func TestEvaluateTarget(t *testing.T) {
+	a, err := NewArchitecture("arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem, err := NewMemRegionSet([]string{"code:0x10000:0x1000:rx", "data:0x20000:0x1000:rw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbg, err := NewDebugger(a, DebuggerConfig{Mem: mem})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dbg.Close()
+
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint32(data, 0x12345678)
+	binary.LittleEndian.PutUint32(data[4:], 0xfff0)
+	if err = dbg.WriteMem(0x20000, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = dbg.WriteRegByName("r4", 0x20000); err != nil {
+		t.Fatal(err)
+	}
+
+	// Set the Z flag, leaving the mode unchanged
+	cpsr, err := dbg.ReadRegByName("cpsr")
+	if err != nil {
+		t.Fatal(err)
+	} else if err = dbg.WriteRegByName("cpsr", (cpsr.Value|1<<30)&^(1<<31)); err != nil {
+		t.Fatal(err)
+	}
+
+	dbg.syms.add("buffer", 0x20000)
+
+	expectExprs(t, dbg, []exprTest{
+		// Registers are typed by their size
+		{"r4", ExprValue{Value: 0x20000, Size: 4}, true},
+		{"R4+4", ExprValue{Value: 0x20004, Size: 4}, true},
+		{"(i8)r4", ExprValue{Value: 0, Size: 1, Signed: true}, true},
+
+		// Flags
+		{"cpsr.Z", ExprValue{Value: 1}, true},
+		{"cpsr.n", ExprValue{Value: 0}, true},
+		{"cpsr.X", ExprValue{}, false},
+
+		// Symbols
+		{"buffer", ExprValue{Value: 0x20000}, true},
+		{"buffer+4", ExprValue{Value: 0x20004}, true},
+		{"nosuch", ExprValue{}, false},
+
+		// Pointer-sized dereferences
+		{"[0x20000]", ExprValue{Value: 0x12345678, Size: 4}, true},
+		{"[r4]-0x10", ExprValue{Value: 0x12345668, Size: 4}, true},
+		{"*r4", ExprValue{Value: 0x12345678, Size: 4}, true},
+
+		// Typed dereferences
+		{"[0x20000]:u16", ExprValue{Value: 0x5678, Size: 2}, true},
+		{"[r4+4]:i16", ExprValue{Value: 0xfffffffffffffff0, Size: 2, Signed: true}, true},
+		{"[buffer+4]:i8", ExprValue{Value: 0xfffffffffffffff0, Size: 1, Signed: true}, true},
+		{"[r4]:u8+1", ExprValue{Value: 0x79, Size: 1}, true},
+		{"*(u8*)0x20001", ExprValue{Value: 0x56, Size: 1}, true},
+		{"*(i32*)(r4+4)", ExprValue{Value: 0xfff0, Size: 4, Signed: true}, true},
+		{"[r4]:x", ExprValue{}, false},
+		{"[r4", ExprValue{}, false},
+
+		// Unmapped memory
+		{"[0x90000]", ExprValue{}, false},
+		{"*(u8*)0x90000", ExprValue{}, false},
+	})
+}
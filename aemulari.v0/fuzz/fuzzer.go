@@ -0,0 +1,331 @@
+package fuzz
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Fuzzer configuration
+type FuzzerConfig struct {
+	CorpusDir  string // Directory of seed inputs. Inputs yielding new coverage are added to it.
+	CrashDir   string // Directory to which crashing and hanging inputs are saved
+	Iterations uint64 // Number of inputs to execute, or 0 to run until Stop() is called
+	Seed       int64  // Random number generator seed
+
+	Log           io.Writer     // Destination of status messages, or nil
+	StatsInterval time.Duration // Time between status messages
+}
+
+// Fuzzing statistics
+type Stats struct {
+	Executions    uint64
+	Crashes       uint64 // Total crashing inputs
+	UniqueCrashes uint64 // Crashes with a distinct stop reason and PC
+	Hangs         uint64
+	Corpus        int // Number of inputs in the corpus
+	Blocks        int // Number of distinct basic blocks executed
+	Elapsed       time.Duration
+}
+
+// A simple coverage-guided, mutational fuzzer
+type Fuzzer struct {
+	h       *Harness
+	cfg     FuzzerConfig
+	rng     *rand.Rand
+	corpus  [][]byte
+	crashes map[string]bool // Crash signatures already saved
+	stats   Stats
+	start   time.Time
+	stop    int32
+}
+
+// Values that commonly trigger edge cases
+var interesting = []uint64{
+	0, 1, 0x7f, 0x80, 0xff, 0x100, 0x7fff, 0x8000, 0xffff,
+	0x10000, 0x7fffffff, 0x80000000, 0xffffffff,
+}
+
+// Create a Fuzzer that executes inputs via the provided Harness, seeding its
+// corpus from the files in cfg.CorpusDir.
+func NewFuzzer(h *Harness, cfg FuzzerConfig) (*Fuzzer, error) {
+	f := &Fuzzer{
+		h:       h,
+		cfg:     cfg,
+		rng:     rand.New(rand.NewSource(cfg.Seed)),
+		crashes: make(map[string]bool),
+	}
+
+	if f.cfg.StatsInterval == 0 {
+		f.cfg.StatsInterval = 5 * time.Second
+	}
+
+	if cfg.CrashDir != "" {
+		if err := os.MkdirAll(cfg.CrashDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.CorpusDir != "" {
+		entries, err := ioutil.ReadDir(cfg.CorpusDir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		for _, e := range entries {
+			if !e.Mode().IsRegular() {
+				continue
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(cfg.CorpusDir, e.Name()))
+			if err != nil {
+				return nil, err
+			}
+			f.corpus = append(f.corpus, data)
+		}
+	}
+
+	if len(f.corpus) == 0 {
+		f.corpus = append(f.corpus, make([]byte, 4))
+	}
+
+	return f, nil
+}
+
+// Stop a Fuzzer started via Run(). This may be called from another
+// goroutine, such as a signal handler. An input currently being executed is
+// permitted to complete, so the Debugger should also be interrupted in order
+// to stop a hang promptly.
+func (f *Fuzzer) Stop() {
+	atomic.StoreInt32(&f.stop, 1)
+}
+
+func (f *Fuzzer) stopped() bool {
+	return atomic.LoadInt32(&f.stop) != 0
+}
+
+// Returns the current fuzzing statistics
+func (f *Fuzzer) Stats() Stats {
+	s := f.stats
+	s.Corpus = len(f.corpus)
+	s.Blocks = f.h.Blocks()
+	s.Elapsed = time.Since(f.start)
+	return s
+}
+
+// Return a human-readable summary of fuzzing statistics
+func (s Stats) String() string {
+	rate := float64(s.Executions) / s.Elapsed.Seconds()
+	return fmt.Sprintf("execs: %d (%.0f/s), corpus: %d, blocks: %d, crashes: %d (%d unique), hangs: %d",
+		s.Executions, rate, s.Corpus, s.Blocks, s.Crashes, s.UniqueCrashes, s.Hangs)
+}
+
+func (f *Fuzzer) log(format string, args ...interface{}) {
+	if f.cfg.Log != nil {
+		fmt.Fprintf(f.cfg.Log, format+"\n", args...)
+	}
+}
+
+// Execute the seed corpus and then mutated inputs, until the configured
+// number of iterations has completed or Stop() is called.
+func (f *Fuzzer) Run() error {
+	f.start = time.Now()
+	lastStats := f.start
+
+	// Seeds establish the initial coverage
+	seeds := f.corpus
+	f.corpus = nil
+	for _, input := range seeds {
+		if err := f.execute(input, true); err != nil {
+			return err
+		}
+	}
+
+	// Mutate crashing seeds if there is nothing else to work with
+	if len(f.corpus) == 0 {
+		f.corpus = seeds
+	}
+
+	for i := uint64(0); !f.stopped(); i++ {
+		if f.cfg.Iterations != 0 && i >= f.cfg.Iterations {
+			break
+		}
+
+		if err := f.execute(f.mutate(), false); err != nil {
+			return err
+		}
+
+		if time.Since(lastStats) >= f.cfg.StatsInterval {
+			f.log("%s", f.Stats())
+			lastStats = time.Now()
+		}
+	}
+
+	f.log("%s", f.Stats())
+	return nil
+}
+
+// Execute a single input, recording it if it crashes, hangs, or yields new
+// coverage. Seed inputs are always retained in the corpus.
+func (f *Fuzzer) execute(input []byte, seed bool) error {
+	result, err := f.h.Run(input)
+	if err != nil {
+		return err
+	}
+
+	f.stats.Executions++
+
+	switch result.Outcome {
+	case Crash:
+		f.stats.Crashes++
+		return f.saveCrash(input, result)
+
+	case Hang:
+		f.stats.Hangs++
+		return f.saveHang(input)
+	}
+
+	if seed || result.NewBlocks > 0 {
+		f.corpus = append(f.corpus, input)
+		if !seed {
+			f.log("New coverage: %d block(s), input of %d bytes", result.NewBlocks, len(input))
+			return f.saveInput(f.cfg.CorpusDir, "", input)
+		}
+	}
+
+	return nil
+}
+
+// Write `input` to <dir>/<prefix><sha1 of input>.bin, returning the path
+// without its extension.
+func (f *Fuzzer) writeInput(dir, prefix string, input []byte) (string, error) {
+	sum := sha1.Sum(input)
+	base := filepath.Join(dir, prefix+hex.EncodeToString(sum[:]))
+	return base, ioutil.WriteFile(base+".bin", input, 0644)
+}
+
+func (f *Fuzzer) saveInput(dir, prefix string, input []byte) error {
+	if dir == "" {
+		return nil
+	}
+	_, err := f.writeInput(dir, prefix, input)
+	return err
+}
+
+// Save a crashing input, a description of the crash, and a trace of the
+// instructions executed. Crashes with the same stop reason and PC as one
+// previously saved are counted, but not saved.
+func (f *Fuzzer) saveCrash(input []byte, result Result) error {
+	signature := fmt.Sprintf("%s@%x", result.Reason, result.PC)
+	if f.crashes[signature] {
+		return nil
+	}
+
+	f.crashes[signature] = true
+	f.stats.UniqueCrashes++
+	f.log("Crash: %s at pc=0x%08x", result.Description, result.PC)
+
+	if f.cfg.CrashDir == "" {
+		return nil
+	}
+
+	base, err := f.writeInput(f.cfg.CrashDir, "crash-", input)
+	if err != nil {
+		return err
+	}
+
+	var trace bytes.Buffer
+	if _, err = f.h.RunWithTrace(input, &trace); err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(base+".trace", trace.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	desc := fmt.Sprintf("%s\nStop reason: %s\nPC: 0x%08x\nInstructions: %d\n",
+		result.Description, result.Reason, result.PC, result.Instructions)
+
+	return ioutil.WriteFile(base+".txt", []byte(desc), 0644)
+}
+
+func (f *Fuzzer) saveHang(input []byte) error {
+	return f.saveInput(f.cfg.CrashDir, "hang-", input)
+}
+
+// Return a new input derived from one or more corpus entries
+func (f *Fuzzer) mutate() []byte {
+	parent := f.corpus[f.rng.Intn(len(f.corpus))]
+	input := append([]byte{}, parent...)
+
+	// Stack several mutations
+	n := 1 << uint(f.rng.Intn(4))
+	for i := 0; i < n; i++ {
+		input = f.mutateOnce(input)
+	}
+
+	if uint64(len(input)) > f.h.cfg.MaxLen {
+		input = input[:f.h.cfg.MaxLen]
+	}
+
+	return input
+}
+
+func (f *Fuzzer) mutateOnce(input []byte) []byte {
+	if len(input) == 0 {
+		return append(input, byte(f.rng.Intn(256)))
+	}
+
+	pos := f.rng.Intn(len(input))
+
+	switch f.rng.Intn(7) {
+	case 0: // Flip a bit
+		input[pos] ^= 1 << uint(f.rng.Intn(8))
+
+	case 1: // Replace a byte
+		input[pos] = byte(f.rng.Intn(256))
+
+	case 2: // Add or subtract a small value
+		input[pos] += byte(f.rng.Intn(35) - 17)
+
+	case 3: // Write an interesting value as a 1, 2, or 4-byte integer
+		value := interesting[f.rng.Intn(len(interesting))]
+		word := make([]byte, 8)
+		binary.LittleEndian.PutUint64(word, value)
+		width := 1 << uint(f.rng.Intn(3))
+		if f.rng.Intn(2) == 0 {
+			binary.BigEndian.PutUint32(word, uint32(value))
+			copy(input[pos:], word[4-width:4])
+		} else {
+			copy(input[pos:], word[:width])
+		}
+
+	case 4: // Insert random bytes
+		count := 1 + f.rng.Intn(8)
+		ins := make([]byte, count)
+		f.rng.Read(ins)
+		input = append(input[:pos], append(ins, input[pos:]...)...)
+
+	case 5: // Delete bytes
+		count := 1 + f.rng.Intn(len(input)-pos)
+		input = append(input[:pos], input[pos+count:]...)
+
+	case 6: // Splice in part of another corpus entry
+		other := f.corpus[f.rng.Intn(len(f.corpus))]
+		if len(other) > 0 {
+			start := f.rng.Intn(len(other))
+			input = append(input[:pos], other[start:]...)
+		}
+	}
+
+	return input
+}
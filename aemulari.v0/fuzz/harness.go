@@ -0,0 +1,233 @@
+// Package fuzz runs code within a Debugger against many inputs, detecting
+// crashes (processor exceptions and invalid memory accesses) and hangs
+// (exhaustion of an instruction budget), and using basic block coverage as
+// feedback.
+//
+// A Harness executes a single input at a time, restoring the Debugger's
+// state beforehand. It may be driven by the simple mutational Fuzzer in
+// this package, or by Go's native fuzzing support:
+//
+//	func FuzzParser(f *testing.F) {
+//		arch, _ := ae.NewArchitecture("arm")
+//		mem, _ := ae.NewMemRegionSet([]string{
+//			"code:0x10000:0x8000:rx:firmware.bin",
+//			"data:0x20000000:0x1000:rw",
+//		})
+//		dbg, _ := ae.NewDebugger(arch, ae.DebuggerConfig{Mem: mem})
+//
+//		h, err := fuzz.NewHarness(dbg, fuzz.Config{
+//			InputAddr: 0x20000000,
+//			MaxLen:    0x1000,
+//			Budget:    100000,
+//			CallAddr:  0x10230,
+//			Args: func(input, length uint64) []uint64 {
+//				return []uint64{input, length}
+//			},
+//		})
+//		if err != nil {
+//			f.Fatal(err)
+//		}
+//
+//		f.Add([]byte("seed input"))
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			r, err := h.Run(data)
+//			if err != nil {
+//				t.Fatal(err)
+//			} else if r.Outcome == fuzz.Crash {
+//				t.Fatalf("%s at pc=0x%08x", r.Description, r.PC)
+//			}
+//		})
+//	}
+//
+// Note that Go's fuzzing engine is guided by coverage of Go code, and is
+// unaware of the coverage of emulated code reported by Result.NewBlocks.
+package fuzz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	ae "../../aemulari.v0"
+)
+
+// Harness configuration
+type Config struct {
+	InputAddr uint64 // Address at which each input is written
+	MaxLen    uint64 // Maximum input length. Longer inputs are truncated.
+	LengthReg string // Register that receives the input length, if non-empty
+	Budget    uint64 // Maximum instructions executed per input, or 0 for no limit
+
+	// If Args is non-nil, the function at CallAddr is called for each input
+	// with the arguments it returns, given the input's address and length.
+	// Otherwise, execution continues from the PC at which the Harness was
+	// created.
+	CallAddr uint64
+	Args     func(input, length uint64) []uint64
+}
+
+// Outcome of executing a single input
+type Outcome int
+
+const (
+	Ok    Outcome = iota // Execution completed without incident
+	Crash                // A processor exception or invalid memory access occurred
+	Hang                 // The instruction budget was exhausted
+)
+
+var outcomeStrings = map[Outcome]string{
+	Ok:    "ok",
+	Crash: "crash",
+	Hang:  "hang",
+}
+
+// Return a short, lowercase name for the Outcome
+func (o Outcome) String() string {
+	return outcomeStrings[o]
+}
+
+// The result of executing a single input
+type Result struct {
+	Outcome      Outcome
+	Reason       ae.StopReason // Why execution stopped
+	PC           uint64        // PC when execution stopped
+	Description  string        // Description of the exception or fault, if any
+	NewBlocks    int           // Number of basic blocks executed for the first time
+	Instructions uint64        // Number of instructions executed
+}
+
+// Executes inputs within a Debugger
+type Harness struct {
+	dbg  *ae.Debugger
+	cfg  Config
+	snap *ae.Snapshot
+	seen map[uint64]bool // Basic blocks executed by any input
+}
+
+// Create a Harness that executes inputs from the Debugger's current state.
+// Coverage collection is enabled, and any coverage previously collected is
+// discarded.
+func NewHarness(dbg *ae.Debugger, cfg Config) (*Harness, error) {
+	var err error
+
+	if cfg.MaxLen == 0 {
+		return nil, errors.New("The maximum input length must be non-zero.")
+	}
+
+	// Ensure inputs may be written
+	if _, err = dbg.ReadMem(cfg.InputAddr, cfg.MaxLen); err != nil {
+		return nil, fmt.Errorf("Input buffer at 0x%08x (0x%x bytes) is not mapped.",
+			cfg.InputAddr, cfg.MaxLen)
+	}
+
+	if cfg.LengthReg != "" {
+		if _, err = dbg.ReadRegByName(cfg.LengthReg); err != nil {
+			return nil, err
+		}
+	}
+
+	h := &Harness{dbg: dbg, cfg: cfg, seen: make(map[uint64]bool)}
+
+	if h.snap, err = dbg.Snapshot(); err != nil {
+		return nil, err
+	}
+
+	// Backtraces aren't needed, so skip the per-instruction bookkeeping
+	dbg.SetCallTracking(false)
+	dbg.SetInstructionBudget(cfg.Budget)
+	dbg.ResetCoverage()
+	dbg.StartCoverage()
+
+	return h, nil
+}
+
+// Returns the number of distinct basic blocks executed by all inputs
+func (h *Harness) Blocks() int {
+	return len(h.seen)
+}
+
+// Execute a single input. A non-nil error indicates that the input could
+// not be executed, rather than a crash.
+func (h *Harness) Run(input []byte) (Result, error) {
+	var result Result
+	var exception ae.Exception
+	var err error
+
+	if err = h.dbg.Restore(h.snap); err != nil {
+		return result, err
+	}
+
+	if uint64(len(input)) > h.cfg.MaxLen {
+		input = input[:h.cfg.MaxLen]
+	}
+
+	if err = h.dbg.WriteMem(h.cfg.InputAddr, input); err != nil {
+		return result, err
+	}
+
+	if h.cfg.LengthReg != "" {
+		if err = h.dbg.WriteRegByName(h.cfg.LengthReg, uint64(len(input))); err != nil {
+			return result, err
+		}
+	}
+
+	h.dbg.ResetCoverage()
+	start := h.dbg.InstructionCount()
+
+	if h.cfg.Args != nil {
+		var call ae.CallResult
+		call, err = h.dbg.Call(h.cfg.CallAddr, h.cfg.Args(h.cfg.InputAddr, uint64(len(input)))...)
+		exception = call.Exception
+	} else {
+		exception, err = h.dbg.Continue()
+	}
+
+	result.Reason = h.dbg.StopReason()
+	result.Instructions = h.dbg.InstructionCount() - start
+
+	switch result.Reason {
+	case ae.StopException:
+		result.Outcome = Crash
+		result.Description = exception.String()
+	case ae.StopMemoryFault:
+		fault, _ := h.dbg.MemoryFault()
+		result.Outcome = Crash
+		result.Description = fault.String()
+		err = nil
+	case ae.StopBudget:
+		result.Outcome = Hang
+		result.Description = fmt.Sprintf("Exceeded the budget of %d instructions", h.cfg.Budget)
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	if pc, err := h.dbg.ReadRegByName("pc"); err == nil {
+		result.PC = pc.Value
+	}
+
+	for _, b := range h.dbg.Coverage() {
+		if !h.seen[b.Address] {
+			h.seen[b.Address] = true
+			result.NewBlocks++
+		}
+	}
+
+	return result, nil
+}
+
+// Execute a single input, as per Run(), while writing a trace of the
+// instructions executed to `w`.
+func (h *Harness) RunWithTrace(input []byte, w io.Writer) (Result, error) {
+	if err := h.dbg.StartTrace(ae.TraceConfig{Output: w, Format: ae.TraceText}); err != nil {
+		return Result{}, err
+	}
+
+	result, err := h.Run(input)
+	if traceErr := h.dbg.StopTrace(); err == nil {
+		err = traceErr
+	}
+
+	return result, err
+}
@@ -0,0 +1,164 @@
+package aemulari
+
+import (
+	"errors"
+	"fmt"
+
+	uc "github.com/unicorn-engine/unicorn/bindings/go/unicorn"
+)
+
+// Invoked when an enabled breakpoint is hit. Return true to halt execution
+// at the breakpoint, or false to continue executing.
+//
+// The callback may read and write registers and memory, but must not call
+// Step() or Continue().
+type BreakpointCallback func(d *Debugger, bp Breakpoint) bool
+
+// Types of memory accesses that may be hooked
+type MemAccessType int
+
+const (
+	MemAccessRead  MemAccessType = 1 << iota // Invoked before a value is read
+	MemAccessWrite                           // Invoked before a value is written
+
+	MemAccessReadWrite = MemAccessRead | MemAccessWrite
+)
+
+// Return the MemAccessType associated with "r", "w", or "rw"
+func ParseMemAccessType(s string) (MemAccessType, error) {
+	switch s {
+	case "r", "read":
+		return MemAccessRead, nil
+	case "w", "write":
+		return MemAccessWrite, nil
+	case "rw", "readwrite":
+		return MemAccessReadWrite, nil
+	default:
+		return 0, fmt.Errorf("Invalid memory access type: %s", s)
+	}
+}
+
+// Describes a memory access observed by a MemoryCallback
+type MemAccess struct {
+	Type    MemAccessType // Either MemAccessRead or MemAccessWrite
+	Address uint64        // Address being accessed
+	Size    int           // Size of the access, in bytes
+	Value   uint64        // Value being written. Always 0 for reads.
+}
+
+// Invoked when a hooked memory range is accessed. A read hook may write
+// to memory at the accessed address to control the value that is read,
+// allowing the behavior of peripherals to be emulated.
+//
+// The callback may read and write registers and memory, but must not call
+// Step() or Continue().
+type MemoryCallback func(d *Debugger, access MemAccess)
+
+// A memory hook registered via AddMemoryHook(). These are retained across
+// resets of the Debugger.
+type memoryHook struct {
+	id         int
+	accessType MemAccessType
+	start, end uint64 // Inclusive range of addresses
+	cb         MemoryCallback
+
+	dbg  *Debugger
+	hook uc.Hook
+}
+
+// Set (or clear, if `cb` is nil) the callback invoked when the breakpoint
+// with the specified ID is hit.
+func (d *Debugger) SetBreakpointCallback(id int, cb BreakpointCallback) error {
+	bp, found := d.bps.byID[id]
+	if !found {
+		return fmt.Errorf("No breakpoint with ID %d", id)
+	}
+
+	bp.callback = cb
+	return nil
+}
+
+// Invoke `cb` whenever memory in the range [start, start + size) is accessed
+// as specified by `accessType`. Returns an ID that may be used to remove the
+// hook via RemoveMemoryHook().
+func (d *Debugger) AddMemoryHook(accessType MemAccessType, start, size uint64, cb MemoryCallback) (int, error) {
+	if size == 0 {
+		return 0, errors.New("Memory hook size must be non-zero.")
+	} else if accessType&MemAccessReadWrite == 0 {
+		return 0, errors.New("Invalid memory hook access type.")
+	}
+
+	d.nextMemHookID++
+	h := &memoryHook{
+		id:         d.nextMemHookID,
+		accessType: accessType,
+		start:      start,
+		end:        start + size - 1,
+		cb:         cb,
+		dbg:        d,
+	}
+
+	if err := h.install(); err != nil {
+		return 0, err
+	}
+
+	d.memHooks = append(d.memHooks, h)
+	return h.id, nil
+}
+
+// Remove a memory hook previously added via AddMemoryHook()
+func (d *Debugger) RemoveMemoryHook(id int) error {
+	for i, h := range d.memHooks {
+		if h.id == id {
+			d.memHooks = append(d.memHooks[:i], d.memHooks[i+1:]...)
+			return d.mu.HookDel(h.hook)
+		}
+	}
+
+	return fmt.Errorf("No memory hook with ID %d", id)
+}
+
+// Remove all memory hooks
+func (d *Debugger) RemoveAllMemoryHooks() error {
+	var ret error
+
+	for _, h := range d.memHooks {
+		if err := d.mu.HookDel(h.hook); err != nil && ret == nil {
+			ret = err
+		}
+	}
+
+	d.memHooks = nil
+	return ret
+}
+
+// Install the hook in the current Unicorn instance
+func (h *memoryHook) install() error {
+	var htype int
+	var err error
+
+	if h.accessType&MemAccessRead != 0 {
+		htype |= uc.HOOK_MEM_READ
+	}
+
+	if h.accessType&MemAccessWrite != 0 {
+		htype |= uc.HOOK_MEM_WRITE
+	}
+
+	h.hook, err = h.dbg.mu.HookAdd(htype, h.memCb, h.start, h.end)
+	return err
+}
+
+// Memory access callback
+func (h *memoryHook) memCb(mu uc.Unicorn, access int, addr uint64, size int, value int64) {
+	a := MemAccess{Address: addr, Size: size}
+
+	if access == uc.MEM_WRITE {
+		a.Type = MemAccessWrite
+		a.Value = uint64(value)
+	} else {
+		a.Type = MemAccessRead
+	}
+
+	h.cb(h.dbg, a)
+}
@@ -0,0 +1,88 @@
+package aemulari
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types
+const (
+	ihexData                   = 0x00
+	ihexEndOfFile              = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+// Load Intel HEX records from `r` into `data`, which represents memory
+// starting at address `base`. Data outside of this range is an error.
+func loadIntelHex(r io.Reader, base uint64, data []byte) error {
+	var upper uint64 // Upper address bits from extended address records
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if line[0] != ':' {
+			return fmt.Errorf("Intel HEX line %d: Missing start code", lineNum)
+		}
+
+		rec, err := hex.DecodeString(line[1:])
+		if err != nil || len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return fmt.Errorf("Intel HEX line %d: Malformed record", lineNum)
+		}
+
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+
+		if sum != 0 {
+			return fmt.Errorf("Intel HEX line %d: Invalid checksum", lineNum)
+		}
+
+		count := int(rec[0])
+		offset := uint64(rec[1])<<8 | uint64(rec[2])
+		payload := rec[4 : 4+count]
+
+		switch rec[3] {
+		case ihexData:
+			addr := upper + offset
+			if addr < base || addr+uint64(count) > base+uint64(len(data)) {
+				return fmt.Errorf("Intel HEX line %d: Data at 0x%08x is outside of the memory region",
+					lineNum, addr)
+			}
+			copy(data[addr-base:], payload)
+
+		case ihexEndOfFile:
+			return nil
+
+		case ihexExtendedSegmentAddress:
+			if count != 2 {
+				return fmt.Errorf("Intel HEX line %d: Malformed record", lineNum)
+			}
+			upper = (uint64(payload[0])<<8 | uint64(payload[1])) << 4
+
+		case ihexExtendedLinearAddress:
+			if count != 2 {
+				return fmt.Errorf("Intel HEX line %d: Malformed record", lineNum)
+			}
+			upper = (uint64(payload[0])<<8 | uint64(payload[1])) << 16
+
+		case ihexStartSegmentAddress, ihexStartLinearAddress:
+			// Entry point; the initial PC is configured separately.
+
+		default:
+			return fmt.Errorf("Intel HEX line %d: Unsupported record type 0x%02x", lineNum, rec[3])
+		}
+	}
+
+	return scanner.Err()
+}
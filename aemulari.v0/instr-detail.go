@@ -0,0 +1,146 @@
+package aemulari
+
+import (
+	"errors"
+)
+
+// Structured details of a disassembled instruction. These are derived from
+// the instruction's encoding and disassembly, and are best-effort for less
+// common instructions. Condition flag updates aren't included.
+type InstrDetail struct {
+	RegsRead    []string     // Registers read, by canonical name (e.g., "r11", not "fp")
+	RegsWritten []string     // Registers written, by canonical name
+	Mem         []MemOperand // Memory operands
+	Condition   string       // Condition code (e.g., "eq"), or "" if unconditional
+	Branch      bool         // The instruction may change the flow of execution
+	Target      uint64       // Branch target, if HasTarget is true
+	HasTarget   bool         // The branch target is encoded in the instruction
+	TargetReg   string       // Register holding the branch target, if any
+}
+
+// A memory operand, accessed at Base + Index << Shift + Disp
+// (or Base - (Index << Shift) + Disp, if Subtract is true)
+type MemOperand struct {
+	Base      string // Base register
+	Index     string // Index register, or "" if none
+	Shift     uint   // Left shift applied to the index register
+	Subtract  bool   // The index is subtracted, rather than added
+	Disp      int64  // Displacement
+	Size      uint64 // Number of bytes accessed
+	Write     bool   // Memory is written, rather than read
+	PostIndex bool   // Memory is accessed at Base; the offset is applied afterwards
+	Writeback bool   // The Base register is updated with the offset applied
+
+	pc uint64 // Value read from the PC when used as Base
+}
+
+// A memory access that the instruction at the PC is expected to perform
+type MemPreview struct {
+	Operand  MemOperand
+	Address  uint64 // Effective address
+	Value    uint64 // Value currently at Address, if Readable is true
+	Readable bool
+}
+
+// The expected effect of executing the instruction at the PC
+type InstrPreview struct {
+	Instr     Disassembly
+	Condition string       // Condition in effect, including any imposed by processor state
+	Executes  bool         // The condition passes, given the current flags
+	Accesses  []MemPreview // Memory accessed
+	Target    uint64       // Branch target, if HasTarget is true
+	HasTarget bool
+}
+
+// Compute the effective address of a memory operand from current register values
+func (d *Debugger) EffectiveAddress(m MemOperand) (uint64, error) {
+	var base, index uint64
+
+	if m.Base == "pc" {
+		base = m.pc
+	} else if reg, err := d.ReadRegByName(m.Base); err != nil {
+		return 0, err
+	} else {
+		base = reg.Value
+	}
+
+	if m.PostIndex {
+		return base, nil
+	}
+
+	if m.Index != "" {
+		reg, err := d.ReadRegByName(m.Index)
+		if err != nil {
+			return 0, err
+		}
+		index = reg.Value << m.Shift
+	}
+
+	if m.Subtract {
+		index = -index
+	}
+
+	addr := base + index + uint64(m.Disp)
+	if d.PointerSize() < 8 {
+		addr &= 1<<(d.PointerSize()*8) - 1
+	}
+	return addr, nil
+}
+
+// Describe the expected effect of executing the instruction at the PC:
+// whether its condition passes, the memory it will access, and where it
+// will branch to.
+func (d *Debugger) PreviewInstruction() (InstrPreview, error) {
+	var p InstrPreview
+
+	instrs, err := d.Disassemble(1)
+	if err != nil {
+		return p, err
+	} else if len(instrs) == 0 {
+		return p, errors.New("Failed to disassemble the instruction at the PC.")
+	}
+	p.Instr = instrs[0]
+	detail := p.Instr.Detail
+
+	regs, err := d.ReadRegAll()
+	if err != nil {
+		return p, err
+	}
+
+	p.Condition = detail.Condition
+	if p.Condition == "" {
+		p.Condition = d.arch.pendingCondition(regs)
+	}
+	p.Executes = p.Condition == "" || d.arch.conditionPasses(p.Condition, regs)
+
+	for _, m := range detail.Mem {
+		addr, err := d.EffectiveAddress(m)
+		if err != nil {
+			return p, err
+		}
+
+		access := MemPreview{Operand: m, Address: addr}
+
+		size := m.Size
+		if size > d.PointerSize() {
+			size = d.PointerSize()
+		}
+
+		if value, err := d.readValue(addr, size); err == nil {
+			access.Value = value
+			access.Readable = true
+		}
+
+		p.Accesses = append(p.Accesses, access)
+	}
+
+	if detail.HasTarget {
+		p.Target, p.HasTarget = detail.Target, true
+	} else if detail.TargetReg != "" {
+		if reg, err := d.ReadRegByName(detail.TargetReg); err == nil {
+			p.Target, p.HasTarget = reg.Value, true
+		}
+	}
+
+	return p, nil
+}
@@ -23,12 +23,43 @@ type MemRegion struct {
 	// should just be zeroized.
 	inputFile string
 
+	inputOffset uint64      // Offset into a raw input file at which data begins
+	inputFormat InputFormat // Format of the input file
+
 	// Path to a file to write the contents of a memory region when it is
 	// unmapped. An empty string may be used to denote that the data shouldn't
 	// be written.
 	outputFile string
 }
 
+// Format of a file used to initialize a memory region
+type InputFormat int
+
+const (
+	InputRaw      InputFormat = iota // Raw binary data
+	InputIntelHex                    // Intel HEX records, with absolute addresses
+)
+
+// Return the InputFormat associated with the name "raw" or "ihex"
+func ParseInputFormat(s string) (InputFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "raw", "bin", "":
+		return InputRaw, nil
+	case "ihex", "hex":
+		return InputIntelHex, nil
+	default:
+		return InputRaw, fmt.Errorf("Invalid input file format: %s", s)
+	}
+}
+
+// Returns the name of the InputFormat, as accepted by ParseInputFormat()
+func (f InputFormat) String() string {
+	if f == InputIntelHex {
+		return "ihex"
+	}
+	return "raw"
+}
+
 // Returns the name of a region
 func (r MemRegion) Name() string {
 	return r.name
@@ -60,6 +91,30 @@ func (r MemRegion) String() string {
 	return ret
 }
 
+// Returns the path of the region's input file, the offset into the file at
+// which its data begins, and the file's format
+func (r MemRegion) InputFile() (string, uint64, InputFormat) {
+	return r.inputFile, r.inputOffset, r.inputFormat
+}
+
+// Returns the path of the region's output file
+func (r MemRegion) OutputFile() string {
+	return r.outputFile
+}
+
+// Configure how the region's input file is loaded. For raw binary files,
+// data is read starting at `offset`. Intel HEX files contain absolute
+// addresses, so `offset` must be zero.
+func (r *MemRegion) SetInputOptions(offset uint64, format InputFormat) error {
+	if format == InputIntelHex && offset != 0 {
+		return fmt.Errorf("Memory region \"%s\": An offset may not be used with Intel HEX input.", r.name)
+	}
+
+	r.inputOffset = offset
+	r.inputFormat = format
+	return nil
+}
+
 // Returns true if the memory region has an input initialization file,
 // and false otherwise
 func (r MemRegion) HasInputFile() bool {
@@ -83,11 +138,16 @@ func (r *MemRegion) LoadInputData() ([]byte, error) {
 		if err != nil {
 			return r.loadError(err)
 		}
+		defer f.Close()
 
-		// TODO Allow this to be specified in the memory specifier syntax
-		offset := int64(0)
+		if r.inputFormat == InputIntelHex {
+			if err = loadIntelHex(f, r.base, data); err != nil {
+				return r.loadError(err)
+			}
+			return data, nil
+		}
 
-		_, err = f.Seek(offset, 0)
+		_, err = f.Seek(int64(r.inputOffset), 0)
 		if err != nil {
 			return r.loadError(err)
 		}
@@ -153,41 +213,60 @@ func (r MemRegion) IsValid() (bool, error) {
 //	<name>:<addr>:<size>:[permissions]:[input file]:[output_file]
 func NewMemRegion(s string) (region MemRegion, err error) {
 	var fields []string
+	var base, size uint64
+	var perms, inputFile, outputFile string
 
 	if fields = strings.Split(s, ":"); len(fields) < 3 {
 		err = errors.New("MemRegion requires at least 3 fields.")
 		return
 	}
 
-	region.name = fields[0]
-
-	if region.base, err = strconv.ParseUint(fields[1], 0, 64); err != nil {
+	if base, err = strconv.ParseUint(fields[1], 0, 64); err != nil {
 		err = fmt.Errorf("Invalid memory region base address: %s", fields[1])
 		return
 	}
 
-	if region.size, err = strconv.ParseUint(fields[2], 0, 64); err != nil || region.size == 0 {
+	if size, err = strconv.ParseUint(fields[2], 0, 64); err != nil {
 		err = fmt.Errorf("Invalid memory region size: %s", fields[2])
 		return
 	}
 
 	if len(fields) > 3 {
-		if err = region.perms.Set(fields[3]); err != nil {
-			return
-		}
+		perms = fields[3]
 	} else {
 		// Default to something very permissive and easy to work with
-		region.perms.Set("rwx")
+		perms = "rwx"
 	}
 
 	if len(fields) > 4 {
-		region.inputFile = fields[4]
+		inputFile = fields[4]
 	}
 
 	if len(fields) > 5 {
-		region.outputFile = fields[5]
+		outputFile = fields[5]
+	}
+
+	return NewMemRegionFromFields(fields[0], base, size, perms, inputFile, outputFile)
+}
+
+// Create a memory region from its individual attributes, as described by
+// NewMemRegion().
+func NewMemRegionFromFields(name string, base, size uint64, perms, inputFile, outputFile string) (region MemRegion, err error) {
+	region.name = name
+	region.base = base
+
+	if region.size = size; size == 0 {
+		err = fmt.Errorf("Invalid memory region size: %d", size)
+		return
 	}
 
+	if err = region.perms.Set(perms); err != nil {
+		return
+	}
+
+	region.inputFile = inputFile
+	region.outputFile = outputFile
+
 	_, err = region.IsValid()
 	return
 }
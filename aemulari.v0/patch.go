@@ -0,0 +1,341 @@
+package aemulari
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A modification of memory made via PatchBytes() or PatchAsm()
+type Patch struct {
+	ID       int
+	Address  uint64
+	Original []byte // Memory contents prior to the patch
+	Bytes    []byte // Memory contents written by the patch
+	Source   string // Assembly source the patch was created from, if any
+}
+
+// Returns a string describing the patch
+func (p Patch) String() string {
+	ret := fmt.Sprintf("#%d 0x%08x: %s -> %s", p.ID, p.Address,
+		hex.EncodeToString(p.Original), hex.EncodeToString(p.Bytes))
+
+	if p.Source != "" {
+		ret += " (" + p.Source + ")"
+	}
+	return ret
+}
+
+// Returns true if the patch and `other` modify any of the same addresses
+func (p Patch) overlaps(other Patch) bool {
+	return p.Address < other.Address+uint64(len(other.Bytes)) &&
+		other.Address < p.Address+uint64(len(p.Bytes))
+}
+
+// Patches applied to memory, in the order they were applied
+type patchList struct {
+	list   []Patch
+	nextID int
+}
+
+// Assemble `source`, which may contain multiple instructions separated by
+// semicolons, as code located at `addr`. The mode (e.g., Arm or Thumb) that
+// code at `addr` is known or expected to execute in is used; see DisassembleAt().
+func (d *Debugger) Assemble(addr uint64, source string) ([]byte, error) {
+	regs, err := d.ReadRegAll()
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := d.ReadRegByName("pc")
+	if err != nil {
+		return nil, err
+	}
+
+	current := d.arch.currentMode(regs)
+	mode := d.modeAt(addr, d.InstructionAddress(pc.Value), current, current)
+
+	asm, err := d.arch.assembler(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	code, _, ok := asm.Assemble(source, addr)
+	if !ok {
+		return nil, fmt.Errorf("Failed to assemble \"%s\": %s", source, asm.LastError())
+	} else if len(code) == 0 {
+		return nil, errors.New("No instructions were provided.")
+	}
+
+	return code, nil
+}
+
+// Assemble `source` (see Assemble) and write the resulting code to `addr`,
+// recording the change as a Patch.
+func (d *Debugger) PatchAsm(addr uint64, source string) (Patch, error) {
+	code, err := d.Assemble(addr, source)
+	if err != nil {
+		return Patch{}, err
+	}
+
+	return d.applyPatch(addr, code, source)
+}
+
+// Write `data` to `addr`, recording the change as a Patch.
+func (d *Debugger) PatchBytes(addr uint64, data []byte) (Patch, error) {
+	if len(data) == 0 {
+		return Patch{}, errors.New("Patch data is empty.")
+	}
+
+	return d.applyPatch(addr, data, "")
+}
+
+func (d *Debugger) applyPatch(addr uint64, data []byte, source string) (Patch, error) {
+	original, err := d.ReadMem(addr, uint64(len(data)))
+	if err != nil {
+		return Patch{}, err
+	}
+
+	if err = d.WriteMem(addr, data); err != nil {
+		return Patch{}, err
+	}
+
+	p := Patch{
+		ID:       d.patch.nextID,
+		Address:  addr,
+		Original: original,
+		Bytes:    append([]byte{}, data...),
+		Source:   source,
+	}
+
+	d.patch.nextID++
+	d.patch.list = append(d.patch.list, p)
+	return p, nil
+}
+
+// Returns all applied patches, in the order they were applied
+func (d *Debugger) Patches() []Patch {
+	return append([]Patch{}, d.patch.list...)
+}
+
+// Revert the patch with the specified ID, restoring the original memory
+// contents. Later patches that overlap it must be reverted first.
+func (d *Debugger) RevertPatch(id int) error {
+	for i, p := range d.patch.list {
+		if p.ID != id {
+			continue
+		}
+
+		for _, later := range d.patch.list[i+1:] {
+			if later.overlaps(p) {
+				return fmt.Errorf("Patch #%d overlaps later patch #%d, which must be reverted first.", id, later.ID)
+			}
+		}
+
+		if err := d.WriteMem(p.Address, p.Original); err != nil {
+			return err
+		}
+
+		d.patch.list = append(d.patch.list[:i], d.patch.list[i+1:]...)
+		return nil
+	}
+
+	return fmt.Errorf("No patch with ID %d", id)
+}
+
+// Revert all patches, most recent first
+func (d *Debugger) RevertAllPatches() error {
+	for len(d.patch.list) > 0 {
+		p := d.patch.list[len(d.patch.list)-1]
+		if err := d.RevertPatch(p.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write all applied patches to `w` as a patch file. Each line contains a
+// patch's address, original bytes, and replacement bytes, in hex, followed by
+// its assembly source, if any, as a comment:
+//
+//	0x00010024 0120a0e3 0000a0e1  # mov r0, r0
+func (d *Debugger) WritePatches(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "# aemulari patch file: <address> <original bytes> <new bytes>"); err != nil {
+		return err
+	}
+
+	for _, p := range d.patch.list {
+		line := fmt.Sprintf("0x%08x %s %s", p.Address,
+			hex.EncodeToString(p.Original), hex.EncodeToString(p.Bytes))
+
+		if p.Source != "" {
+			line += "  # " + strings.Replace(p.Source, "\n", "; ", -1)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A patch read from a patch file via ReadPatchFile()
+type PatchSpec struct {
+	Address  uint64
+	Original []byte // Expected memory contents, or nil if they aren't verified
+	Bytes    []byte // Replacement bytes, if Source is empty
+	Source   string // Assembly source to assemble at Address
+	Location string // File and line number the patch was read from
+}
+
+// Read a patch file, in which each line has one of the following forms:
+//
+//	<address> <original bytes> <new bytes>
+//	<address> <original bytes> asm <instruction>[; instruction] ...
+//
+// Addresses and bytes are in hex. When applied, the patch fails unless memory
+// at <address> contains <original bytes>, unless these are given as "*".
+// Blank lines and text following a '#' are ignored, other than within the
+// instructions of the second form (e.g., "mov r0, #0"). Files written by
+// WritePatches() use this format.
+func ReadPatchFile(filename string) ([]PatchSpec, error) {
+	var specs []PatchSpec
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+
+		// A '#' begins a comment, other than within assembly source,
+		// where it may denote an immediate value
+		for i, f := range fields {
+			if i == 3 && fields[2] == "asm" {
+				break
+			} else if j := strings.Index(f, "#"); j >= 0 {
+				fields = fields[:i]
+				if j > 0 {
+					fields = append(fields, f[:j])
+				}
+				break
+			}
+		}
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		spec := PatchSpec{Location: fmt.Sprintf("%s:%d", filename, lineNum)}
+
+		if len(fields) < 3 || (fields[2] == "asm" && len(fields) < 4) || (fields[2] != "asm" && len(fields) != 3) {
+			return nil, fmt.Errorf("%s: Expected \"<address> <original bytes> <new bytes>\" or "+
+				"\"<address> <original bytes> asm <instructions>\"", spec.Location)
+		}
+
+		addrStr := fields[0]
+		if !strings.HasPrefix(addrStr, "0x") {
+			addrStr = "0x" + addrStr
+		}
+
+		if spec.Address, err = strconv.ParseUint(addrStr, 0, 64); err != nil {
+			return nil, fmt.Errorf("%s: Invalid address: %s", spec.Location, fields[0])
+		}
+
+		if fields[1] != "*" {
+			if spec.Original, err = hex.DecodeString(fields[1]); err != nil || len(spec.Original) == 0 {
+				return nil, fmt.Errorf("%s: Invalid original bytes: %s", spec.Location, fields[1])
+			}
+		}
+
+		if fields[2] == "asm" {
+			spec.Source = strings.Join(fields[3:], " ")
+		} else if spec.Bytes, err = hex.DecodeString(fields[2]); err != nil || len(spec.Bytes) == 0 {
+			return nil, fmt.Errorf("%s: Invalid replacement bytes: %s", spec.Location, fields[2])
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs, scanner.Err()
+}
+
+// Apply patches read via ReadPatchFile(). If a patch's original bytes don't
+// match the contents of memory, or it can't be applied, an error is returned
+// and any patches already applied from `specs` are reverted.
+func (d *Debugger) ApplyPatches(specs []PatchSpec) error {
+	var applied []Patch
+
+	revert := func(err error) error {
+		for i := len(applied) - 1; i >= 0; i-- {
+			d.RevertPatch(applied[i].ID)
+		}
+		return err
+	}
+
+	for _, spec := range specs {
+		if spec.Original != nil {
+			data, err := d.ReadMem(spec.Address, uint64(len(spec.Original)))
+			if err != nil {
+				return revert(fmt.Errorf("%s: %s", spec.Location, err.Error()))
+			}
+
+			if !bytes.Equal(data, spec.Original) {
+				return revert(fmt.Errorf("%s: Expected %s at 0x%08x, but found %s. "+
+					"The loaded image doesn't match this patch.", spec.Location,
+					hex.EncodeToString(spec.Original), spec.Address, hex.EncodeToString(data)))
+			}
+		}
+
+		var p Patch
+		var err error
+		if spec.Source != "" {
+			p, err = d.PatchAsm(spec.Address, spec.Source)
+		} else {
+			p, err = d.PatchBytes(spec.Address, spec.Bytes)
+		}
+
+		if err != nil {
+			return revert(fmt.Errorf("%s: %s", spec.Location, err.Error()))
+		}
+		applied = append(applied, p)
+	}
+
+	return nil
+}
+
+// Read and apply a patch file (see ReadPatchFile). The file will be read and
+// applied again whenever the Debugger is reset.
+func (d *Debugger) LoadPatchFile(filename string) error {
+	if err := d.applyPatchFile(filename); err != nil {
+		return err
+	}
+
+	d.cfg.PatchFiles = append(d.cfg.PatchFiles, filename)
+	return nil
+}
+
+func (d *Debugger) applyPatchFile(filename string) error {
+	specs, err := ReadPatchFile(filename)
+	if err != nil {
+		return err
+	}
+
+	return d.ApplyPatches(specs)
+}
+
+// Returns the names of patch files applied when the Debugger is initialized
+// or reset, including those loaded via LoadPatchFile()
+func (d *Debugger) PatchFiles() []string {
+	return d.cfg.PatchFiles
+}
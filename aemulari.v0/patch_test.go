@@ -0,0 +1,130 @@
+package aemulari
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// Write `contents` to a temporary patch file, returning its name
+func writePatchFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "aemulari-patch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err = f.WriteString(contents); err != nil {
+		os.Remove(f.Name())
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func TestReadPatchFile(t *testing.T) {
+	filename := writePatchFile(t, ""+
+		"# aemulari patch file: <address> <original bytes> <new bytes>\n"+
+		"0x00010024 0120a0e3 0000a0e1  # mov r0, r0\n"+
+		"\n"+
+		"10028 * 00bf\n"+
+		"  0x1002c 0000a0e3 asm mov r0, #1; bx lr\n"+
+		"0x10030 01 02# Comment\n")
+	defer os.Remove(filename)
+
+	specs, err := ReadPatchFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []PatchSpec{
+		{
+			Address:  0x10024,
+			Original: []byte{0x01, 0x20, 0xa0, 0xe3},
+			Bytes:    []byte{0x00, 0x00, 0xa0, 0xe1},
+			Location: filename + ":2",
+		},
+		{
+			Address:  0x10028,
+			Bytes:    []byte{0x00, 0xbf},
+			Location: filename + ":4",
+		},
+		{
+			Address:  0x1002c,
+			Original: []byte{0x00, 0x00, 0xa0, 0xe3},
+			Source:   "mov r0, #1; bx lr",
+			Location: filename + ":5",
+		},
+		{
+			Address:  0x10030,
+			Original: []byte{0x01},
+			Bytes:    []byte{0x02},
+			Location: filename + ":6",
+		},
+	}
+
+	if !reflect.DeepEqual(specs, expected) {
+		t.Errorf("Got %+v, expected %+v", specs, expected)
+	}
+}
+
+func TestReadPatchFileErrors(t *testing.T) {
+	tests := []string{
+		"0x10000 0102\n",
+		"0x10000 01 02 03\n",
+		"0x10000 01 asm\n",
+		"0x10000 * # 02\n",
+		"xyz 01 02\n",
+		"0x10000 0g 02\n",
+		"0x10000 01 2\n",
+		"0x10000 - 02\n",
+	}
+
+	for _, contents := range tests {
+		filename := writePatchFile(t, contents)
+		if _, err := ReadPatchFile(filename); err == nil {
+			t.Errorf("Read invalid patch: %q", contents)
+		}
+		os.Remove(filename)
+	}
+
+	if _, err := ReadPatchFile("/nonexistent/aemulari.patch"); err == nil {
+		t.Error("Read a nonexistent patch file")
+	}
+}
+
+// Patch files written by WritePatches() are read back by ReadPatchFile()
+func TestWritePatches(t *testing.T) {
+	var d Debugger
+	d.patch.list = []Patch{
+		{ID: 0, Address: 0x10024, Original: []byte{0x01, 0x20, 0xa0, 0xe3},
+			Bytes: []byte{0x00, 0x00, 0xa0, 0xe1}, Source: "mov r0, r0"},
+		{ID: 1, Address: 0x20000, Original: []byte{0x00}, Bytes: []byte{0xff}},
+	}
+
+	var buf bytes.Buffer
+	if err := d.WritePatches(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := writePatchFile(t, buf.String())
+	defer os.Remove(filename)
+
+	specs, err := ReadPatchFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(specs) != len(d.patch.list) {
+		t.Fatalf("Read %d patches from:\n%s", len(specs), buf.String())
+	}
+
+	for i, p := range d.patch.list {
+		s := specs[i]
+		if s.Address != p.Address || !bytes.Equal(s.Original, p.Original) || !bytes.Equal(s.Bytes, p.Bytes) {
+			t.Errorf("Patch %d was read back as %+v", p.ID, s)
+		}
+	}
+}
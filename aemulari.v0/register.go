@@ -2,6 +2,7 @@ package aemulari
 
 import (
 	"fmt"
+	"math/bits"
 	"strings"
 )
 
@@ -24,6 +25,13 @@ type registerAttr struct {
 	flags []registerFlag // Named flag bits for this register
 }
 
+// The current value of a named flag bit (or bits) within a Register
+type FlagValue struct {
+	Name        string // Flag (short) name
+	Description string // Flag description
+	Value       uint64 // Value of the flag bit(s)
+}
+
 // Information about a processor's register, including its name, current value, and flags.
 type Register struct {
 	attr  *registerAttr
@@ -35,6 +43,11 @@ func (r *Register) Name() string {
 	return r.attr.name
 }
 
+// Return the size of a Register, in bits.
+func (r *Register) Size() uint {
+	return uint(bits.Len64(r.attr.mask))
+}
+
 // Return a string that includes a Register's name and current value.
 func (r *Register) String() string {
 	return fmt.Sprintf("%-6s"+r.attr.fmt, r.attr.name, r.Value)
@@ -93,3 +106,12 @@ func (r *Register) FlagStrings() []string {
 	}
 	return ret
 }
+
+// Return the Register's flag bits and their associated values.
+func (r *Register) Flags() []FlagValue {
+	var ret []FlagValue
+	for _, flag := range r.attr.flags {
+		ret = append(ret, FlagValue{flag.name, flag.desc, r.getFlagValue(&flag)})
+	}
+	return ret
+}
@@ -0,0 +1,151 @@
+package remote
+
+import (
+	"errors"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+
+	ae "../../aemulari.v0"
+)
+
+// Reference client for the JSON-RPC Debugger service
+type Client struct {
+	rpc *rpc.Client
+}
+
+// Connect to a server at the specified address (see ParseAddress).
+// Only "tcp" and "unix" addresses are supported.
+func Dial(addr string) (*Client, error) {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "http" {
+		return nil, errors.New("HTTP servers are not supported by this client.")
+	}
+
+	c, err := jsonrpc.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{rpc: c}, nil
+}
+
+// Close the connection to the server. The server continues to run.
+func (c *Client) Close() error {
+	return c.rpc.Close()
+}
+
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+	return c.rpc.Call(serviceName+"."+method, args, reply)
+}
+
+// Map a memory region, specified as <name>:<addr>:<size>:[perms]:[input]:[output]
+func (c *Client) Map(region string) error {
+	return c.call("Map", &MapArgs{region}, &Empty{})
+}
+
+func (c *Client) Unmap(name string) error {
+	return c.call("Unmap", &UnmapArgs{name}, &Empty{})
+}
+
+func (c *Client) Mapped() ([]MemRegionInfo, error) {
+	var reply MappedReply
+	err := c.call("Mapped", &Empty{}, &reply)
+	return reply.Regions, err
+}
+
+func (c *Client) ReadMem(addr, size uint64) ([]byte, error) {
+	var reply ReadMemReply
+	err := c.call("ReadMem", &ReadMemArgs{addr, size}, &reply)
+	return reply.Data, err
+}
+
+func (c *Client) WriteMem(addr uint64, data []byte) error {
+	return c.call("WriteMem", &WriteMemArgs{addr, data}, &Empty{})
+}
+
+func (c *Client) ReadRegAll() ([]RegisterValue, error) {
+	var reply RegistersReply
+	err := c.call("ReadRegAll", &Empty{}, &reply)
+	return reply.Registers, err
+}
+
+// Read a single register by name. This is a convenience wrapper
+// around ReadRegAll().
+func (c *Client) ReadReg(name string) (RegisterValue, error) {
+	regs, err := c.ReadRegAll()
+	if err != nil {
+		return RegisterValue{}, err
+	}
+
+	for _, r := range regs {
+		if r.Name == name {
+			return r, nil
+		}
+	}
+
+	return RegisterValue{}, errors.New("Invalid register name: " + name)
+}
+
+func (c *Client) WriteReg(name string, value uint64) error {
+	return c.call("WriteReg", &WriteRegArgs{name, value}, &Empty{})
+}
+
+func (c *Client) Step(count int64) (StopReply, error) {
+	var reply StopReply
+	err := c.call("Step", &StepArgs{count}, &reply)
+	return reply, err
+}
+
+func (c *Client) Continue() (StopReply, error) {
+	var reply StopReply
+	err := c.call("Continue", &Empty{}, &reply)
+	return reply, err
+}
+
+// Stop execution started by a concurrent call to Step() or Continue()
+func (c *Client) Interrupt() error {
+	return c.call("Interrupt", &Empty{}, &Empty{})
+}
+
+func (c *Client) SetBreakpoint(addr uint64) (BreakpointInfo, error) {
+	var reply BreakpointInfo
+	err := c.call("SetBreakpoint", &BreakpointArgs{addr}, &reply)
+	return reply, err
+}
+
+func (c *Client) DeleteBreakpoint(id int) error {
+	return c.call("DeleteBreakpoint", &BreakpointIDArgs{id}, &Empty{})
+}
+
+func (c *Client) DeleteBreakpointsAt(addr uint64) error {
+	return c.call("DeleteBreakpointsAt", &BreakpointArgs{addr}, &Empty{})
+}
+
+func (c *Client) DeleteAllBreakpoints() error {
+	return c.call("DeleteAllBreakpoints", &Empty{}, &Empty{})
+}
+
+func (c *Client) GetBreakpoints() ([]BreakpointInfo, error) {
+	var reply BreakpointsReply
+	err := c.call("GetBreakpoints", &Empty{}, &reply)
+	return reply.Breakpoints, err
+}
+
+func (c *Client) DisassembleAt(addr, count uint64) ([]ae.Disassembly, error) {
+	var reply DisassemblyReply
+	err := c.call("DisassembleAt", &DisassembleArgs{addr, count}, &reply)
+	return reply.Instructions, err
+}
+
+func (c *Client) Reset(keepMappings bool) error {
+	return c.call("Reset", &ResetArgs{keepMappings}, &Empty{})
+}
+
+// Request that the server stop accepting connections and exit
+func (c *Client) Quit() error {
+	return c.call("Quit", &Empty{}, &Empty{})
+}
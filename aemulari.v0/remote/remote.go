@@ -0,0 +1,489 @@
+// Package remote exposes Debugger operations via JSON-RPC, allowing aemulari
+// to be scripted from other languages (e.g., Python notebooks) and CI jobs.
+//
+// Requests use JSON-RPC 1.0, as implemented by net/rpc/jsonrpc. Each method
+// takes a single parameter object and is named "Debugger.<Method>". For
+// example, from Python:
+//
+//	import json, socket
+//	s = socket.create_connection(("127.0.0.1", 5555))
+//	s.sendall(json.dumps({"id": 1, "method": "Debugger.Step",
+//	                      "params": [{"Count": 1}]}).encode())
+//	print(s.recv(4096))
+//
+// When served over HTTP, each request is POSTed to /rpc with a Content-Type
+// of application/json. Cross-origin requests (i.e., from a web browser) are
+// rejected.
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strings"
+	"sync"
+
+	ae "../../aemulari.v0"
+)
+
+// Service name under which Debugger methods are registered
+const serviceName = "Debugger"
+
+// Placeholder for methods that take no arguments or return no data
+type Empty struct{}
+
+type MapArgs struct {
+	Region string // <name>:<addr>:<size>:[perms], without input or output files
+}
+
+type UnmapArgs struct {
+	Name string
+}
+
+type MemRegionInfo struct {
+	Name        string
+	Base        uint64
+	Size        uint64
+	Permissions string
+}
+
+type MappedReply struct {
+	Regions []MemRegionInfo
+}
+
+type ReadMemArgs struct {
+	Address uint64
+	Size    uint64
+}
+
+type ReadMemReply struct {
+	Data []byte // Base64-encoded in JSON
+}
+
+type WriteMemArgs struct {
+	Address uint64
+	Data    []byte // Base64-encoded in JSON
+}
+
+type RegisterValue struct {
+	Name  string
+	Value uint64
+	Size  uint     // Register size, in bits
+	Flags []string `json:",omitempty"` // Decoded flag bits, if any
+}
+
+type RegistersReply struct {
+	Registers []RegisterValue
+}
+
+type WriteRegArgs struct {
+	Name  string
+	Value uint64
+}
+
+type StepArgs struct {
+	Count int64
+}
+
+// Describes why execution stopped
+type StopReply struct {
+	PC           uint64 // Program counter after execution stopped
+	Reason       string // Why execution stopped (e.g., "breakpoint"); see ae.StopReason
+	Instructions uint64 // Instructions executed since the Debugger was created or reset
+	Exception    string `json:",omitempty"` // Description of exception, if one occurred
+	Signal       int    `json:",omitempty"` // POSIX signal describing the exception
+}
+
+type BreakpointArgs struct {
+	Address uint64
+}
+
+type BreakpointIDArgs struct {
+	ID int
+}
+
+type BreakpointInfo struct {
+	ID       int
+	Address  uint64
+	Enabled  bool
+	HitCount uint
+}
+
+type BreakpointsReply struct {
+	Breakpoints []BreakpointInfo
+}
+
+type DisassembleArgs struct {
+	Address uint64
+	Count   uint64
+}
+
+type DisassemblyReply struct {
+	Instructions []ae.Disassembly
+}
+
+type ResetArgs struct {
+	KeepMappings bool
+}
+
+// Debugger methods exposed via RPC. The Debugger is not safe for concurrent
+// use, so requests from all connections are serialized.
+type Service struct {
+	dbg  *ae.Debugger
+	lock sync.Mutex
+
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func NewService(dbg *ae.Debugger) *Service {
+	return &Service{dbg: dbg, quit: make(chan struct{})}
+}
+
+func (s *Service) Map(args *MapArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	region, err := ae.NewMemRegion(args.Region)
+	if err != nil {
+		return err
+	}
+
+	// Clients must not be able to read or write arbitrary files
+	if region.HasInputFile() || region.HasOutputFile() {
+		return errors.New("Memory regions mapped via RPC may not have input or output files.")
+	}
+
+	return s.dbg.Map(region)
+}
+
+func (s *Service) Unmap(args *UnmapArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if args.Name == "code" {
+		return errors.New("The code region may not be unmapped.")
+	}
+
+	return s.dbg.Unmap(args.Name)
+}
+
+func (s *Service) Mapped(args *Empty, reply *MappedReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, r := range s.dbg.Mapped() {
+		base, size := r.Region()
+		reply.Regions = append(reply.Regions, MemRegionInfo{
+			Name:        r.Name(),
+			Base:        base,
+			Size:        size,
+			Permissions: r.Permissions().String(),
+		})
+	}
+
+	return nil
+}
+
+func (s *Service) ReadMem(args *ReadMemArgs, reply *ReadMemReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := s.dbg.ReadMem(args.Address, args.Size)
+	reply.Data = data
+	return err
+}
+
+func (s *Service) WriteMem(args *WriteMemArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dbg.WriteMem(args.Address, args.Data)
+}
+
+func (s *Service) ReadRegAll(args *Empty, reply *RegistersReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	regs, err := s.dbg.ReadRegAll()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range regs {
+		reply.Registers = append(reply.Registers, RegisterValue{
+			Name:  r.Name(),
+			Value: r.Value,
+			Size:  r.Size(),
+			Flags: r.FlagStrings(),
+		})
+	}
+
+	return nil
+}
+
+func (s *Service) WriteReg(args *WriteRegArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dbg.WriteRegByName(strings.ToLower(args.Name), args.Value)
+}
+
+func (s *Service) stopReply(ex ae.Exception, reply *StopReply) error {
+	pc, err := s.dbg.ReadRegByName("pc")
+	if err != nil {
+		return err
+	}
+
+	reply.PC = pc.Value
+	reply.Reason = s.dbg.StopReason().String()
+	reply.Instructions = s.dbg.InstructionCount()
+	if ex.Occurred() {
+		reply.Exception = ex.String()
+		reply.Signal = ex.Signal()
+	}
+
+	return nil
+}
+
+func (s *Service) Step(args *StepArgs, reply *StopReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := args.Count
+	if count == 0 {
+		count = 1
+	}
+
+	ex, err := s.dbg.Step(count)
+	if err != nil {
+		return err
+	}
+
+	return s.stopReply(ex, reply)
+}
+
+func (s *Service) Continue(args *Empty, reply *StopReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ex, err := s.dbg.Continue()
+	if err != nil {
+		return err
+	}
+
+	return s.stopReply(ex, reply)
+}
+
+// Stop execution started by Step or Continue, which reply with the reason
+// "interrupted". This doesn't wait on other requests, as those are blocked
+// until execution stops.
+func (s *Service) Interrupt(args *Empty, reply *Empty) error {
+	return s.dbg.Interrupt()
+}
+
+func breakpointInfo(bp ae.Breakpoint) BreakpointInfo {
+	return BreakpointInfo{
+		ID:       bp.ID,
+		Address:  bp.Address,
+		Enabled:  bp.Enabled(),
+		HitCount: bp.HitCount(),
+	}
+}
+
+func (s *Service) SetBreakpoint(args *BreakpointArgs, reply *BreakpointInfo) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	*reply = breakpointInfo(s.dbg.SetBreakpoint(args.Address))
+	return nil
+}
+
+func (s *Service) DeleteBreakpoint(args *BreakpointIDArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dbg.DeleteBreakpoint(args.ID)
+	return nil
+}
+
+func (s *Service) DeleteBreakpointsAt(args *BreakpointArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dbg.DeleteBreakpointsAt(args.Address)
+	return nil
+}
+
+func (s *Service) DeleteAllBreakpoints(args *Empty, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.dbg.DeleteAllBreakpoints()
+	return nil
+}
+
+func (s *Service) GetBreakpoints(args *Empty, reply *BreakpointsReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, bp := range s.dbg.GetBreakpoints() {
+		reply.Breakpoints = append(reply.Breakpoints, breakpointInfo(bp))
+	}
+
+	return nil
+}
+
+func (s *Service) DisassembleAt(args *DisassembleArgs, reply *DisassemblyReply) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := args.Count
+	if count == 0 {
+		count = 1
+	}
+
+	instrs, err := s.dbg.DisassembleAt(args.Address, count)
+	reply.Instructions = instrs
+	return err
+}
+
+func (s *Service) Reset(args *ResetArgs, reply *Empty) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.dbg.Reset(args.KeepMappings)
+}
+
+// Stop the server. Once outstanding requests complete, Serve() returns.
+func (s *Service) Quit(args *Empty, reply *Empty) error {
+	s.quitOnce.Do(func() { close(s.quit) })
+	return nil
+}
+
+// Parse a server address of the form [network:]<address>, where [network]
+// is "tcp" (default), "unix", or "http". An address consisting only of a
+// port number implies a TCP listener on the loopback interface.
+func ParseAddress(s string) (network, address string, err error) {
+	fields := strings.SplitN(s, ":", 2)
+
+	switch fields[0] {
+	case "tcp", "unix", "http":
+		if len(fields) != 2 || fields[1] == "" {
+			return "", "", fmt.Errorf("Invalid server address: %s", s)
+		}
+		network, address = fields[0], fields[1]
+	default:
+		network, address = "tcp", s
+	}
+
+	if network != "unix" && !strings.Contains(address, ":") {
+		address = "127.0.0.1:" + address
+	}
+
+	return network, address, nil
+}
+
+// Serve RPC requests for `dbg` at the specified address (see ParseAddress)
+// until a client calls Debugger.Quit. Status messages are written to `log`.
+func Serve(addr string, dbg *ae.Debugger, log io.Writer) error {
+	network, address, err := ParseAddress(addr)
+	if err != nil {
+		return err
+	}
+
+	listenNetwork := network
+	if network == "http" {
+		listenNetwork = "tcp"
+	}
+
+	listener, err := net.Listen(listenNetwork, address)
+	if err != nil {
+		return err
+	}
+
+	svc := NewService(dbg)
+	server := rpc.NewServer()
+	if err = server.RegisterName(serviceName, svc); err != nil {
+		listener.Close()
+		return err
+	}
+
+	go func() {
+		<-svc.quit
+		listener.Close()
+	}()
+
+	fmt.Fprintf(log, "Serving JSON-RPC requests on %s:%s\n", network, listener.Addr())
+
+	if network == "http" {
+		mux := http.NewServeMux()
+		mux.Handle("/rpc", httpHandler{server})
+		err = http.Serve(listener, mux)
+	} else {
+		err = serveConns(listener, server)
+	}
+
+	select {
+	case <-svc.quit:
+		// Closing the listener is how we get here; that's not an error.
+		return nil
+	default:
+		return err
+	}
+}
+
+func serveConns(listener net.Listener, server *rpc.Server) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// Services a single JSON-RPC request per HTTP POST
+type httpHandler struct {
+	server *rpc.Server
+}
+
+// Adapts an HTTP request body and response to an io.ReadWriteCloser
+type httpConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c httpConn) Close() error {
+	return nil
+}
+
+func (h httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "JSON-RPC requests must be POSTed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Browsers send "simple" cross-origin requests without a CORS preflight,
+	// so a web page could otherwise drive the Debugger. Such requests can't
+	// be sent as application/json without a preflight, and carry an Origin.
+	if r.Header.Get("Origin") != "" {
+		http.Error(w, "Cross-origin requests are not permitted.", http.StatusForbidden)
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		http.Error(w, "JSON-RPC requests must have a Content-Type of application/json.",
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	h.server.ServeRequest(jsonrpc.NewServerCodec(httpConn{r.Body, w}))
+}
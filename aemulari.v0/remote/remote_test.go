@@ -0,0 +1,272 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ae "../../aemulari.v0"
+)
+
+const codeBase = 0x10000
+
+// ARM code written to the code region by newTestClient()
+var testProgram = []uint32{
+	0xe3a00001, // 0x10000: mov r0, #1
+	0xeafffffe, // 0x10004: b 0x10004
+}
+
+// Serve a Debugger on a Unix socket, with testProgram in its code region,
+// and return a Client connected to it. The server is shut down when the
+// test completes.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+
+	arch, err := ae.NewArchitecture("arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg ae.DebuggerConfig
+	cfg.Mem, err = ae.NewMemRegionSet([]string{"code:0x10000:0x1000:rwx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbg, err := ae.NewDebugger(arch, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "aemulari-remote-test")
+	if err != nil {
+		dbg.Close()
+		t.Fatal(err)
+	}
+
+	addr := "unix:" + filepath.Join(dir, "aemulari.sock")
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(addr, dbg, ioutil.Discard)
+	}()
+
+	// The server may take a moment to begin listening
+	var c *Client
+	for i := 0; i < 50; i++ {
+		if c, err = Dial(addr); err == nil {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err != nil {
+		dbg.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if err := c.Quit(); err != nil {
+			t.Error(err)
+		}
+		c.Close()
+
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+
+		dbg.Close()
+		os.RemoveAll(dir)
+	})
+
+	code := make([]byte, 4*len(testProgram))
+	for i, instr := range testProgram {
+		binary.LittleEndian.PutUint32(code[4*i:], instr)
+	}
+
+	if err = c.WriteMem(codeBase, code); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestMap(t *testing.T) {
+	c := newTestClient(t)
+
+	if err := c.Map("scratch:0x80000:0x1000:rw"); err != nil {
+		t.Fatal(err)
+	}
+
+	regions, err := c.Mapped()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(regions) != 2 || regions[0].Name != "code" || regions[1].Name != "scratch" {
+		t.Errorf("Unexpected memory regions: %+v", regions)
+	}
+
+	data := []byte{0xde, 0xad, 0xbe, 0xef}
+	if err = c.WriteMem(0x80000, data); err != nil {
+		t.Fatal(err)
+	}
+
+	readBack, err := c.ReadMem(0x80000, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, readBack) {
+		t.Errorf("Memory mismatch: %x", readBack)
+	}
+
+	if err = c.Unmap("scratch"); err != nil {
+		t.Fatal(err)
+	} else if err = c.Unmap("code"); err == nil {
+		t.Error("The code region was unmapped")
+	}
+
+	// Clients may not read or write files via input and output files
+	for _, region := range []string{
+		"input:0x90000:0x1000:rw:/etc/passwd",
+		"output:0x90000:0x1000:rw::/tmp/aemulari-remote-test.bin",
+	} {
+		if err = c.Map(region); err == nil {
+			t.Errorf("Mapped %s", region)
+		}
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	c := newTestClient(t)
+
+	if err := c.WriteReg("r10", 0x1234); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := c.ReadReg("r10")
+	if err != nil {
+		t.Fatal(err)
+	} else if r.Value != 0x1234 || r.Size != 32 {
+		t.Errorf("Unexpected register value: %+v", r)
+	}
+
+	if _, err = c.ReadReg("r99"); err == nil {
+		t.Error("Read a nonexistent register")
+	}
+}
+
+func TestStopReply(t *testing.T) {
+	c := newTestClient(t)
+
+	bp, err := c.SetBreakpoint(codeBase + 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop, err := c.Continue()
+	if err != nil {
+		t.Fatal(err)
+	} else if stop.PC != codeBase+4 || stop.Reason != "breakpoint" || stop.Instructions != 1 {
+		t.Errorf("Expected to stop at breakpoint, got: %+v", stop)
+	}
+
+	bps, err := c.GetBreakpoints()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(bps) != 1 || bps[0].ID != bp.ID || bps[0].HitCount != 1 {
+		t.Errorf("Unexpected breakpoint state: %+v", bps)
+	}
+
+	if err = c.DeleteBreakpoint(bp.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	stop, err = c.Step(3)
+	if err != nil {
+		t.Fatal(err)
+	} else if stop.PC != codeBase+4 || stop.Reason != "step" || stop.Instructions != 4 {
+		t.Errorf("Unexpected stop after stepping: %+v", stop)
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	c := newTestClient(t)
+
+	type result struct {
+		stop StopReply
+		err  error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		stop, err := c.Continue()
+		done <- result{stop, err}
+	}()
+
+	// The infinite loop runs until interrupted. The request may arrive
+	// before execution begins, in which case it has no effect.
+	for {
+		if err := c.Interrupt(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case r := <-done:
+			if r.err != nil {
+				t.Fatal(r.err)
+			} else if r.stop.PC != codeBase+4 || r.stop.Reason != "interrupted" {
+				t.Errorf("Unexpected stop after interrupting: %+v", r.stop)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	server := rpc.NewServer()
+	handler := httpHandler{server}
+
+	tests := []struct {
+		contentType string
+		origin      string
+		status      int
+	}{
+		{"application/json", "", http.StatusOK},
+		{"application/json; charset=utf-8", "", http.StatusOK},
+		{"text/plain", "", http.StatusUnsupportedMediaType},
+		{"", "", http.StatusUnsupportedMediaType},
+		{"application/json", "http://example.com", http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		body := strings.NewReader(`{"id": 1, "method": "Debugger.Nonexistent", "params": [{}]}`)
+		r := httptest.NewRequest(http.MethodPost, "/rpc", body)
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if test.origin != "" {
+			r.Header.Set("Origin", test.origin)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.status {
+			t.Errorf("Content-Type %q, Origin %q: got status %d, expected %d",
+				test.contentType, test.origin, w.Code, test.status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/rpc", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, expected %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
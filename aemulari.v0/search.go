@@ -0,0 +1,183 @@
+package aemulari
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Maximum number of matches returned by SearchMem()
+const MaxSearchResults = 4096
+
+// A sequence of bytes to search for. Bytes whose corresponding Mask bits
+// are clear match any value.
+type SearchPattern struct {
+	Data []byte
+	Mask []byte
+}
+
+// Create a SearchPattern that matches `data` exactly
+func NewSearchPattern(data []byte) SearchPattern {
+	mask := bytes.Repeat([]byte{0xff}, len(data))
+	return SearchPattern{Data: data, Mask: mask}
+}
+
+// Create a SearchPattern matching a string encoded as UTF-16, in the
+// specified endianness, without a terminating NUL.
+func NewUTF16SearchPattern(s string, e Endianness) SearchPattern {
+	var data []byte
+
+	for _, u := range utf16.Encode([]rune(s)) {
+		if e == BigEndian {
+			data = append(data, byte(u>>8), byte(u))
+		} else {
+			data = append(data, byte(u), byte(u>>8))
+		}
+	}
+
+	return NewSearchPattern(data)
+}
+
+// Parse a hex byte pattern (e.g., "de ad ?? ef" or "dead??ef"), in which a
+// '?' matches any value for a single hex digit.
+func ParseHexPattern(s string) (SearchPattern, error) {
+	var p SearchPattern
+
+	digits := strings.Join(strings.Fields(s), "")
+	if len(digits) == 0 || len(digits)%2 != 0 {
+		return p, fmt.Errorf("Invalid hex pattern (expected pairs of hex digits): %s", s)
+	}
+
+	for i := 0; i < len(digits); i += 2 {
+		var value, mask byte
+
+		for _, c := range digits[i : i+2] {
+			value <<= 4
+			mask <<= 4
+
+			switch {
+			case c == '?':
+			case c >= '0' && c <= '9':
+				value |= byte(c - '0')
+				mask |= 0xf
+			case c >= 'a' && c <= 'f':
+				value |= byte(c - 'a' + 10)
+				mask |= 0xf
+			case c >= 'A' && c <= 'F':
+				value |= byte(c - 'A' + 10)
+				mask |= 0xf
+			default:
+				return p, fmt.Errorf("Invalid character in hex pattern: %c", c)
+			}
+		}
+
+		p.Data = append(p.Data, value)
+		p.Mask = append(p.Mask, mask)
+	}
+
+	return p, nil
+}
+
+// Returns true if the pattern contains no wildcards
+func (p SearchPattern) exact() bool {
+	for _, m := range p.Mask {
+		if m != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the pattern matches the start of `data`
+func (p SearchPattern) matchesAt(data []byte) bool {
+	for i, b := range p.Data {
+		if data[i]&p.Mask[i] != b&p.Mask[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Append the addresses of all matches in `data`, located at `base`, to
+// `addrs`, stopping once `limit` addresses are present.
+func (p SearchPattern) search(data []byte, addrs []uint64, base uint64, limit int) []uint64 {
+	n := len(p.Data)
+
+	if p.exact() {
+		for start := 0; len(addrs) < limit; {
+			i := bytes.Index(data[start:], p.Data)
+			if i < 0 {
+				break
+			}
+			addrs = append(addrs, base+uint64(start+i))
+			start += i + 1
+		}
+		return addrs
+	}
+
+	for i := 0; i+n <= len(data) && len(addrs) < limit; i++ {
+		if p.matchesAt(data[i:]) {
+			addrs = append(addrs, base+uint64(i))
+		}
+	}
+
+	return addrs
+}
+
+// Search memory for a pattern, returning the addresses of up to
+// MaxSearchResults matches in ascending order. The `scope` may be empty, to
+// search all mapped regions, the name of a region, or an address range of
+// the form <addr>:<size>. Matches spanning two regions are not reported.
+func (d *Debugger) SearchMem(p SearchPattern, scope string) ([]uint64, error) {
+	var matches []uint64
+	var ranges []AddressRange
+
+	if len(p.Data) == 0 || len(p.Data) != len(p.Mask) {
+		return nil, errors.New("Search pattern is empty or malformed.")
+	}
+
+	regions := d.mapped.Entries()
+
+	if scope == "" {
+		for _, r := range regions {
+			ranges = append(ranges, AddressRange{Start: r.base, End: r.End()})
+		}
+	} else if r, err := d.mapped.Get(scope); err == nil {
+		ranges = append(ranges, AddressRange{Start: r.base, End: r.End()})
+	} else {
+		scopeRange, err := ParseAddressRange(scope)
+		if err != nil {
+			return nil, fmt.Errorf("\"%s\" is not a region name or address range.", scope)
+		}
+
+		// Search only the mapped portions of the range
+		for _, r := range regions {
+			start, end := r.base, r.End()
+			if scopeRange.Start > start {
+				start = scopeRange.Start
+			}
+			if scopeRange.End < end {
+				end = scopeRange.End
+			}
+			if start < end {
+				ranges = append(ranges, AddressRange{Start: start, End: end})
+			}
+		}
+	}
+
+	for _, r := range ranges {
+		data, err := d.mu.MemRead(r.Start, r.End-r.Start)
+		if err != nil {
+			return nil, err
+		}
+
+		matches = p.search(data, matches, r.Start, MaxSearchResults)
+		if len(matches) >= MaxSearchResults {
+			break
+		}
+	}
+
+	return matches, nil
+}
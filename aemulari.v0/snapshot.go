@@ -0,0 +1,72 @@
+package aemulari
+
+import "fmt"
+
+// A copy of register values and the contents of writable memory regions,
+// which may be restored via Debugger.Restore(). This is considerably faster
+// than Reset(), which re-creates the emulator and reloads input files.
+type Snapshot struct {
+	regs []Register
+	mem  map[string][]byte // Region name -> contents
+}
+
+// Capture the current state of registers and writable memory regions
+func (d *Debugger) Snapshot() (*Snapshot, error) {
+	var err error
+
+	s := &Snapshot{mem: make(map[string][]byte)}
+
+	if s.regs, err = d.ReadRegAll(); err != nil {
+		return nil, err
+	}
+
+	for _, r := range d.mapped.Entries() {
+		if !r.perms.Write {
+			continue
+		}
+
+		if s.mem[r.name], err = d.mu.MemRead(r.base, r.size); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Restore the register values and memory contents captured by Snapshot().
+// Regions mapped after the snapshot was taken are left as-is.
+func (d *Debugger) Restore(s *Snapshot) error {
+	for name, data := range s.mem {
+		r, err := d.mapped.Get(name)
+		if err != nil {
+			return fmt.Errorf("Cannot restore snapshot: %s", err.Error())
+		}
+
+		if err = d.WriteMem(r.base, data); err != nil {
+			return err
+		}
+	}
+
+	return d.restoreRegs(s.regs)
+}
+
+// Write raw register values, such as those previously returned by
+// ReadRegAll(). The PC is written last, once the processor state it
+// depends upon (e.g., Arm's CPSR) is restored.
+func (d *Debugger) restoreRegs(regs []Register) error {
+	var pc *Register
+
+	for i, reg := range regs {
+		if reg.attr.pc {
+			pc = &regs[i]
+		} else if err := d.mu.RegWrite(reg.attr.uc, reg.Value); err != nil {
+			return err
+		}
+	}
+
+	if pc == nil {
+		return nil
+	}
+
+	return d.WriteReg(*pc)
+}
@@ -0,0 +1,67 @@
+package aemulari
+
+import (
+	"errors"
+)
+
+// Run until execution reaches `addr`, or stops for another reason (e.g., a
+// breakpoint). If execution is currently at `addr`, it must be reached
+// again. For Arm, bit 0 of `addr` (the Thumb bit) is ignored, so either
+// form of an address may be provided.
+func (d *Debugger) RunTo(addr uint64) (Exception, error) {
+	return d.runTo(d.InstructionAddress(addr), -1)
+}
+
+// Execute a single instruction, unless it is a call (e.g., Arm BL or BLX),
+// in which case execution continues until the call returns. The StopReason
+// is StopStepComplete if either completes without interruption.
+//
+// This relies upon call tracking, which must be enabled.
+func (d *Debugger) StepOver() (Exception, error) {
+	if d.calls.disabled {
+		return Exception{}, errors.New("Stepping over calls requires call tracking to be enabled.")
+	}
+
+	depth := len(d.calls.frames)
+
+	e, err := d.Step(1)
+	if err != nil || d.step.reason != StopStepComplete || len(d.calls.frames) <= depth {
+		return e, err
+	}
+
+	e, err = d.runTo(d.calls.frames[depth].ret, depth)
+	if d.step.reason == StopTarget {
+		d.step.reason = StopStepComplete
+	}
+
+	return e, err
+}
+
+// Run until the current function returns to its caller. The return address
+// is taken from the calls observed during execution, if any. Otherwise, it
+// is determined via the link register or frame records (see Backtrace()).
+func (d *Debugger) StepOut() (Exception, error) {
+	if n := len(d.calls.frames); !d.calls.disabled && n > 0 {
+		return d.runTo(d.calls.frames[n-1].ret, n-1)
+	}
+
+	frames, err := d.Backtrace()
+	if err != nil {
+		return Exception{}, err
+	} else if len(frames) < 2 {
+		return Exception{}, errors.New("Unable to determine the current function's return address.")
+	}
+
+	return d.runTo(frames[1].Address, -1)
+}
+
+// Continue until `addr` is reached with no more than `depth` calls on the
+// shadow call stack (at any depth, if negative).
+func (d *Debugger) runTo(addr uint64, depth int) (Exception, error) {
+	d.step.targeted = true
+	d.step.target = addr
+	d.step.depth = depth
+	defer func() { d.step.targeted = false }()
+
+	return d.run(-1, d.code().End())
+}
@@ -0,0 +1,40 @@
+package aemulari
+
+// Describes why the most recent call to Step() or Continue() returned
+type StopReason int
+
+const (
+	StopNone         StopReason = iota // No code has been executed
+	StopStepComplete                   // The requested number of instructions were executed
+	StopBreakpoint                     // An enabled breakpoint was hit
+	StopException                      // A processor exception occurred
+	StopEndOfCode                      // Execution reached the end of the code region
+	StopReturn                         // A function invoked via Call() returned
+	StopBudget                         // The instruction budget was exhausted
+	StopMemoryFault                    // An invalid memory access occurred
+	StopTarget                         // Execution reached the address given to RunTo() or StepOut()
+	StopInterrupted                    // Execution was stopped via Interrupt()
+	StopError                          // The emulator reported an error
+)
+
+var stopReasonStrings = map[StopReason]string{
+	StopNone:         "none",
+	StopStepComplete: "step",
+	StopBreakpoint:   "breakpoint",
+	StopException:    "exception",
+	StopEndOfCode:    "end",
+	StopReturn:       "return",
+	StopBudget:       "budget",
+	StopMemoryFault:  "fault",
+	StopTarget:       "target",
+	StopInterrupted:  "interrupted",
+	StopError:        "error",
+}
+
+// Return a short, lowercase name for the StopReason
+func (r StopReason) String() string {
+	if s, found := stopReasonStrings[r]; found {
+		return s
+	}
+	return "unknown"
+}
@@ -0,0 +1,155 @@
+package aemulari
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Symbol names and their addresses, loaded from symbol files
+type symbolTable struct {
+	byName map[string]uint64
+	byAddr map[uint64]string
+	files  []string
+}
+
+func (s *symbolTable) initialize() {
+	s.byName = make(map[string]uint64)
+	s.byAddr = make(map[uint64]string)
+	s.files = nil
+}
+
+func (s *symbolTable) add(name string, addr uint64) {
+	s.byName[name] = addr
+
+	// Prefer the first name encountered for an address
+	if _, found := s.byAddr[addr]; !found {
+		s.byAddr[addr] = name
+	}
+}
+
+// Load symbols from a file containing one symbol per line, in either of
+// the following forms. The latter is the default output format of `nm`.
+//
+//	<address> <name>
+//	<address> <type> <name>
+//
+// Blank lines and text following a '#' are ignored, as are symbols listed
+// without an address, such as those `nm` reports as undefined ("U foo").
+func (d *Debugger) LoadSymbols(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		} else if len(fields) != 2 && len(fields) != 3 {
+			return fmt.Errorf("%s:%d: Expected \"<address> [type] <name>\"", filename, lineNum)
+		} else if len(fields) == 2 && len(fields[0]) == 1 && !isHexDigit(fields[0][0]) {
+			// A type, but no address (e.g., an undefined or weak symbol)
+			continue
+		}
+
+		addrStr := fields[0]
+		if !strings.HasPrefix(addrStr, "0x") {
+			addrStr = "0x" + addrStr
+		}
+
+		addr, err := strconv.ParseUint(addrStr, 0, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: Invalid address: %s", filename, lineNum, fields[0])
+		}
+
+		d.syms.add(fields[len(fields)-1], addr)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+
+	d.syms.files = append(d.syms.files, filename)
+	return nil
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// Returns the names of symbol files loaded via LoadSymbols()
+func (d *Debugger) SymbolFiles() []string {
+	return d.syms.files
+}
+
+// Return the address of the symbol named `name`
+func (d *Debugger) LookupSymbol(name string) (uint64, bool) {
+	addr, found := d.syms.byName[name]
+	return addr, found
+}
+
+// Return the name of the symbol located at `addr`
+func (d *Debugger) SymbolAt(addr uint64) (string, bool) {
+	name, found := d.syms.byAddr[addr]
+	return name, found
+}
+
+// Parse an address specified numerically, as a symbol name, or as a symbol
+// name plus an offset (e.g., "checksum+0x10").
+func (d *Debugger) ParseAddress(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+
+	if addr, err := strconv.ParseUint(s, 0, 64); err == nil {
+		return addr, nil
+	}
+
+	name, offsetStr := s, ""
+	if i := strings.Index(s, "+"); i > 0 {
+		name, offsetStr = s[:i], s[i+1:]
+	}
+
+	addr, found := d.LookupSymbol(strings.TrimSpace(name))
+	if !found {
+		return 0, fmt.Errorf("Invalid address or unknown symbol: %s", s)
+	}
+
+	if offsetStr != "" {
+		offset, err := strconv.ParseUint(strings.TrimSpace(offsetStr), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid offset: %s", offsetStr)
+		}
+		addr += offset
+	}
+
+	return addr, nil
+}
+
+// Return the name of the symbol nearest to, but not above, `addr`, followed
+// by the offset from it, if non-zero (e.g., "checksum+0x1c").
+func (d *Debugger) Symbolize(addr uint64) (string, bool) {
+	var name string
+	var base uint64
+	found := false
+
+	for symAddr, symName := range d.syms.byAddr {
+		if symAddr <= addr && (!found || symAddr > base) {
+			name, base, found = symName, symAddr, true
+		}
+	}
+
+	if found && addr != base {
+		name += fmt.Sprintf("+0x%x", addr-base)
+	}
+
+	return name, found
+}
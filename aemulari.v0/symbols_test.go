@@ -0,0 +1,44 @@
+package aemulari
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadSymbols(t *testing.T) {
+	f, err := ioutil.TempFile("", "aemulari-syms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	// Excerpt of nm output, including undefined and weak symbols
+	f.WriteString("" +
+		"00010000 T main\n" +
+		"00020000 d counter  # Comment\n" +
+		"         U puts\n" +
+		"         w __gmon_start__\n" +
+		"00030000 buffer\n")
+	f.Close()
+
+	var d Debugger
+	d.syms.initialize()
+
+	if err := d.LoadSymbols(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]uint64{"main": 0x10000, "counter": 0x20000, "buffer": 0x30000}
+	for name, addr := range expected {
+		if value, found := d.LookupSymbol(name); !found || value != addr {
+			t.Errorf("%s = 0x%x (found: %v), expected 0x%x", name, value, found, addr)
+		}
+	}
+
+	for _, name := range []string{"puts", "__gmon_start__"} {
+		if _, found := d.LookupSymbol(name); found {
+			t.Errorf("%s has no address, but was loaded", name)
+		}
+	}
+}
@@ -1,37 +1,215 @@
 // Functionality for synchronizing external tools to debugger state
 //
-// Currently, this is just Ghidra + AddressSync, because that's
-// good enough for me! (For now...)
+// Two protocols are supported:
 //
-// https://github.com/jynik/AddressSync
+//   - AddressSync: The program counter is sent as 8 raw little-endian bytes.
+//     This is what Ghidra + AddressSync expects.
+//     https://github.com/jynik/AddressSync
 //
+//   - MessageSync: A small, versioned message protocol that conveys the
+//     program counter, register snapshots, and breakpoint changes, and
+//     accepts commands (e.g., set breakpoint, jump) from the external tool.
+//
+// MessageSync messages consist of an 8-byte header followed by a payload.
+// All multi-byte fields are little-endian.
+//
+//	Offset  Size  Description
+//	0       2     Magic: "AE"
+//	2       1     Protocol version (1)
+//	3       1     Message type
+//	4       4     Payload length, in bytes
+//	8       n     Payload
+//
+// Messages sent to the external tool:
+//
+//	0x01  PC                  u64 address
+//	0x02  Register snapshot   u16 count, then per register:
+//	                            u8 name length, name, u64 value
+//	0x03  Breakpoint added    u32 ID, u64 address
+//	0x04  Breakpoint removed  u32 ID, u64 address
+//
+// Messages accepted from the external tool:
+//
+//	0x81  Set breakpoint      u64 address
+//	0x82  Delete breakpoints  u64 address
+//	0x83  Jump                u64 address (assigned to the program counter)
+//
+// Over datagram transports (udp, unixgram), each datagram carries exactly
+// one message.
 
 package aemulari
 
 import (
+	"bufio"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strings"
 )
 
+// Protocol used to communicate with external tools
+type ToolSyncProtocol int
+
+const (
+	AddressSync ToolSyncProtocol = iota // Program counter only, as 8 raw bytes
+	MessageSync                         // Versioned aemulari message protocol
+)
+
+const (
+	toolSyncVersion    = 1
+	toolSyncHeaderSize = 8
+	toolSyncMaxPayload = 0x10000
+)
+
+// MessageSync message types
+const (
+	tsMsgPC             = 0x01
+	tsMsgRegisters      = 0x02
+	tsMsgBreakpointAdd  = 0x03
+	tsMsgBreakpointDel  = 0x04
+	tsMsgSetBreakpoint  = 0x81
+	tsMsgDelBreakpoints = 0x82
+	tsMsgJump           = 0x83
+)
+
+// External tool synchronization settings
+type ToolSyncConfig struct {
+	Protocol ToolSyncProtocol // Protocol spoken with the external tool
+	Network  string           // "udp", "tcp", "unix", or "unixgram"
+	Address  string           // host:port, or a socket path
+}
+
+// Returns the default configuration: AddressSync over UDP to 127.0.0.1:1080
+func DefaultToolSyncConfig() ToolSyncConfig {
+	return ToolSyncConfig{
+		Protocol: AddressSync,
+		Network:  "udp",
+		Address:  "127.0.0.1:1080",
+	}
+}
+
+// Returns the configuration in the form accepted by ParseToolSyncConfig()
+func (c ToolSyncConfig) String() string {
+	proto := "addrsync"
+	if c.Protocol == MessageSync {
+		proto = "msg"
+	}
+	return proto + ":" + c.Network + ":" + c.Address
+}
+
+// Create a ToolSyncConfig from a string of the following form:
+//
+//	[protocol:]<network>:<address>
+//
+// where [protocol] is "addrsync" (default) or "msg", <network> is one of
+// "udp", "tcp", "unix", or "unixgram", and <address> is a host:port pair
+// or a socket path. An empty string yields the DefaultToolSyncConfig().
+func ParseToolSyncConfig(s string) (ToolSyncConfig, error) {
+	cfg := DefaultToolSyncConfig()
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return cfg, nil
+	}
+
+	fields := strings.SplitN(s, ":", 2)
+	switch strings.ToLower(fields[0]) {
+	case "addrsync", "addresssync":
+		cfg.Protocol = AddressSync
+		s = ""
+		if len(fields) > 1 {
+			s = fields[1]
+		}
+	case "msg", "message":
+		cfg.Protocol = MessageSync
+		s = ""
+		if len(fields) > 1 {
+			s = fields[1]
+		}
+	}
+
+	if s == "" {
+		return cfg, nil
+	}
+
+	fields = strings.SplitN(s, ":", 2)
+	if len(fields) != 2 || fields[1] == "" {
+		return cfg, fmt.Errorf("Invalid tool sync specification: %s", s)
+	}
+
+	switch fields[0] {
+	case "udp", "tcp", "unix", "unixgram":
+		cfg.Network = fields[0]
+		cfg.Address = fields[1]
+	default:
+		return cfg, fmt.Errorf("Unsupported tool sync network type: %s", fields[0])
+	}
+
+	return cfg, nil
+}
+
+// Type of command received from an external tool
+type ToolSyncCommandType int
+
+const (
+	ToolSyncSetBreakpoint     ToolSyncCommandType = iota // Set a breakpoint at Address
+	ToolSyncDeleteBreakpoints                            // Delete all breakpoints at Address
+	ToolSyncJump                                         // Set the program counter to Address
+)
+
+// A command received from an external tool
+type ToolSyncCommand struct {
+	Type    ToolSyncCommandType
+	Address uint64
+}
+
+// Return a description of the command
+func (c ToolSyncCommand) String() string {
+	// FIXME address format string should be arch-dependent
+	switch c.Type {
+	case ToolSyncSetBreakpoint:
+		return fmt.Sprintf("Set breakpoint at 0x%08x", c.Address)
+	case ToolSyncDeleteBreakpoints:
+		return fmt.Sprintf("Delete breakpoints at 0x%08x", c.Address)
+	case ToolSyncJump:
+		return fmt.Sprintf("Jump to 0x%08x", c.Address)
+	default:
+		return fmt.Sprintf("Unknown command (%d)", c.Type)
+	}
+}
+
 type ToolSync struct {
 	isInitialized bool
 
-	addrConn net.Conn
-	addrBuf []byte
+	cfg  ToolSyncConfig
+	conn net.Conn
+	cmds chan ToolSyncCommand // Commands received from the external tool
 }
 
-// Open connection(s) to external tools
-func (ts *ToolSync) Open() error {
+// Open a connection to an external tool, as described by `cfg`.
+// If cfg.Network is empty, the DefaultToolSyncConfig() is used.
+func (ts *ToolSync) Open(cfg ToolSyncConfig) error {
 	var err error
 
-	ts.addrBuf = make([]byte, 8)
+	if cfg.Network == "" {
+		cfg = DefaultToolSyncConfig()
+	}
 
-	ts.addrConn, err = net.Dial("udp","127.0.0.1:1080")
+	ts.conn, err = net.Dial(cfg.Network, cfg.Address)
 	if err != nil {
 		return err
 	}
 
+	ts.cfg = cfg
 	ts.isInitialized = true
+
+	if cfg.Protocol == MessageSync {
+		ts.cmds = make(chan ToolSyncCommand, 64)
+		go ts.receive(ts.conn, ts.cmds)
+	}
+
 	return nil
 }
 
@@ -41,7 +219,159 @@ func (ts *ToolSync) Close() {
 	}
 
 	ts.isInitialized = false
-	ts.addrConn.Close()
+	ts.conn.Close()
+}
+
+// Returns a channel on which commands from the external tool are delivered.
+// The channel is closed when the connection is closed. If the protocol in use
+// does not support commands, nil is returned.
+func (ts *ToolSync) Commands() <-chan ToolSyncCommand {
+	if !ts.isInitialized || ts.cfg.Protocol != MessageSync {
+		return nil
+	}
+	return ts.cmds
+}
+
+// Receive and decode commands until the connection is closed
+func (ts *ToolSync) receive(conn net.Conn, cmds chan<- ToolSyncCommand) {
+	defer close(cmds)
+
+	datagrams := ts.cfg.Network == "udp" || ts.cfg.Network == "unixgram"
+	r := bufio.NewReader(conn)
+	buf := make([]byte, toolSyncHeaderSize+toolSyncMaxPayload)
+
+	for {
+		var msgType byte
+		var payload []byte
+
+		if datagrams {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if isClosedConn(err) {
+					return
+				}
+				continue
+			}
+
+			msgType, payload, err = parseToolSyncMessage(buf[:n])
+			if err != nil {
+				continue
+			}
+		} else {
+			hdr := buf[:toolSyncHeaderSize]
+			if _, err := io.ReadFull(r, hdr); err != nil {
+				return
+			}
+
+			length, err := parseToolSyncHeader(hdr)
+			if err != nil {
+				// We've lost framing; there's no recovering from this.
+				return
+			}
+
+			payload = buf[toolSyncHeaderSize : toolSyncHeaderSize+length]
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			msgType = hdr[3]
+		}
+
+		if cmd, ok := decodeToolSyncCommand(msgType, payload); ok {
+			cmds <- cmd
+		}
+	}
+}
+
+// Returns true if `err` indicates the connection has been closed. Other
+// errors (e.g., an ICMP port unreachable reported on a UDP socket) are
+// transient from our perspective.
+func isClosedConn(err error) bool {
+	return errors.Is(err, net.ErrClosed) || err == io.EOF
+}
+
+// Validate a message header and return its payload length
+func parseToolSyncHeader(hdr []byte) (int, error) {
+	if hdr[0] != 'A' || hdr[1] != 'E' {
+		return 0, errors.New("Invalid tool sync message magic.")
+	}
+
+	if hdr[2] != toolSyncVersion {
+		return 0, fmt.Errorf("Unsupported tool sync message version: %d", hdr[2])
+	}
+
+	length := binary.LittleEndian.Uint32(hdr[4:])
+	if length > toolSyncMaxPayload {
+		return 0, fmt.Errorf("Tool sync message is too large (%d bytes).", length)
+	}
+
+	return int(length), nil
+}
+
+// Split a complete message into its type and payload
+func parseToolSyncMessage(msg []byte) (byte, []byte, error) {
+	if len(msg) < toolSyncHeaderSize {
+		return 0, nil, errors.New("Truncated tool sync message.")
+	}
+
+	length, err := parseToolSyncHeader(msg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if len(msg) < toolSyncHeaderSize+length {
+		return 0, nil, errors.New("Truncated tool sync message.")
+	}
+
+	return msg[3], msg[toolSyncHeaderSize : toolSyncHeaderSize+length], nil
+}
+
+func decodeToolSyncCommand(msgType byte, payload []byte) (ToolSyncCommand, bool) {
+	var cmd ToolSyncCommand
+
+	if len(payload) < 8 {
+		return cmd, false
+	}
+	cmd.Address = binary.LittleEndian.Uint64(payload)
+
+	switch msgType {
+	case tsMsgSetBreakpoint:
+		cmd.Type = ToolSyncSetBreakpoint
+	case tsMsgDelBreakpoints:
+		cmd.Type = ToolSyncDeleteBreakpoints
+	case tsMsgJump:
+		cmd.Type = ToolSyncJump
+	default:
+		return cmd, false
+	}
+
+	return cmd, true
+}
+
+// Send a MessageSync message. This is a no-op for other protocols, or if
+// Open() has not been called.
+func (ts *ToolSync) sendMessage(msgType byte, payload []byte) error {
+	if !ts.isInitialized || ts.cfg.Protocol != MessageSync {
+		return nil
+	}
+
+	msg := make([]byte, toolSyncHeaderSize, toolSyncHeaderSize+len(payload))
+	msg[0] = 'A'
+	msg[1] = 'E'
+	msg[2] = toolSyncVersion
+	msg[3] = msgType
+	binary.LittleEndian.PutUint32(msg[4:], uint32(len(payload)))
+	msg = append(msg, payload...)
+
+	n, err := ts.conn.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	if n != len(msg) {
+		return fmt.Errorf("Tried to send %d bytes to external tool, actually sent %d", len(msg), n)
+	}
+
+	return nil
 }
 
 // Send the program counter address to any sync'd tools
@@ -52,16 +382,14 @@ func (ts *ToolSync) SendCurrAddress(addr uint64) error {
 		return nil
 	}
 
-	ts.addrBuf[0] = byte( addr        & 0xff)
-	ts.addrBuf[1] = byte((addr >> 8)  & 0xff)
-	ts.addrBuf[2] = byte((addr >> 16) & 0xff)
-	ts.addrBuf[3] = byte((addr >> 24) & 0xff)
-	ts.addrBuf[4] = byte((addr >> 32) & 0xff)
-	ts.addrBuf[5] = byte((addr >> 40) & 0xff)
-	ts.addrBuf[6] = byte((addr >> 48) & 0xff)
-	ts.addrBuf[7] = byte((addr >> 56) & 0xff)
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, addr)
+
+	if ts.cfg.Protocol == MessageSync {
+		return ts.sendMessage(tsMsgPC, buf)
+	}
 
-	n, err := ts.addrConn.Write(ts.addrBuf)
+	n, err := ts.conn.Write(buf)
 	if err != nil {
 		return err
 	}
@@ -71,5 +399,35 @@ func (ts *ToolSync) SendCurrAddress(addr uint64) error {
 		return fmt.Errorf(msg, n)
 	}
 
-	return nil;
+	return nil
+}
+
+// Send a snapshot of register state to any sync'd tools.
+// This is only supported by the MessageSync protocol, and is otherwise a no-op.
+func (ts *ToolSync) SendRegisters(regs []Register) error {
+	payload := make([]byte, 2)
+	binary.LittleEndian.PutUint16(payload, uint16(len(regs)))
+
+	value := make([]byte, 8)
+	for _, r := range regs {
+		payload = append(payload, byte(len(r.attr.name)))
+		payload = append(payload, r.attr.name...)
+		binary.LittleEndian.PutUint64(value, r.Value)
+		payload = append(payload, value...)
+	}
+
+	return ts.sendMessage(tsMsgRegisters, payload)
+}
+
+// Notify any sync'd tools that a breakpoint has been added or removed.
+// This is only supported by the MessageSync protocol, and is otherwise a no-op.
+func (ts *ToolSync) SendBreakpoint(bp Breakpoint, added bool) error {
+	payload := make([]byte, 12)
+	binary.LittleEndian.PutUint32(payload, uint32(bp.ID))
+	binary.LittleEndian.PutUint64(payload[4:], bp.Address)
+
+	if added {
+		return ts.sendMessage(tsMsgBreakpointAdd, payload)
+	}
+	return ts.sendMessage(tsMsgBreakpointDel, payload)
 }
@@ -0,0 +1,263 @@
+package aemulari
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Output format of an instruction trace
+type TraceFormat int
+
+const (
+	TraceText TraceFormat = iota // One human-readable line per instruction
+	TraceJSON                    // One JSON object per line (JSON Lines)
+)
+
+// Return the TraceFormat associated with the name "text" or "json"
+func ParseTraceFormat(s string) (TraceFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "":
+		return TraceText, nil
+	case "json", "jsonl":
+		return TraceJSON, nil
+	default:
+		return TraceText, fmt.Errorf("Invalid trace format: %s", s)
+	}
+}
+
+// A range of addresses, [Start, End)
+type AddressRange struct {
+	Start uint64 // First address in the range
+	End   uint64 // Address of the byte AFTER the end of the range
+}
+
+// Create an AddressRange from a string of the form <addr>:<size>
+func ParseAddressRange(s string) (AddressRange, error) {
+	var r AddressRange
+
+	fields := strings.Split(s, ":")
+	if len(fields) != 2 {
+		return r, fmt.Errorf("Invalid address range (expected <addr>:<size>): %s", s)
+	}
+
+	start, err := strconv.ParseUint(fields[0], 0, 64)
+	if err != nil {
+		return r, fmt.Errorf("Invalid address range start: %s", fields[0])
+	}
+
+	size, err := strconv.ParseUint(fields[1], 0, 64)
+	if err != nil || size == 0 {
+		return r, fmt.Errorf("Invalid address range size: %s", fields[1])
+	}
+
+	if (^uint64(0) - size) < start {
+		return r, fmt.Errorf("Address range exceeds address space limits: %s", s)
+	}
+
+	r.Start = start
+	r.End = start + size
+	return r, nil
+}
+
+// Returns true if `addr` falls within the AddressRange
+func (r AddressRange) Contains(addr uint64) bool {
+	return addr >= r.Start && addr < r.End
+}
+
+// Instruction trace configuration
+type TraceConfig struct {
+	Output io.Writer   // Destination of trace records
+	Format TraceFormat // Record format
+
+	// Only instructions within these ranges are recorded.
+	// If empty, every executed instruction is recorded.
+	Ranges []AddressRange
+}
+
+// JSON representation of a trace record
+type traceRecord struct {
+	Address  string            `json:"address"`
+	Opcode   string            `json:"opcode"`
+	Mnemonic string            `json:"mnemonic"`
+	Operands string            `json:"operands"`
+	Changed  map[string]string `json:"changed,omitempty"`
+}
+
+// Instruction trace state. Records are produced by the code stepping hook.
+type instrTrace struct {
+	dbg     *Debugger
+	cfg     TraceConfig
+	enabled bool
+
+	// The most recently executed instruction is held until the next
+	// instruction (or the end of execution) so that the register changes
+	// it caused can be included in its record.
+	pending *Disassembly
+	regs    []Register // Register state prior to the pending instruction
+
+	err error // First error encountered while writing records
+}
+
+// Begin recording an instruction trace. Each instruction executed within the
+// "code" region is recorded, along with any registers it modified.
+func (d *Debugger) StartTrace(cfg TraceConfig) error {
+	if cfg.Output == nil {
+		return errors.New("An output is required for instruction tracing.")
+	}
+
+	if d.trace.enabled {
+		return errors.New("An instruction trace is already being recorded.")
+	}
+
+	d.trace = instrTrace{dbg: d, cfg: cfg, enabled: true}
+	return nil
+}
+
+// Stop recording an instruction trace. The first error that occurred
+// while writing trace records, if any, is returned.
+func (d *Debugger) StopTrace() error {
+	if !d.trace.enabled {
+		return nil
+	}
+
+	d.trace.flush()
+	d.trace.enabled = false
+	return d.trace.err
+}
+
+// Returns true if an instruction trace is currently being recorded.
+func (d *Debugger) Tracing() bool {
+	return d.trace.enabled
+}
+
+// Returns true if an instruction at `addr` should be recorded
+func (t *instrTrace) wanted(addr uint64) bool {
+	if len(t.cfg.Ranges) == 0 {
+		return true
+	}
+
+	for _, r := range t.cfg.Ranges {
+		if r.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record the instruction at `addr`, which is about to be executed.
+// This is called from the code stepping hook.
+func (t *instrTrace) record(addr uint64) {
+	if !t.enabled {
+		return
+	}
+
+	t.flush()
+
+	if !t.wanted(addr) {
+		return
+	}
+
+	d := t.dbg
+	regs, err := d.ReadRegAll()
+	if err != nil {
+		t.fail(err)
+		return
+	}
+
+	instrs, err := d.DisassembleAt(addr, 1)
+	if err != nil {
+		t.fail(err)
+		return
+	} else if len(instrs) == 0 {
+		t.fail(fmt.Errorf("Failed to disassemble instruction at 0x%08x", addr))
+		return
+	}
+
+	t.pending = &instrs[0]
+	t.regs = regs
+}
+
+// Write the pending instruction's record, if there is one
+func (t *instrTrace) flush() {
+	if t.pending == nil {
+		return
+	}
+
+	instr := t.pending
+	t.pending = nil
+
+	regs, err := t.dbg.ReadRegAll()
+	if err != nil {
+		t.fail(err)
+		return
+	}
+
+	changed := changedRegisters(t.regs, regs)
+
+	switch t.cfg.Format {
+	case TraceJSON:
+		rec := traceRecord{
+			Address:  instr.Address,
+			Opcode:   instr.Opcode,
+			Mnemonic: instr.Mnemonic,
+			Operands: instr.Operands,
+		}
+
+		if len(changed) != 0 {
+			rec.Changed = make(map[string]string)
+			for _, r := range changed {
+				rec.Changed[r.attr.name] = fmt.Sprintf(r.attr.fmt, r.Value)
+			}
+		}
+
+		data, err := json.Marshal(rec)
+		if err == nil {
+			_, err = fmt.Fprintf(t.cfg.Output, "%s\n", data)
+		}
+		t.fail(err)
+
+	default:
+		line := fmt.Sprintf("%s  %-8s  %-7s %-24s", instr.Address,
+			instr.Opcode, instr.Mnemonic, instr.Operands)
+
+		if len(changed) != 0 {
+			line += " ;"
+			for _, r := range changed {
+				line += fmt.Sprintf(" %s="+r.attr.fmt, r.attr.name, r.Value)
+			}
+		}
+
+		_, err := fmt.Fprintln(t.cfg.Output, strings.TrimRight(line, " "))
+		t.fail(err)
+	}
+}
+
+// Retain the first error that occurs while tracing
+func (t *instrTrace) fail(err error) {
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// Return the registers in `curr` whose values differ from those in `prev`.
+// The program counter is omitted, as it changes with every instruction.
+func changedRegisters(prev, curr []Register) []Register {
+	var ret []Register
+
+	for i, r := range curr {
+		if r.attr.pc || i >= len(prev) {
+			continue
+		}
+
+		if prev[i].Value != r.Value {
+			ret = append(ret, r)
+		}
+	}
+
+	return ret
+}
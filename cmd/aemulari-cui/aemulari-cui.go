@@ -19,12 +19,23 @@ var usageText string = "" +
 	cmdline.FlagStr_regs +
 	cmdline.FlagStr_mem +
 	cmdline.FlagStr_breakpoint +
+	cmdline.FlagStr_symbols +
+	cmdline.FlagStr_patch +
 	cmdline.FlagStr_sync +
+	cmdline.FlagStr_script +
+	cmdline.FlagStr_starlark +
+	cmdline.FlagStr_config +
 	cmdline.FlagStr_help +
 	cmdline.Details_arch +
 	cmdline.Details_mem +
+	cmdline.Details_patch +
+	cmdline.Details_sync +
+	cmdline.Details_script +
+	cmdline.Details_config +
 	cmdline.Notes +
 	" - Available GUI commands can be viewed by running the \"help\" command.\n" +
+	" - If present, " + ui.RcFile + " in the current directory is run at startup,\n" +
+	"     prior to any --script files.\n" +
 	"\n" +
 	"Examples:\n" +
 	"  Run myprogram.bin with memory at 0x48000 initialized with the contents\n" +
@@ -45,17 +56,23 @@ func main() {
 		cmdline.Flag_mem,
 		cmdline.Flag_instrcount,
 		cmdline.Flag_breakpoint,
+		cmdline.Flag_symbols,
+		cmdline.Flag_patch,
 		cmdline.Flag_sync,
 		cmdline.Flag_printRegs,
 		cmdline.Flag_hexdump,
+		cmdline.Flag_script,
+		cmdline.Flag_starlark,
+		cmdline.Flag_config,
 	}
 
-	_, arch, dbg := cmdline.Parse(supportedFlags, usageText)
+	args, arch, dbg := cmdline.Parse(supportedFlags, usageText)
 
 	if gui, err := ui.Create(arch, dbg); err != nil {
 		fmt.Printf("Error: %s", err)
 		os.Exit(1)
 	} else {
+		gui.SetStartupScripts(args.GetStrings("script"), args.GetStrings("starlark"), true)
 		gui.Run()
 		gui.Close()
 		dbg.Close()
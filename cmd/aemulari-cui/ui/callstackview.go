@@ -0,0 +1,45 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+
+	ae "../../../aemulari.v0"
+)
+
+// Format a backtrace, one frame per line. If `verbose` is true, call sites
+// and how each frame was determined are included.
+func (ui *Ui) formatBacktrace(frames []ae.StackFrame, verbose bool) string {
+	var ret string
+
+	for i, f := range frames {
+		ret += fmt.Sprintf(" #%-2d %s", i, ui.dbg.FormatAddress(f.Address))
+		if f.Symbol != "" {
+			ret += " " + f.Symbol
+		}
+
+		if verbose && f.CallSite != 0 {
+			ret += "  (called from " + ui.dbg.FormatAddress(f.CallSite) + ")"
+		}
+
+		if verbose && (f.Source == ae.FrameLR || f.Source == ae.FrameFP) {
+			ret += "  [" + f.Source.String() + "]"
+		}
+
+		ret += "\n"
+	}
+
+	return ret
+}
+
+func (ui *Ui) updateCallStackView(view *gocui.View) error {
+	frames, err := ui.dbg.Backtrace()
+	if err != nil {
+		return err
+	}
+
+	view.Clear()
+	fmt.Fprint(view, ui.formatBacktrace(frames, false))
+	return nil
+}
@@ -2,18 +2,25 @@ package ui
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
 
 	ae "../../../aemulari.v0"
+	"../../internal/cmdline"
+	"../../internal/scripting"
 	"github.com/jroimartin/gocui"
 )
 
 const linesep = "" +
 	"-------------------------------------------------------------------------------\n"
 
+// Maximum number of search results listed by the find command
+const maxFindListed = 16
+
 type cmd struct {
 	names   []string
 	min     int
@@ -39,6 +46,8 @@ func lookupCmd(toFind string) (cmd, error) {
 				// XXX: Hack to avoid initialization loop
 				if entry.names[0] == "help" && entry.exec == nil {
 					entry.exec = cmdHelp
+				} else if entry.names[0] == "source" && entry.exec == nil {
+					entry.exec = cmdSource
 				}
 
 				entry.matchedName = name
@@ -78,11 +87,34 @@ func (ui *Ui) handleCommand(line string) (string, bool, error) {
 		ui.regs.tainted = true
 	}
 
+	if cmd.mayTaintRegs || cmd.mayTaintMem {
+		ui.watches.tainted = true
+	}
+
 	if cmd.mayTaintMem {
-		ui.mem.tainted = true
+		for _, m := range ui.panes {
+			m.tainted = true
+		}
 	}
 
 	output, err := cmd.exec(ui, cmd, args)
+
+	// Report errors and output from Starlark callbacks run during execution
+	if ui.starlark != nil {
+		if cbErr := ui.starlark.CallbackError(); cbErr != nil && err == nil {
+			err = cbErr
+		}
+
+		if ui.starlarkOut.Len() > 0 {
+			printed := strings.TrimRight(ui.starlarkOut.String(), "\n")
+			if output != "" {
+				printed += "\n" + output
+			}
+			output = printed
+			ui.starlarkOut.Reset()
+		}
+	}
+
 	if err != nil {
 		if err == gocui.ErrQuit {
 			return "", false, err
@@ -99,6 +131,16 @@ func (ui *Ui) handleCommand(line string) (string, bool, error) {
 	return output, cmd.suppressHistory, err
 }
 
+// Describe the outcome of running code, if it was halted by an exception
+func runResult(exception ae.Exception, err error) (string, error) {
+	if err != nil {
+		return "", err
+	} else if exception.Occurred() {
+		return "Halted due to exception: " + exception.String(), nil
+	}
+	return "", nil
+}
+
 func lowerTrim(s string) string {
 	return strings.ToLower(strings.Trim(s, " \t\r\n\x00"))
 }
@@ -139,15 +181,113 @@ var cmdList []cmd = []cmd{
 			"Execute a single or [count] instructions.\n",
 	},
 
+	{
+		names:        []string{"next"},
+		min:          1,
+		max:          2,
+		exec:         cmdNext,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		summary:      "Execute 1 or more instructions, stepping over calls",
+		details: "[count]\n" +
+			"\n" +
+			"Execute a single or [count] instructions, treating each call (BL or BLX)\n" +
+			"as a single instruction by running until the called function returns.\n",
+	},
+
+	{
+		names:        []string{"finish"},
+		min:          1,
+		max:          1,
+		exec:         cmdFinish,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		summary:      "Execute until the current function returns",
+		details: "\n" +
+			"\n" +
+			"Execute until the current function returns to its caller, whose return\n" +
+			"address is shown in frame #1 of \"backtrace\".\n",
+	},
+
+	{
+		names:        []string{"until"},
+		min:          2,
+		max:          4096, // Arbitrary "good enough" value
+		exec:         cmdUntil,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		summary:      "Execute until an address is reached",
+		details: "<address>\n" +
+			"\n" +
+			"Execute until <address> is reached, or a breakpoint or exception occurs.\n" +
+			"The address may be an expression (See \"help watch\"). For Thumb code,\n" +
+			"bit 0 of the address is ignored.\n" +
+			"\n" +
+			"Examples:\n" +
+			" until 0x10240\n" +
+			" until lr\n",
+	},
+
 	{
 		names:   []string{"breakpoint"},
 		min:     1,
-		max:     2,
+		max:     4096, // Arbitrary "good enough" value
 		exec:    cmdBreak,
 		summary: "Set a breakpoint",
 		details: "[address]\n" +
 			"\n" +
-			"Set a breakpoint at PC or [address], if specified.\n",
+			"Set a breakpoint at PC or [address], if specified. The address may\n" +
+			"be an expression of numbers, registers, and symbols (e.g., main+0x10\n" +
+			"or [sp+4]). See \"help watch\" for the expression syntax.\n",
+	},
+
+	{
+		names:   []string{"backtrace", "bt"},
+		min:     1,
+		max:     1,
+		exec:    cmdBacktrace,
+		summary: "Show the call stack",
+		details: "\n" +
+			"\n" +
+			"Show the current PC, followed by the return address of each caller, as\n" +
+			"in the Call Stack view. Addresses are symbolized when symbols are loaded.\n" +
+			"\n" +
+			"Calls made via BL and BLX are recorded as they execute, and unwound when\n" +
+			"their return address is reached. If no calls have been recorded (e.g.,\n" +
+			"execution started partway through a program), lr and frame records\n" +
+			"located via fp are used instead; these are marked [lr] and [fp].\n",
+	},
+
+	{
+		names:        []string{"call"},
+		min:          2,
+		max:          18,
+		exec:         cmdCall,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		summary:      "Call a function with the specified arguments",
+		details: "<address|symbol> [args...]\n" +
+			"\n" +
+			"Call the function at <address> per the architecture's calling convention\n" +
+			"(the AAPCS for Arm) and run until it returns. For Arm, bit 0 of the\n" +
+			"address selects Thumb state.\n" +
+			"\n" +
+			"Arguments may be numbers, symbols, or the following, which are allocated\n" +
+			"in a \"" + ae.ScratchRegionName + "\" region and passed by address. This region also holds\n" +
+			"the stack and return address, so it must be executable. It is mapped\n" +
+			"automatically if it does not exist.\n" +
+			"\n" +
+			"  str:<text>     NUL-terminated string\n" +
+			"  hex:<bytes>    Buffer initialized with the specified hex bytes\n" +
+			"  buf:<size>     Zeroed buffer of <size> bytes\n" +
+			"\n" +
+			"When the function returns, all registers other than the return value\n" +
+			"registers (r0 and r1 for Arm) are restored. If execution stops for any\n" +
+			"other reason, registers are left as-is for inspection. Buffers remain\n" +
+			"allocated until the next call.\n" +
+			"\n" +
+			"Example:\n" +
+			"  call crc32 0 hex:00112233 4\n",
 	},
 
 	{
@@ -168,7 +308,7 @@ var cmdList []cmd = []cmd{
 	{
 		names:        []string{"rw"},
 		min:          3,
-		max:          3,
+		max:          4096, // Arbitrary "good enough" value
 		exec:         cmdRegWrite,
 		mayTaintRegs: true,
 		summary:      "Write a value to a register",
@@ -177,12 +317,14 @@ var cmdList []cmd = []cmd{
 			"\n" +
 			"<value> may be one of:\n" +
 			"  - A base 10 or base 16 value. This may be positive or negative.\n" +
+			"  - An expression, such as: sp+0x20 or [r4]:u16 (See \"help watch\")\n" +
 			"  - {<hex sequence>} such as: {0102deadbeef0405}\n" +
 			"  - A fixed-length signed or unsigned value via fn(<x>) where fn is:\n" +
 			"     i8() u8(), u16(), i16(), i32(), u32(), i64(), u64()\n" +
 			"\n" +
 			"Examples:\n" +
 			" rw r0 0x1b4d1dea\n" +
+			" rw r0 r1 + 4\n" +
 			" rw r0 i16(-7)\n" +
 			" rw r0 {deadbeef}\n",
 	},
@@ -197,9 +339,11 @@ var cmdList []cmd = []cmd{
 		summary: "Write data to the specified memory address",
 		details: "<address> <value> [value] ... [value]\n" +
 			"Write one or more values, converted to target endianness, to <address>.\n" +
+			"The address may be an expression without spaces (e.g., sp+8).\n" +
 			"\n" +
 			"<value> may be one of:\n" +
 			"  - A base 10 or base 16 value. This may be positive or negative.\n" +
+			"  - An expression without spaces, written as a pointer-sized value.\n" +
 			"  - {<hex sequence>} such as: {0102deadbeef0405}\n" +
 			"  - A fixed-length signed or unsigned value via fn(<x>) where fn is:\n" +
 			"     i8() u8(), u16(), i16(), i32(), u32(), i64(), u64()\n" +
@@ -210,6 +354,56 @@ var cmdList []cmd = []cmd{
 			" mw 0x1ab000 {deadbeef} 0xbadc0de\n",
 	},
 
+	{
+		names:       []string{"asm"},
+		min:         3,
+		max:         4096, // Arbitrary "good enough" value
+		exec:        cmdAsm,
+		mayTaintMem: true,
+		summary:     "Assemble instructions and patch them into memory",
+		details: "<address> <instruction>[; instruction] ...\n" +
+			"\n" +
+			"Assemble one or more instructions, separated by semicolons, and write\n" +
+			"them to <address>, which may be an expression without spaces. Code is\n" +
+			"assembled in the mode (e.g., Arm or Thumb) it was last executed in, or is\n" +
+			"otherwise expected to be in, as shown in the Disassembly view.\n" +
+			"\n" +
+			"Each use of this command is recorded as a patch. See \"help patch\".\n" +
+			"\n" +
+			"Examples:\n" +
+			" asm 0x10024 nop\n" +
+			" asm pc mov r0, #1; bx lr\n",
+	},
+
+	{
+		names:       []string{"patch"},
+		min:         2,
+		max:         3,
+		exec:        cmdPatch,
+		mayTaintMem: true,
+		summary:     "List, revert, export, or load patches",
+		details: "list\n" +
+			"             revert <id|all>\n" +
+			"             export <file>\n" +
+			"             load <file>\n" +
+			"\n" +
+			"Manage patches made via the asm command or loaded from patch files.\n" +
+			"\n" +
+			"  list      List each patch's ID, address, and original and new bytes.\n" +
+			"  revert    Restore the memory modified by a patch, or all patches.\n" +
+			"            Later patches overlapping it must be reverted first.\n" +
+			"  export    Write all patches to a patch file, one per line:\n" +
+			"              <address> <original bytes> <new bytes>  # <assembly>\n" +
+			"  load      Apply the patches in a patch file, as with --patch. These\n" +
+			"            fail unless memory contains each patch's original bytes,\n" +
+			"            and are applied again upon each reset.\n" +
+			"\n" +
+			"Examples:\n" +
+			" patch revert 0\n" +
+			" patch export mods.patch\n" +
+			" patch load mods.patch\n",
+	},
+
 	{
 		names:       []string{"map"},
 		min:         2,
@@ -245,21 +439,70 @@ var cmdList []cmd = []cmd{
 
 	{
 		names:   []string{"dumpmem"},
-		min:     3,
+		min:     2,
 		max:     4,
 		exec:    cmdDumpMem,
 		summary: "Save the contents of a memory region to a file",
 		details: "<filename> <region name>\n" +
 			"               <filename> <addr> <length>\n" +
+			"               <region name>\n" +
 			"\n" +
 			"Save the contents of a memory region, specified by name or\n" +
-			"by address and length, to a file.",
+			"by address and length, to a file.\n" +
+			"\n" +
+			"Given only a region name, write the region to the output file it was\n" +
+			"mapped with, without waiting for it to be unmapped.",
+	},
+
+	{
+		names:   []string{"diff"},
+		min:     2,
+		max:     3,
+		exec:    cmdDiff,
+		summary: "List changes to a memory region's contents",
+		details: "<region name> [mark]\n" +
+			"            mark|next|prev\n" +
+			"\n" +
+			"List the ranges of a memory region whose contents differ from the data\n" +
+			"it was initialized with: the contents of its input file, or zeros.\n" +
+			"The Memory view is moved to the first changed range, and \"diff next\"\n" +
+			"and \"diff prev\" move it to the others. Ctrl-D in the Memory view\n" +
+			"also moves to the next changed range.\n" +
+			"\n" +
+			"  mark      Capture the contents of all writable regions. Specified\n" +
+			"            after a region name, compare with these contents instead.\n" +
+			"\n" +
+			"Examples:\n" +
+			" diff data\n" +
+			" diff mark\n" +
+			" diff stack mark\n",
+	},
+
+	{
+		names:   []string{"coverage"},
+		min:     2,
+		max:     4,
+		exec:    cmdCoverage,
+		summary: "Collect and save basic block coverage",
+		details: "<start|stop|reset|status>\n" +
+			"                save <filename> [drcov|list]\n" +
+			"\n" +
+			"Control the collection of basic block coverage information.\n" +
+			"Instructions in executed blocks are marked in the Disassembly view.\n" +
+			"\n" +
+			"  start     Begin (or resume) collecting coverage information.\n" +
+			"  stop      Stop collecting coverage information.\n" +
+			"  reset     Discard all collected coverage information.\n" +
+			"  status    Show whether coverage is enabled and the number of blocks.\n" +
+			"  save      Write coverage to <filename>. The default drcov format may\n" +
+			"            be loaded by Lighthouse and Cartographer. The list format\n" +
+			"            contains one block address per line.\n",
 	},
 
 	{
 		names:       []string{"display"},
 		min:         2,
-		max:         3,
+		max:         4,
 		exec:        cmdDisplay,
 		mayTaintMem: true, // Not really taint, but we need to force redraw of Memory window
 		summary:     "Display information about the specified item(s)",
@@ -267,8 +510,212 @@ var cmdList []cmd = []cmd{
 			"\n" +
 			"Available items:\n" +
 			"	breakpoints" +
-			"	memory <address>" +
-			"	mapped [name]\n",
+			"	memory <address> [format]" +
+			"	mapped [name]\n" +
+			"\n" +
+			"Memory formats (cycled via Ctrl-T):\n" +
+			"  hex                 Bytes and ASCII, akin to hexdump -C (default)\n" +
+			"  u16, u32, u64       Hex words, in target endianness\n" +
+			"  i16, i32, i64       Signed decimal words\n" +
+			"  f32, f64            Floating point values\n" +
+			"  ascii               Printable ASCII characters\n" +
+			"  ptr                 One pointer per line, annotated with the symbol or\n" +
+			"                      region it points into, and any string found there\n",
+	},
+
+	{
+		names:   []string{"disasm"},
+		min:     2,
+		max:     4096, // Arbitrary "good enough" value
+		exec:    cmdDisasm,
+		summary: "Move or scroll the Disassembly view",
+		details: "<expression>\n" +
+			"              up|down [count]\n" +
+			"              follow [on|off]\n" +
+			"              break\n" +
+			"\n" +
+			"Browse code in the Disassembly view, which otherwise follows the PC.\n" +
+			"\n" +
+			"  <expression>  Show and highlight the instruction at an address or\n" +
+			"                symbol (See \"help watch\"), and stop following the PC.\n" +
+			"  up, down      Scroll by [count] instructions, or a page by default.\n" +
+			"  follow        Toggle, or turn on or off, following the PC.\n" +
+			"  break         Set a breakpoint on the highlighted instruction, or\n" +
+			"                remove those already set there.\n" +
+			"\n" +
+			"Tab directs the navigation keys to the Disassembly view, or back to the\n" +
+			"Memory view. While the Disassembly view has focus, PgUp/PgDn scroll\n" +
+			"by a page, Ctrl-P/Ctrl-N move the highlight by a line, Ctrl-B toggles\n" +
+			"a breakpoint, Ctrl-F toggles following the PC, and Ctrl-O returns\n" +
+			"to the PC.\n",
+	},
+
+	{
+		names:       []string{"find"},
+		min:         2,
+		max:         4096, // Arbitrary "good enough" value
+		exec:        cmdFind,
+		mayTaintMem: true, // Not really taint, but we need to force redraw of Memory window
+		summary:     "Search memory for a value, string, or byte pattern",
+		details: "[in <region|addr:size>] <pattern>\n" +
+			"            next|prev\n" +
+			"\n" +
+			"Search all mapped memory, or the specified region or address range, for\n" +
+			"<pattern>. The Memory view is moved to the first match, and \"find next\"\n" +
+			"and \"find prev\" move it to the other matches.\n" +
+			"\n" +
+			"<pattern> may be one of:\n" +
+			"  - Any <value> accepted by mw, in target endianness. (See \"help mw\")\n" +
+			"  - {<hex sequence>}, in which '?' matches any hex digit: {de??be?f}\n" +
+			"  - \"<text>\" for an ASCII string, or u\"<text>\" for a UTF-16 string.\n" +
+			"\n" +
+			"Examples:\n" +
+			" find u32(0xdeadbeef)\n" +
+			" find in data \"Hello world\"\n" +
+			" find in 0x10000:0x1000 {00 ?? a0 e3}\n",
+	},
+
+	{
+		names:       []string{"goto"},
+		min:         2,
+		max:         4096, // Arbitrary "good enough" value
+		exec:        cmdGoto,
+		mayTaintMem: true, // Not really taint, but we need to force redraw of Memory window
+		summary:     "Move the Memory view to an address expression",
+		details: "<expression>\n" +
+			"            lock <expression>\n" +
+			"            unlock|back\n" +
+			"\n" +
+			"Move the Memory view and its cursor to the address specified by\n" +
+			"<expression>, which may combine numbers, registers, and symbols via\n" +
+			"+, -, and *. Brackets dereference a pointer: [sp+4]\n" +
+			"\n" +
+			"  lock      Keep the Memory view centered upon <expression>, which is\n" +
+			"            re-evaluated after every command (e.g., to follow sp).\n" +
+			"  unlock    Stop following a locked expression.\n" +
+			"  back      Return to the location prior to the last goto, find,\n" +
+			"            or followed pointer.\n" +
+			"\n" +
+			"Examples:\n" +
+			" goto r4+0x20\n" +
+			" goto [sp]\n" +
+			" goto lock sp\n",
+	},
+
+	{
+		names:       []string{"pane"},
+		min:         2,
+		max:         4096, // Arbitrary "good enough" value
+		exec:        cmdPane,
+		mayTaintMem: true, // Not really taint, but we need to force redraw of Memory window
+		summary:     "Add, remove, or select memory panes",
+		details: "add <name> [expression]\n" +
+			"            remove|select <name>\n" +
+			"            list\n" +
+			"\n" +
+			"Memory panes are additional Memory views, stacked below the main pane.\n" +
+			"Each has its own address, format, locked expression, and highlighting of\n" +
+			"changed data. The goto, find, and \"display memory\" commands and the\n" +
+			"Memory view keys act upon the selected pane, which is marked in its title.\n" +
+			"\n" +
+			"  add       Add a pane showing <expression> (default: the selected\n" +
+			"            pane's cursor) and select it. At most 4 panes may be shown.\n" +
+			"  remove    Remove a pane. The \"main\" pane may not be removed.\n" +
+			"  select    Select a pane. Ctrl-W selects the next pane.\n" +
+			"  list      List each pane and the address it shows.\n" +
+			"\n" +
+			"Examples:\n" +
+			" pane add stack sp\n" +
+			" pane select main\n",
+	},
+
+	{
+		names:   []string{"watch"},
+		min:     2,
+		max:     4096, // Arbitrary "good enough" value
+		exec:    cmdWatch,
+		summary: "Add, remove, or list watched expressions",
+		details: "add <expression>\n" +
+			"             remove <index|all>\n" +
+			"             list\n" +
+			"\n" +
+			"Watched expressions are re-evaluated after each command and shown in the\n" +
+			"Watches view, in which changed values are highlighted. Expressions may\n" +
+			"combine numbers, registers, flags (e.g., cpsr.Z), and symbols via the C\n" +
+			"operators + - * / % & | ^ ~ << >>. Memory may be read via:\n" +
+			"\n" +
+			"  [<expr>]             A pointer-sized value at <expr>\n" +
+			"  [<expr>]:<type>      A value of <type> at <expr>\n" +
+			"  *(<type>*)<expr>     Same as above, as a C-style cast\n" +
+			"\n" +
+			"Types are u8, u16, u32, u64, i8, i16, i32, and i64. Signed values are\n" +
+			"shown in decimal, and (<type>)<expr> truncates a value to <type>.\n" +
+			"\n" +
+			"Examples:\n" +
+			" watch add r0\n" +
+			" watch add [sp+8]:u32\n" +
+			" watch add *(u16*)0x20000010\n" +
+			" watch remove 0\n",
+	},
+
+	{
+		names:        []string{"source"},
+		min:          2,
+		max:          2,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		/* exec assigned later to avoid initialization loop */
+
+		summary: "Run the commands in a script file",
+		details: "<filename>\n" +
+			"\n" +
+			"Run each command in <filename>, one per line. Lines beginning with a\n" +
+			"'#' are treated as comments and blank lines are ignored. Execution of\n" +
+			"the script stops at the first command that fails.\n" +
+			"\n" +
+			"If present, ./" + RcFile + " is run in this manner at startup.\n",
+	},
+
+	{
+		names:   []string{"save-session"},
+		min:     2,
+		max:     2,
+		exec:    cmdSaveSession,
+		summary: "Save the current session to a configuration file",
+		details: "<filename>\n" +
+			"\n" +
+			"Save the architecture, memory regions, register values, breakpoints, and\n" +
+			"ToolSync settings to a .json, .yaml, or .toml file that may later be\n" +
+			"loaded via --config. Memory contents are not saved; use \"dumpmem\" to\n" +
+			"write them to a file.\n",
+	},
+
+	{
+		names:        []string{"script"},
+		min:          2,
+		max:          2,
+		exec:         cmdScript,
+		mayTaintRegs: true,
+		mayTaintMem:  true,
+		summary:      "Run a Starlark script",
+		details: "<filename>\n" +
+			"\n" +
+			"Run a Starlark (Python-like) script with access to the debugger via\n" +
+			"the following built-ins. Functions and variables defined by a script\n" +
+			"remain available to scripts that are run later.\n" +
+			"\n" +
+			scripting.Builtins +
+			"\n" +
+			"Example:\n" +
+			"  def uart_status(access):\n" +
+			"      write_u32(access.address, 0x1)  # Always ready to transmit\n" +
+			"\n" +
+			"  def on_hit(id):\n" +
+			"      print(\"r0 = 0x%x\" % read_reg(\"r0\"))\n" +
+			"      return read_reg(\"r0\") == 0x40\n" +
+			"\n" +
+			"  hook_mem(0x40001000, 4, uart_status, access=\"r\")\n" +
+			"  set_breakpoint(0x10214, on_hit)\n",
 	},
 
 	{
@@ -325,6 +772,29 @@ var cmdList []cmd = []cmd{
 
 // Keep these alphabetical, please!
 
+func cmdAsm(ui *Ui, cmd cmd, args []string) (string, error) {
+	addr, err := ui.dbg.Evaluate(args[1])
+	if err != nil {
+		return "", err
+	}
+
+	p, err := ui.dbg.PatchAsm(addr, strings.Join(args[2:], " "))
+	if err != nil {
+		return "", err
+	}
+
+	return "Applied patch " + p.String(), nil
+}
+
+func cmdBacktrace(ui *Ui, cmd cmd, args []string) (string, error) {
+	frames, err := ui.dbg.Backtrace()
+	if err != nil {
+		return "", err
+	}
+
+	return ui.formatBacktrace(frames, true), nil
+}
+
 func cmdBreak(ui *Ui, cmd cmd, args []string) (string, error) {
 	var addr uint64
 	var err error
@@ -332,7 +802,7 @@ func cmdBreak(ui *Ui, cmd cmd, args []string) (string, error) {
 	if len(args) < 2 {
 		addr = ui.pc
 	} else {
-		addr, err = strconv.ParseUint(args[1], 0, 64)
+		addr, err = ui.dbg.Evaluate(strings.Join(args[1:], " "))
 		if err != nil {
 			return "", err
 		}
@@ -340,8 +810,24 @@ func cmdBreak(ui *Ui, cmd cmd, args []string) (string, error) {
 
 	bp := ui.dbg.SetBreakpoint(addr)
 
-	// FIXME use dbg-supplied address format
-	return fmt.Sprintf("Added breakpoint %d at 0x%08x", bp.ID, bp.Address), nil
+	return fmt.Sprintf("Added breakpoint %d at %s", bp.ID, ui.dbg.FormatAddress(bp.Address)), nil
+}
+
+func cmdCall(ui *Ui, cmd cmd, args []string) (string, error) {
+	// Buffers from the previous call are reused
+	ui.dbg.FreeAll()
+
+	addr, callArgs, err := cmdline.ParseCall(args[1:], ui.dbg)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := ui.dbg.Call(addr, callArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	return cmdline.FormatCallResult(result), nil
 }
 
 func cmdContinue(ui *Ui, cmd cmd, args []string) (string, error) {
@@ -356,10 +842,67 @@ func cmdContinue(ui *Ui, cmd cmd, args []string) (string, error) {
 	return "", nil
 }
 
+func cmdCoverage(ui *Ui, cmd cmd, args []string) (string, error) {
+	what := lowerTrim(args[1])
+
+	if len(args) == 2 && matches("start", what) {
+		ui.dbg.StartCoverage()
+		return "Coverage collection enabled.", nil
+
+	} else if len(args) == 2 && matches("stop", what) {
+		ui.dbg.StopCoverage()
+		return "Coverage collection disabled.", nil
+
+	} else if len(args) == 2 && matches("reset", what) {
+		ui.dbg.ResetCoverage()
+		return "Discarded coverage information.", nil
+
+	} else if len(args) == 2 && matches("status", what) {
+		state := "disabled"
+		if ui.dbg.CoverageEnabled() {
+			state = "enabled"
+		}
+		return fmt.Sprintf("Coverage collection is %s. %d blocks executed.",
+			state, len(ui.dbg.Coverage())), nil
+
+	} else if len(args) >= 3 && matches("save", what) {
+		var format ae.CoverageFormat
+		var err error
+
+		if len(args) == 4 {
+			if format, err = ae.ParseCoverageFormat(args[3]); err != nil {
+				return "", err
+			}
+		}
+
+		f, err := os.Create(args[2])
+		if err != nil {
+			return "", err
+		}
+
+		err = ui.dbg.WriteCoverage(f, format)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Wrote coverage information to %s", args[2]), nil
+	}
+
+	return "", errors.New("Invalid usage. See \"help coverage\".")
+}
+
 func cmdClear(ui *Ui, cmd cmd, args []string) (string, error) {
 	cleared := false
 	alen := len(args)
 
+	if ui.g == nil {
+		return "", errHeadless
+	}
+
 	vCmd, err := ui.g.View(vCommands)
 	if err != nil {
 		return "", err
@@ -392,27 +935,24 @@ func cmdClear(ui *Ui, cmd cmd, args []string) (string, error) {
 func cmdDelete(ui *Ui, cmd cmd, args []string) (string, error) {
 	if len(args) == 1 {
 		ui.dbg.DeleteBreakpointsAt(ui.pc)
-		// FIXME need arch-specific address format
-		return fmt.Sprintf("Removed breakpoints at 0x%08x.", ui.pc), nil
+		return fmt.Sprintf("Removed breakpoints at %s.", ui.dbg.FormatAddress(ui.pc)), nil
 
 	} else if len(args) == 2 && matches("all", args[1]) {
 		ui.dbg.DeleteAllBreakpoints()
 		return "Removed all breakpoints.", nil
 
 	} else if len(args) == 3 && matches("address", args[1]) {
-		addr, err := strconv.ParseUint(args[2], 0, 64)
+		addr, err := ui.dbg.Evaluate(args[2])
 		if err != nil {
-			return "", fmt.Errorf("\"s\" is not a valid breakpoint address.", args[2])
+			return "", err
 		}
 		ui.dbg.DeleteBreakpointsAt(addr)
-
-		// FIXME need arch-specific address format
-		return fmt.Sprintf("Removed breakpoints at 0x%08x.", addr), nil
+		return fmt.Sprintf("Removed breakpoints at %s.", ui.dbg.FormatAddress(addr)), nil
 
 	} else if len(args) == 3 && matches("id", args[1]) {
 		id, err := strconv.ParseInt(args[2], 0, 32)
 		if err != nil {
-			return "", fmt.Errorf("\"s\" is not a valid breakpoint ID.", args[2])
+			return "", fmt.Errorf("\"%s\" is not a valid breakpoint ID.", args[2])
 		}
 
 		ui.dbg.DeleteBreakpoint(int(id))
@@ -422,6 +962,150 @@ func cmdDelete(ui *Ui, cmd cmd, args []string) (string, error) {
 	}
 }
 
+func cmdDiff(ui *Ui, cmd cmd, args []string) (string, error) {
+	var diff ae.RegionDiff
+	var err error
+
+	// Keywords don't apply to regions of the same name
+	if len(args) == 2 && !ui.dbg.IsMapped(args[1]) {
+		switch {
+		case matches("next", args[1]) || matches("prev", args[1]):
+			return ui.diffNext(matches("next", args[1]))
+
+		case matches("mark", args[1]):
+			if ui.mark, err = ui.dbg.Snapshot(); err != nil {
+				return "", err
+			}
+			return "Captured the contents of writable memory regions.", nil
+		}
+	}
+
+	name := args[1]
+
+	switch {
+	case len(args) == 2:
+		diff, err = ui.dbg.DiffRegion(name)
+	case len(args) == 3 && matches("mark", args[2]):
+		if ui.mark == nil {
+			return "", errors.New("No contents have been captured. Run \"diff mark\" first.")
+		}
+		diff, err = ui.dbg.DiffRegionSnapshot(name, ui.mark)
+	default:
+		return "", errors.New("Invalid usage. See \"help diff\".")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	ui.mem.changes = diff.Ranges
+	ui.mem.changeIdx = 0
+
+	if len(diff.Ranges) == 0 {
+		return fmt.Sprintf("No changes to \"%s\".", name), nil
+	}
+
+	ret := fmt.Sprintf("%d byte(s) changed in %d range(s).\n", diff.Changed(), len(diff.Ranges))
+
+	for i, c := range diff.Ranges {
+		if i == maxFindListed {
+			ret += fmt.Sprintf("  ... and %d more\n", len(diff.Ranges)-i)
+			break
+		}
+		ret += fmt.Sprintf("  %s  %s -> %s\n", ui.dbg.FormatAddress(c.Address),
+			abbreviateHex(c.Original), abbreviateHex(c.Current))
+	}
+
+	if ui.g == nil {
+		return ret, nil
+	}
+
+	if err := ui.memGoto(diff.Ranges[0].Address); err != nil {
+		return ret, err
+	}
+	return ret, ui.redrawMem()
+}
+
+// Move the Memory view to the next or previous range listed by the last diff
+func (ui *Ui) diffNext(forward bool) (string, error) {
+	n := len(ui.mem.changes)
+	if n == 0 {
+		return "", errors.New("There are no changed ranges. Run \"diff <region>\" first.")
+	}
+
+	if forward {
+		ui.mem.changeIdx = (ui.mem.changeIdx + 1) % n
+	} else {
+		ui.mem.changeIdx = (ui.mem.changeIdx + n - 1) % n
+	}
+
+	addr := ui.mem.changes[ui.mem.changeIdx].Address
+	if err := ui.memGoto(addr); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Change %d of %d at %s", ui.mem.changeIdx+1, n, ui.dbg.FormatAddress(addr)),
+		ui.redrawMem()
+}
+
+// Hex-encode `data`, eliding all but the first few bytes of long sequences
+func abbreviateHex(data []byte) string {
+	const maxBytes = 8
+	if len(data) > maxBytes {
+		return fmt.Sprintf("%s... (%d bytes)", hex.EncodeToString(data[:maxBytes]), len(data))
+	}
+	return hex.EncodeToString(data)
+}
+
+func cmdDisasm(ui *Ui, cmd cmd, args []string) (string, error) {
+	if ui.g == nil {
+		return "", errHeadless
+	}
+
+	switch {
+	case len(args) <= 3 && (matches("up", args[1]) || matches("down", args[1])):
+		lines := ui.disasmViewLen() - 1
+		if len(args) == 3 {
+			count, err := strconv.ParseInt(args[2], 0, 64)
+			if err != nil || count <= 0 {
+				return "", fmt.Errorf("\"%s\" is not a valid line count.", args[2])
+			}
+			lines = count
+		}
+
+		if matches("up", args[1]) {
+			lines = -lines
+		}
+		return "", ui.disasmScroll(lines)
+
+	case len(args) <= 3 && matches("follow", args[1]):
+		follow := ui.disasm.browse
+		if len(args) == 3 {
+			follow = lowerTrim(args[2]) == "on"
+			if !follow && lowerTrim(args[2]) != "off" {
+				return "", errors.New("Expected \"on\" or \"off\".")
+			}
+		}
+
+		ui.disasmFollow(follow)
+		if follow {
+			return "Following the PC.", nil
+		}
+		return "Not following the PC.", nil
+
+	case len(args) == 2 && matches("break", args[1]):
+		return ui.disasmToggleBreakpoint(), nil
+	}
+
+	addr, err := ui.dbg.Evaluate(strings.Join(args[1:], " "))
+	if err != nil {
+		return "", err
+	}
+
+	ui.disasmGoto(addr)
+	return "", nil
+}
+
 func cmdDisplay(ui *Ui, cmd cmd, args []string) (string, error) {
 	var ret string
 	what := lowerTrim(args[1])
@@ -466,26 +1150,18 @@ func cmdDisplay(ui *Ui, cmd cmd, args []string) (string, error) {
 			return "", fmt.Errorf("A required <address> argument was not provided.")
 		}
 
-		newAddr, err := strconv.ParseUint(args[2], 0, 64)
+		newAddr, err := ui.dbg.Evaluate(args[2])
 		if err != nil {
-			return "", fmt.Errorf("\"%s\" is not a valid memory address.", args[2])
-		}
-
-		if view, err := ui.g.View(vMem); err != nil {
 			return "", err
-		} else {
-			ui.mem.addr = newAddr
-			ui.mem.pdata = []byte{}
-
-			// FIXME This shouldn't require a double-kick to prevent it from
-			//		 incorrectly highlighting changes when we point the view at
-			//		 a different memory location
-			ui.updateMemView(view)
-			ui.mem.pdata = []byte{}
+		}
 
-			return "", ui.updateMemView(view)
+		if len(args) > 3 {
+			if ui.mem.format, err = parseMemFormat(args[3]); err != nil {
+				return "", err
+			}
 		}
-		return "", nil
+
+		return "", ui.showMemory(newAddr)
 	}
 
 	return "", fmt.Errorf("\"%s\" is not a valid item.", args[1])
@@ -496,6 +1172,15 @@ func cmdDumpMem(ui *Ui, cmd cmd, args []string) (string, error) {
 	var name, filename string
 	var err error
 
+	if len(args) == 2 {
+		name = args[1]
+		if err = ui.dbg.WriteRegionOutput(name); err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("Wrote contents of \"%s\" region to its output file\n", name), nil
+	}
+
 	filename = args[1]
 
 	if len(args) == 3 {
@@ -508,14 +1193,14 @@ func cmdDumpMem(ui *Ui, cmd cmd, args []string) (string, error) {
 
 	}
 
-	addr, err = strconv.ParseUint(args[2], 0, 64)
+	addr, err = ui.dbg.Evaluate(args[2])
 	if err != nil {
-		return "", fmt.Errorf("Invalid address (%s)", args[2])
+		return "", err
 	}
 
-	size, err = strconv.ParseUint(args[3], 0, 64)
+	size, err = ui.dbg.Evaluate(args[3])
 	if err != nil {
-		return "", fmt.Errorf("Invalid size (%s)", args[3])
+		return "", err
 	}
 
 	err = ui.dbg.DumpMem(filename, addr, size)
@@ -523,7 +1208,115 @@ func cmdDumpMem(ui *Ui, cmd cmd, args []string) (string, error) {
 		return "", err
 	}
 
-	return fmt.Sprintf("Wrote contents of [0x%08x - 0x%08x] to %s\n", addr, addr+size-1, filename), nil
+	return fmt.Sprintf("Wrote contents of [%s - %s] to %s\n",
+		ui.dbg.FormatAddress(addr), ui.dbg.FormatAddress(addr+size-1), filename), nil
+}
+
+func cmdFind(ui *Ui, cmd cmd, args []string) (string, error) {
+	var scope string
+	var ret string
+
+	if len(args) == 2 && (matches("next", args[1]) || matches("prev", args[1])) {
+		return ui.findNext(matches("next", args[1]))
+	}
+
+	args = args[1:]
+	if len(args) >= 3 && args[0] == "in" {
+		scope = args[1]
+		args = args[2:]
+	}
+
+	endianness, err := ui.dbg.Endianness()
+	if err != nil {
+		return "", err
+	}
+
+	// Strings may contain spaces
+	pattern, err := parseSearchPattern(strings.Join(args, " "), endianness)
+	if err != nil {
+		return "", err
+	}
+
+	found, err := ui.dbg.SearchMem(pattern, scope)
+	if err != nil {
+		return "", err
+	}
+
+	ui.mem.found = found
+	ui.mem.foundIdx = 0
+
+	if len(found) == 0 {
+		return "No matches found.", nil
+	} else if len(found) >= ae.MaxSearchResults {
+		ret = fmt.Sprintf("Found at least %d matches.\n", len(found))
+	} else {
+		ret = fmt.Sprintf("Found %d match(es).\n", len(found))
+	}
+
+	for i, addr := range found {
+		if i == maxFindListed {
+			ret += fmt.Sprintf("  ... and %d more\n", len(found)-i)
+			break
+		}
+		ret += "  " + ui.dbg.FormatAddress(addr) + "\n"
+	}
+
+	if ui.g == nil {
+		return ret, nil
+	}
+
+	return ret, ui.memGoto(found[0])
+}
+
+// Move the Memory view to the next or previous result of the last search
+func (ui *Ui) findNext(forward bool) (string, error) {
+	n := len(ui.mem.found)
+	if n == 0 {
+		return "", errors.New("There are no search results. Run \"find <pattern>\" first.")
+	}
+
+	if forward {
+		ui.mem.foundIdx = (ui.mem.foundIdx + 1) % n
+	} else {
+		ui.mem.foundIdx = (ui.mem.foundIdx + n - 1) % n
+	}
+
+	addr := ui.mem.found[ui.mem.foundIdx]
+
+	return fmt.Sprintf("Match %d of %d at %s", ui.mem.foundIdx+1, n, ui.dbg.FormatAddress(addr)),
+		ui.memGoto(addr)
+}
+
+func cmdFinish(ui *Ui, cmd cmd, args []string) (string, error) {
+	return runResult(ui.dbg.StepOut())
+}
+
+func cmdGoto(ui *Ui, cmd cmd, args []string) (string, error) {
+	if ui.g == nil {
+		return "", errHeadless
+	}
+
+	if len(args) == 2 && matches("unlock", args[1]) {
+		ui.mem.lock = ""
+		return "", nil
+	} else if len(args) == 2 && matches("back", args[1]) {
+		return "", ui.memBack()
+	} else if len(args) >= 3 && args[1] == "lock" {
+		expr := strings.Join(args[2:], " ")
+		if _, err := ui.dbg.Evaluate(expr); err != nil {
+			return "", err
+		}
+
+		ui.mem.lock = expr
+		return "Memory view locked to " + expr, nil
+	}
+
+	addr, err := ui.dbg.Evaluate(strings.Join(args[1:], " "))
+	if err != nil {
+		return "", err
+	}
+
+	return "", ui.memGoto(addr)
 }
 
 func cmdHelp(ui *Ui, cmd cmd, args []string) (string, error) {
@@ -544,6 +1337,14 @@ func cmdHelp(ui *Ui, cmd cmd, args []string) (string, error) {
 		helpText += "     This is useful when stepping through a program.\n"
 		helpText += " - Only a subset of command names is actually required.\n"
 		helpText += "     Commands are matched in the order presented above.\n"
+		helpText += " - Memory view keys: PgUp/PgDn scroll by a page, Ctrl-P/Ctrl-N move\n"
+		helpText += "     the cursor by a line, Ctrl-B/Ctrl-F move it by a word, Ctrl-G\n"
+		helpText += "     follows the pointer under the cursor, Ctrl-O goes back, and\n"
+		helpText += "     Ctrl-T cycles the display format. Ctrl-W selects the next\n"
+		helpText += "     memory pane. (See \"help pane\") Ctrl-D moves to the next\n"
+		helpText += "     range listed by the diff command.\n"
+		helpText += " - Tab directs these keys to the Disassembly view and back.\n"
+		helpText += "     (See \"help disasm\")\n"
 
 		return helpText, nil
 	} else {
@@ -575,15 +1376,18 @@ func cmdMemWrite(ui *Ui, cmd cmd, args []string) (string, error) {
 		return "", err
 	}
 
-	addr, err := strconv.ParseUint(args[1], 0, 64)
+	addr, err := ui.dbg.Evaluate(args[1])
 	if err != nil {
-		return "", fmt.Errorf("\"%s\" is not a valid address.", args[1])
+		return "", err
 	}
 
 	for _, value := range args[2:] {
 		bytes, err := parseValue(value, endianness)
 		if err != nil {
-			return "", err
+			// Fall back to writing the value of an expression as a pointer
+			if bytes, err = ui.pointerBytes(value, endianness); err != nil {
+				return "", err
+			}
 		}
 
 		data = append(data, bytes...)
@@ -609,6 +1413,137 @@ func cmdMemUnmap(ui *Ui, cmd cmd, args []string) (string, error) {
 	return ret, nil
 }
 
+func cmdNext(ui *Ui, cmd cmd, args []string) (string, error) {
+	var err error
+	var count int64 = 1
+
+	if len(args) > 1 {
+		count, err = strconv.ParseInt(args[1], 0, 64)
+		if err != nil || count <= 0 {
+			return "", fmt.Errorf("\"%s\" is not a valid step size.", args[1])
+		}
+	}
+
+	for ; count > 0; count-- {
+		exception, err := ui.dbg.StepOver()
+		if err != nil || ui.dbg.StopReason() != ae.StopStepComplete {
+			return runResult(exception, err)
+		}
+	}
+
+	return "", nil
+}
+
+func cmdPane(ui *Ui, cmd cmd, args []string) (string, error) {
+	var ret string
+
+	if ui.g == nil {
+		return "", errHeadless
+	}
+
+	if len(args) == 2 && matches("list", args[1]) {
+		for _, m := range ui.panes {
+			selected := " "
+			if m == ui.mem {
+				selected = "*"
+			}
+
+			ret += fmt.Sprintf("%s %-12s %s  %s", selected, m.name, ui.dbg.FormatAddress(m.cursor),
+				memFormats[m.format].name)
+			if m.lock != "" {
+				ret += "  (locked to " + m.lock + ")"
+			}
+			ret += "\n"
+		}
+		return ret, nil
+	} else if len(args) < 3 {
+		return "", errors.New("Invalid usage. See \"help pane\".")
+	}
+
+	name := args[2]
+
+	switch {
+	case matches("add", args[1]):
+		addr := ui.mem.cursor
+		if len(args) > 3 {
+			var err error
+			if addr, err = ui.dbg.Evaluate(strings.Join(args[3:], " ")); err != nil {
+				return "", err
+			}
+		}
+		return "", ui.addMemPane(name, addr, ui.mem.format)
+
+	case len(args) > 3:
+		return "", errors.New("Invalid usage. See \"help pane\".")
+
+	case matches("remove", args[1]):
+		return "", ui.removeMemPane(name)
+
+	case matches("select", args[1]):
+		m, err := ui.memPane(name)
+		if err != nil {
+			return "", err
+		}
+		ui.mem = m
+		return "", nil
+	}
+
+	return "", fmt.Errorf("\"%s\" is not a valid pane operation.", args[1])
+}
+
+func cmdPatch(ui *Ui, cmd cmd, args []string) (string, error) {
+	var ret string
+
+	switch {
+	case len(args) == 2 && matches("list", args[1]):
+		patches := ui.dbg.Patches()
+		if len(patches) == 0 {
+			return "No patches have been applied.", nil
+		}
+
+		for _, p := range patches {
+			ret += p.String() + "\n"
+		}
+		return ret, nil
+
+	case len(args) == 3 && matches("revert", args[1]):
+		if matches("all", args[2]) {
+			return "Reverted all patches.", ui.dbg.RevertAllPatches()
+		}
+
+		id, err := strconv.ParseUint(args[2], 0, 32)
+		if err != nil {
+			return "", fmt.Errorf("\"%s\" is not a valid patch ID.", args[2])
+		}
+		return "", ui.dbg.RevertPatch(int(id))
+
+	case len(args) == 3 && matches("export", args[1]):
+		f, err := os.Create(args[2])
+		if err != nil {
+			return "", err
+		}
+
+		if err = ui.dbg.WritePatches(f); err != nil {
+			f.Close()
+			return "", err
+		}
+
+		if err = f.Close(); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Wrote %d patch(es) to %s", len(ui.dbg.Patches()), args[2]), nil
+
+	case len(args) == 3 && matches("load", args[1]):
+		count := len(ui.dbg.Patches())
+		if err := ui.dbg.LoadPatchFile(args[2]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Applied %d patch(es) from %s", len(ui.dbg.Patches())-count, args[2]), nil
+	}
+
+	return "", errors.New("Invalid usage. See \"help patch\".")
+}
+
 func cmdQuit(ui *Ui, cmd cmd, args []string) (string, error) {
 	ui.quit = true
 	return "", nil
@@ -622,13 +1557,20 @@ func cmdRegWrite(ui *Ui, cmd cmd, args []string) (string, error) {
 		return "", err
 	}
 
-	bytes, err := parseValue(args[2], endianness)
-	if err != nil {
-		return "", fmt.Errorf("\"%s\" is not a valid register value.", args[2])
+	valStr := strings.Join(args[2:], " ")
+
+	// Expressions take precedence over the other forms accepted by mw
+	if regVal, err = ui.dbg.Evaluate(valStr); err == nil {
+		return "", ui.dbg.WriteRegByName(args[1], regVal)
+	}
+
+	bytes, valueErr := parseValue(valStr, endianness)
+	if valueErr != nil {
+		return "", err
 	}
 
 	if len(bytes) > 8 {
-		return "", fmt.Errorf("\"%s\" exceeds the maximum register size.", args[2])
+		return "", fmt.Errorf("\"%s\" exceeds the maximum register size.", valStr)
 	} else if len(bytes) < 8 {
 		padLen := 8 - len(bytes)
 		padding := make([]byte, padLen)
@@ -648,6 +1590,33 @@ func cmdReset(ui *Ui, cmd cmd, args []string) (string, error) {
 	return "", ui.dbg.Reset(true)
 }
 
+func cmdSaveSession(ui *Ui, cmd cmd, args []string) (string, error) {
+	cfg, err := cmdline.SessionConfig(*ui.arch, ui.dbg)
+	if err != nil {
+		return "", err
+	}
+
+	if err = cfg.Save(args[1]); err != nil {
+		return "", err
+	}
+
+	return "Session saved to " + args[1], nil
+}
+
+func cmdScript(ui *Ui, cmd cmd, args []string) (string, error) {
+	return "", ui.interpreter().RunFile(args[1])
+}
+
+func cmdSource(ui *Ui, cmd cmd, args []string) (string, error) {
+	var outputs []string
+
+	err := ui.RunScript(args[1], func(output string) {
+		outputs = append(outputs, output)
+	})
+
+	return strings.Join(outputs, "\n"), err
+}
+
 func cmdStep(ui *Ui, cmd cmd, args []string) (string, error) {
 	var err error
 	var count int64 = 1
@@ -670,3 +1639,49 @@ func cmdStep(ui *Ui, cmd cmd, args []string) (string, error) {
 
 	return "", nil
 }
+
+func cmdUntil(ui *Ui, cmd cmd, args []string) (string, error) {
+	addr, err := ui.dbg.Evaluate(strings.Join(args[1:], " "))
+	if err != nil {
+		return "", err
+	}
+
+	return runResult(ui.dbg.RunTo(addr))
+}
+
+func cmdWatch(ui *Ui, cmd cmd, args []string) (string, error) {
+	var ret string
+
+	switch {
+	case len(args) == 2 && matches("list", args[1]):
+		if len(ui.watches.list) == 0 {
+			return "No expressions are being watched.", nil
+		}
+
+		for i, w := range ui.watches.list {
+			ret += fmt.Sprintf("%2d  %s = %s\n", i, w.expr, ui.evaluateWatch(w))
+		}
+		return ret, nil
+
+	case len(args) >= 3 && matches("add", args[1]):
+		w, err := ui.addWatch(strings.Join(args[2:], " "))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", w.expr, w.curr), nil
+
+	case len(args) == 3 && matches("remove", args[1]):
+		if matches("all", args[2]) {
+			ui.watches.list = nil
+			return "Removed all watches.", nil
+		}
+
+		i, err := strconv.ParseUint(args[2], 0, 32)
+		if err != nil {
+			return "", fmt.Errorf("\"%s\" is not a valid watch index.", args[2])
+		}
+		return "", ui.removeWatch(int(i))
+	}
+
+	return "", errors.New("Invalid usage. See \"help watch\".")
+}
@@ -12,6 +12,12 @@ func (ui *Ui) handleInput(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modif
 	atLeftBound := curX <= 2
 
 	switch {
+	case ch == 0 && key == gocui.KeyTab:
+		ui.disasm.focus = !ui.disasm.focus
+	case ch == 0 && ui.disasm.focus && ui.handleDisasmKey(key):
+		// Disassembly view navigation
+	case ch == 0 && ui.handleMemKey(key):
+		// Memory view navigation
 	case ch != 0 && mod == 0:
 		v.EditWrite(ch)
 	case key == gocui.KeySpace:
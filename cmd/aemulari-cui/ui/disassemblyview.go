@@ -3,6 +3,7 @@ package ui
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jroimartin/gocui"
 
@@ -12,6 +13,10 @@ import (
 type DisassemblyInfo struct {
 	curr DisassemblyList
 	prev DisassemblyList
+
+	browse bool   // Stay where the view was moved to, rather than following the PC
+	cursor uint64 // Address of the highlighted instruction
+	focus  bool   // Navigation keys are directed to the Disassembly view
 }
 
 type DisassemblyList struct {
@@ -56,8 +61,16 @@ func (ui Ui) getPcSymbolAt(addr uint64) string {
 	return " "
 }
 
+func (ui Ui) getCoverageSymbolAt(addr uint64) string {
+	if ui.dbg.Covered(addr) {
+		return ui.theme.CoveredInstructionSymbol()
+	}
+	return " "
+}
+
 func (ui Ui) getLineAnnotations(addr uint64) string {
 	annotations := ui.getBpSymbolAt(addr)
+	annotations += ui.getCoverageSymbolAt(addr)
 	annotations += ui.getPcSymbolAt(addr)
 	annotations += " "
 	return annotations
@@ -73,12 +86,23 @@ func (ui *Ui) updateDisasmView(view *gocui.View) error {
 		return errors.New("Disassembly view not large enough to draw")
 	}
 
-	hasPc, _ := ui.disasm.curr.Contains(ui.pc)
-	if !hasPc {
-		ui.disasm.curr.addr = ui.pc
+	if !ui.disasm.browse {
+		hasPc, _ := ui.disasm.curr.Contains(ui.pc)
+		if !hasPc {
+			ui.disasm.curr.addr = ui.pc
+		}
+		ui.disasm.cursor = ui.pc
 	}
 
-	// Always re-read in case of self-modifying code
+	if ui.disasm.focus {
+		view.Title = vDisasm + "[focus] "
+	}
+	if ui.disasm.browse {
+		view.Title += "[browsing] "
+	}
+
+	// Always re-read in case of self-modifying code. Decoded instructions are
+	// cached by the debugger until overwritten, so this remains inexpensive.
 	ui.disasm.curr.entries, err = ui.dbg.DisassembleAt(ui.disasm.curr.addr, uint64(height))
 	if err != nil {
 		return err
@@ -95,24 +119,208 @@ func (ui *Ui) updateDisasmView(view *gocui.View) error {
 
 	view.Clear()
 
+	// FIXME Get this from ui.dbg
+	addrFmt := "%08x"
+
 	for i, e := range ui.disasm.curr.entries {
 		annotation := ui.getLineAnnotations(e.AddressU64)
 
+		address := ui.theme.ColorAddress(addrFmt, e.AddressU64)
+		if (ui.disasm.browse || ui.disasm.focus) && e.AddressU64 == ui.disasm.cursor {
+			address = ui.theme.ColorCursor(fmt.Sprintf(addrFmt, e.AddressU64))
+		}
+
 		if e.Equals(ui.disasm.prev.entries[i]) {
-			// FIXME Get this from ui.dbg
-			addrFmt := "%08x"
-			line = fmt.Sprintf("%s <%s>  %s %s\n",
-				ui.theme.ColorAddress(addrFmt, e.AddressU64),
+			line = fmt.Sprintf("%s <%s>  %s %s",
+				address,
 				ui.theme.ColorOpcode(e.Opcode),
 				ui.theme.ColorMnemonic(e.Mnemonic),
 				ui.theme.ColorOperands(e.Operands))
 		} else {
-			line = fmt.Sprintf("%s <%s>  %s %s\n", e.Address, e.Opcode, e.Mnemonic, e.Operands)
+			line = fmt.Sprintf("%s <%s>  %s %s", e.Address, e.Opcode, e.Mnemonic, e.Operands)
 			line = ui.theme.ColorModifiedInstruction(line)
 		}
 
-		fmt.Fprintf(view, annotation+line)
+		if e.AddressU64 == ui.pc {
+			line += ui.theme.ColorPreview(ui.instrPreview())
+		}
+
+		fmt.Fprint(view, annotation+line+"\n")
+	}
+
+	return nil
+}
+
+// Describe the expected effect of the instruction at the PC: whether its
+// condition passes, the memory it will access, and the target of a branch
+// to an address held in a register.
+func (ui *Ui) instrPreview() string {
+	var notes []string
+
+	p, err := ui.dbg.PreviewInstruction()
+	if err != nil {
+		return ""
+	}
+
+	if p.Condition != "" && p.Executes {
+		notes = append(notes, p.Condition+": executes")
+	} else if p.Condition != "" {
+		notes = append(notes, p.Condition+": skipped")
+	}
+
+	for _, a := range p.Accesses {
+		size := a.Operand.Size
+		if size > ui.dbg.PointerSize() {
+			size = ui.dbg.PointerSize()
+		}
+
+		value := "??"
+		if a.Readable {
+			value = fmt.Sprintf("0x%0*x", int(size*2), a.Value)
+		}
+		notes = append(notes, fmt.Sprintf("[0x%08x] = %s", a.Address, value))
+	}
+
+	if p.HasTarget && p.Instr.Detail.TargetReg != "" {
+		notes = append(notes, fmt.Sprintf("-> 0x%08x", p.Target))
+	}
+
+	if len(notes) == 0 {
+		return ""
+	}
+	return "  ; " + strings.Join(notes, ", ")
+}
+
+// Returns the number of instructions shown in the Disassembly view
+func (ui *Ui) disasmViewLen() int64 {
+	if view, err := ui.g.View(vDisasm); err == nil {
+		if _, height := view.Size(); height > 0 {
+			return int64(height)
+		}
+	}
+	return 1
+}
+
+// Stop following the PC and show the instruction at `addr`
+func (ui *Ui) disasmGoto(addr uint64) {
+	addr = ui.dbg.InstructionAddress(addr)
+
+	ui.disasm.browse = true
+	ui.disasm.curr.addr = addr
+	ui.disasm.cursor = addr
+}
+
+// Resume (or stop) following the PC
+func (ui *Ui) disasmFollow(follow bool) {
+	ui.disasm.browse = !follow
+	if follow {
+		ui.disasm.curr.addr = ui.pc
+	}
+}
+
+// Returns the address of the instruction `lines` instructions before
+// (if negative) or after `addr`
+func (ui *Ui) disasmOffset(addr uint64, lines int64) (uint64, error) {
+	if lines < 0 {
+		instrs, err := ui.dbg.DisassembleBefore(addr, uint64(-lines))
+		if err != nil || len(instrs) == 0 {
+			return addr, err
+		}
+		return instrs[0].AddressU64, nil
+	}
+
+	instrs, err := ui.dbg.DisassembleAt(addr, uint64(lines)+1)
+	if err != nil || len(instrs) == 0 {
+		return addr, err
+	}
+	return instrs[len(instrs)-1].AddressU64, nil
+}
+
+// Scroll the Disassembly view by `lines` instructions, keeping the cursor
+// within the view.
+func (ui *Ui) disasmScroll(lines int64) error {
+	addr, err := ui.disasmOffset(ui.disasm.curr.addr, lines)
+	if err != nil {
+		return err
+	}
+
+	ui.disasm.browse = true
+	ui.disasm.curr.addr = addr
+
+	if ui.disasm.cursor < addr {
+		ui.disasm.cursor = addr
+	} else if last, err := ui.disasmOffset(addr, ui.disasmViewLen()-1); err == nil && ui.disasm.cursor > last {
+		ui.disasm.cursor = last
+	}
+
+	return nil
+}
+
+// Move the cursor by `lines` instructions, scrolling as needed
+func (ui *Ui) disasmMoveCursor(lines int64) error {
+	cursor, err := ui.disasmOffset(ui.disasm.cursor, lines)
+	if err != nil {
+		return err
+	}
+
+	ui.disasm.browse = true
+	ui.disasm.cursor = cursor
+
+	if cursor < ui.disasm.curr.addr {
+		ui.disasm.curr.addr = cursor
+	} else if last, err := ui.disasmOffset(ui.disasm.curr.addr, ui.disasmViewLen()-1); err == nil && cursor > last {
+		return ui.disasmScroll(lines)
 	}
 
 	return nil
 }
+
+// Set a breakpoint at the highlighted instruction, or remove any that
+// are already set there.
+func (ui *Ui) disasmToggleBreakpoint() string {
+	addr := ui.disasm.cursor
+
+	if len(ui.dbg.GetBreakpointsAt(addr)) > 0 {
+		ui.dbg.DeleteBreakpointsAt(addr)
+		return "Removed breakpoint(s) at " + ui.dbg.FormatAddress(addr)
+	}
+
+	bp := ui.dbg.SetBreakpoint(addr)
+	return fmt.Sprintf("Added breakpoint %d at %s", bp.ID, ui.dbg.FormatAddress(bp.Address))
+}
+
+// Handle Disassembly view navigation keys, while the view has focus.
+// Returns false if the key is not one of them.
+func (ui *Ui) handleDisasmKey(key gocui.Key) bool {
+	var err error
+
+	page := ui.disasmViewLen() - 1
+	if page < 1 {
+		page = 1
+	}
+
+	switch key {
+	case gocui.KeyPgup:
+		err = ui.disasmScroll(-page)
+	case gocui.KeyPgdn:
+		err = ui.disasmScroll(page)
+	case gocui.KeyCtrlP:
+		err = ui.disasmMoveCursor(-1)
+	case gocui.KeyCtrlN:
+		err = ui.disasmMoveCursor(1)
+	case gocui.KeyCtrlB:
+		ui.appendConsole("\n" + ui.disasmToggleBreakpoint())
+	case gocui.KeyCtrlF:
+		ui.disasmFollow(ui.disasm.browse)
+	case gocui.KeyCtrlO:
+		ui.disasmFollow(true)
+	default:
+		return false
+	}
+
+	if err != nil {
+		ui.appendConsole("\n" + ui.theme.ErrorMessage(err))
+	}
+
+	return true
+}
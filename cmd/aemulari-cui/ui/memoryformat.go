@@ -0,0 +1,208 @@
+package ui
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	ae "../../../aemulari.v0"
+)
+
+// A Memory view display format
+type memFormat struct {
+	name string
+	size uint64 // Size of each value, in bytes
+	kind byte   // x: hexdump, u: hex words, i: signed decimal, f: float, a: ASCII, p: pointers
+}
+
+// Formats, in the order they are cycled through via Ctrl-T
+var memFormats = []memFormat{
+	{name: "hex", size: 1, kind: 'x'},
+	{name: "u16", size: 2, kind: 'u'},
+	{name: "u32", size: 4, kind: 'u'},
+	{name: "u64", size: 8, kind: 'u'},
+	{name: "i16", size: 2, kind: 'i'},
+	{name: "i32", size: 4, kind: 'i'},
+	{name: "i64", size: 8, kind: 'i'},
+	{name: "f32", size: 4, kind: 'f'},
+	{name: "f64", size: 8, kind: 'f'},
+	{name: "ascii", size: 1, kind: 'a'},
+	{name: "ptr", kind: 'p'},
+}
+
+// Maximum number of characters of a string shown in pointer annotations
+const ptrStringLen = 24
+
+// Return the index of the format named `name`
+func parseMemFormat(name string) (int, error) {
+	for i, f := range memFormats {
+		if f.name == lowerTrim(name) {
+			return i, nil
+		}
+	}
+
+	var names []string
+	for _, f := range memFormats {
+		names = append(names, f.name)
+	}
+
+	return 0, fmt.Errorf("\"%s\" is not a valid format. Valid formats: %s",
+		name, strings.Join(names, ", "))
+}
+
+// Returns the number of bytes shown on each line of a memory pane
+func (ui *Ui) memLineSize(m *MemInfo) uint64 {
+	switch memFormats[m.format].kind {
+	case 'a':
+		return 64
+	case 'p':
+		return ui.dbg.PointerSize()
+	default:
+		return 16
+	}
+}
+
+// Read an unsigned value of `size` bytes from `data`
+func decodeValue(data []byte, size uint64, e ae.Endianness) uint64 {
+	word := make([]byte, 8)
+
+	if e == ae.BigEndian {
+		copy(word[8-size:], data[:size])
+		return binary.BigEndian.Uint64(word)
+	}
+
+	copy(word, data[:size])
+	return binary.LittleEndian.Uint64(word)
+}
+
+// Format a single value per the Memory view's format
+func formatValue(f memFormat, value uint64) string {
+	bits := f.size * 8
+
+	switch f.kind {
+	case 'i':
+		// Sign-extend the value
+		signed := int64(value<<(64-bits)) >> (64 - bits)
+		width := map[uint64]int{2: 6, 4: 11, 8: 20}[f.size]
+		return fmt.Sprintf("%*d", width, signed)
+
+	case 'f':
+		if f.size == 4 {
+			return fmt.Sprintf("%13.6g", math.Float32frombits(uint32(value)))
+		}
+		return fmt.Sprintf("%23.15g", math.Float64frombits(value))
+
+	default:
+		return fmt.Sprintf("%0*x", int(f.size*2), value)
+	}
+}
+
+// Returns a description of the location `value` points to, if it falls
+// within a mapped region: a symbol or region name and offset, followed by
+// the string at that location, if any.
+func (ui *Ui) describePointer(value uint64) string {
+	var desc string
+
+	if name, found := ui.dbg.SymbolAt(value); found {
+		desc = name
+	} else {
+		for _, r := range ui.dbg.Mapped() {
+			base, size := r.Region()
+			if value >= base && value-base < size {
+				desc = fmt.Sprintf("%s+0x%x", r.Name(), value-base)
+				break
+			}
+		}
+	}
+
+	if desc == "" {
+		return ""
+	}
+
+	// Show the string pointed to, if it's at least a few characters long
+	data, err := ui.dbg.ReadMem(value, ptrStringLen)
+	if err != nil {
+		return desc
+	}
+
+	n := 0
+	for n < len(data) && data[n] <= unicode.MaxASCII && unicode.IsPrint(rune(data[n])) {
+		n++
+	}
+
+	if n >= 4 {
+		desc += fmt.Sprintf(" \"%s\"", data[:n])
+	}
+
+	return desc
+}
+
+// Render memory in any format other than the hexdump
+func (ui *Ui) formatMem(addrFmt string, m MemInfo) string {
+	var dump string
+
+	f := memFormats[m.format]
+	lineSize := ui.memLineSize(&m)
+	ptrSize := ui.dbg.PointerSize()
+
+	endianness, err := ui.dbg.Endianness()
+	if err != nil {
+		return err.Error()
+	}
+
+	// Highlight values under the cursor, or that have changed
+	colorize := func(str, prev string, addr, size uint64) string {
+		if m.name == ui.mem.name && addr < m.cursor+ptrSize && m.cursor < addr+size {
+			return ui.theme.ColorCursor(str)
+		}
+		return ui.theme.ColorIfStringsDiffer(str, prev)
+	}
+
+	count := uint64(len(m.data))
+	for i := uint64(0); i+lineSize <= count; i += lineSize {
+		line := " " + ui.theme.ColorAddress(addrFmt, m.addr+i) + "  "
+
+		switch f.kind {
+		case 'a':
+			for j := i; j < i+lineSize; j++ {
+				str, prev := ".", "."
+				if m.data[j] <= unicode.MaxASCII && unicode.IsPrint(rune(m.data[j])) {
+					str = string(rune(m.data[j]))
+				}
+				if m.pdata[j] <= unicode.MaxASCII && unicode.IsPrint(rune(m.pdata[j])) {
+					prev = string(rune(m.pdata[j]))
+				}
+				if m.data[j] != m.pdata[j] && str == prev {
+					prev = ""
+				}
+				line += colorize(str, prev, m.addr+j, 1)
+			}
+
+		case 'p':
+			value := decodeValue(m.data[i:], ptrSize, endianness)
+			prev := decodeValue(m.pdata[i:], ptrSize, endianness)
+			str := fmt.Sprintf("%0*x", int(ptrSize*2), value)
+			prevStr := fmt.Sprintf("%0*x", int(ptrSize*2), prev)
+			line += colorize(str, prevStr, m.addr+i, ptrSize)
+
+			if desc := ui.describePointer(value); desc != "" {
+				line += "  -> " + desc
+			}
+
+		default:
+			var values []string
+			for j := i; j+f.size <= i+lineSize; j += f.size {
+				str := formatValue(f, decodeValue(m.data[j:], f.size, endianness))
+				prev := formatValue(f, decodeValue(m.pdata[j:], f.size, endianness))
+				values = append(values, colorize(str, prev, m.addr+j, f.size))
+			}
+			line += strings.Join(values, " ")
+		}
+
+		dump += line + "\n"
+	}
+
+	return dump
+}
@@ -7,49 +7,364 @@ import (
 
 	"github.com/jroimartin/gocui"
 
+	ae "../../../aemulari.v0"
 	"./theme"
 )
 
+// Maximum number of addresses retained for "goto back"
+const memHistorySize = 64
+
 type MemInfo struct {
+	name string // Pane name
+	view string // Name of the gocui View displaying the pane
+
 	addr uint64
 	data []byte
 
 	pdata []byte // Previous state of data
+	paddr uint64 // Address of pdata
 
 	tainted bool // Has data been potentially tainted?
+	format  int  // Index into memFormats
+
+	cursor  uint64   // Address of the pointer-sized value under the cursor
+	lock    string   // Expression the view is centered upon after each update
+	history []uint64 // Previous cursor addresses, for "goto back"
+
+	found    []uint64 // Addresses matched by the most recent find command
+	foundIdx int      // Index of the match shown in the Memory view
+
+	changes   []ae.DiffRange // Ranges listed by the most recent diff command
+	changeIdx int            // Index of the changed range shown in the Memory view
+}
+
+// Name of the main Memory view's pane
+const mainMemPane = "main"
+
+// Maximum number of memory panes
+const maxMemPanes = 4
+
+// Create the main memory pane, showing the code at the PC
+func (ui *Ui) initializeMemPanes() {
+	main := &MemInfo{name: mainMemPane, view: vMem, addr: ui.pc, cursor: ui.pc}
+	ui.panes = []*MemInfo{main}
+	ui.mem = main
+}
+
+// Retrieve a memory pane by name
+func (ui *Ui) memPane(name string) (*MemInfo, error) {
+	for _, m := range ui.panes {
+		if m.name == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("No such memory pane: %s", name)
+}
+
+// Add a memory pane showing `addr` and select it
+func (ui *Ui) addMemPane(name string, addr uint64, format int) error {
+	if _, err := ui.memPane(name); err == nil {
+		return fmt.Errorf("A memory pane named \"%s\" already exists.", name)
+	} else if len(ui.panes) >= maxMemPanes {
+		return fmt.Errorf("No more than %d memory panes may be shown.", maxMemPanes)
+	}
+
+	m := &MemInfo{name: name, view: " Memory: " + name + " ", format: format}
+	m.addr = addr &^ (ui.memLineSize(m) - 1)
+	m.cursor = addr
+
+	ui.panes = append(ui.panes, m)
+	ui.mem = m
+	ui.layoutMemPanes()
+	return nil
+}
+
+// Remove a memory pane, other than the main pane
+func (ui *Ui) removeMemPane(name string) error {
+	if name == mainMemPane {
+		return errors.New("The main memory pane may not be removed.")
+	}
+
+	for i, m := range ui.panes {
+		if m.name != name {
+			continue
+		}
+
+		ui.panes = append(ui.panes[:i], ui.panes[i+1:]...)
+		if ui.mem == m {
+			ui.mem = ui.panes[i-1]
+		}
+
+		delete(ui.views, m.view)
+		ui.layoutMemPanes()
+		return ui.g.DeleteView(m.view)
+	}
+
+	return fmt.Errorf("No such memory pane: %s", name)
+}
+
+// Select the next memory pane, which receives navigation keys and commands
+func (ui *Ui) selectNextMemPane() {
+	for i, m := range ui.panes {
+		if m == ui.mem {
+			ui.mem = ui.panes[(i+1)%len(ui.panes)]
+			return
+		}
+	}
+}
+
+// Point the Memory view at a new address
+func (ui *Ui) showMemory(addr uint64) error {
+	if ui.g == nil {
+		return errHeadless
+	}
+
+	view, err := ui.g.View(ui.mem.view)
+	if err != nil {
+		return err
+	}
+
+	ui.mem.lock = ""
+	ui.mem.addr = addr
+	ui.mem.cursor = addr
+	ui.mem.pdata = []byte{}
+
+	// FIXME This shouldn't require a double-kick to prevent it from
+	//		 incorrectly highlighting changes when we point the view at
+	//		 a different memory location
+	ui.updateMemPane(ui.mem, view)
+	ui.mem.pdata = []byte{}
+
+	return ui.updateMemPane(ui.mem, view)
+}
+
+// Move the Memory view and its cursor to `addr`, such that the previous
+// location may be returned to via memBack().
+func (ui *Ui) memGoto(addr uint64) error {
+	if ui.g == nil {
+		return errHeadless
+	}
+
+	if _, err := ui.dbg.ReadMem(addr, 1); err != nil {
+		return fmt.Errorf("0x%08x is not mapped.", addr)
+	}
+
+	ui.mem.history = append(ui.mem.history, ui.mem.cursor)
+	if len(ui.mem.history) > memHistorySize {
+		ui.mem.history = ui.mem.history[1:]
+	}
+
+	ui.mem.lock = ""
+	ui.mem.addr = addr &^ (ui.memLineSize(ui.mem) - 1)
+	ui.mem.cursor = addr
+	return nil
+}
+
+// Redraw the selected Memory view, after it was moved by a command
+func (ui *Ui) redrawMem() error {
+	view, err := ui.g.View(ui.mem.view)
+	if err != nil {
+		return err
+	}
+	return ui.updateMemPane(ui.mem, view)
+}
+
+// Return the Memory view to the location prior to the last memGoto()
+func (ui *Ui) memBack() error {
+	n := len(ui.mem.history)
+	if n == 0 {
+		return errors.New("There is no previous Memory view location.")
+	}
+
+	addr := ui.mem.history[n-1]
+	ui.mem.history = ui.mem.history[:n-1]
+
+	ui.mem.lock = ""
+	ui.mem.addr = addr &^ (ui.memLineSize(ui.mem) - 1)
+	ui.mem.cursor = addr
+	return nil
+}
+
+// Returns the number of bytes shown in the Memory view
+func (ui *Ui) memViewLen() uint64 {
+	if view, err := ui.g.View(ui.mem.view); err == nil {
+		if _, height := view.Size(); height > 0 {
+			return uint64(height) * ui.memLineSize(ui.mem)
+		}
+	}
+	return ui.memLineSize(ui.mem)
+}
+
+// Move the Memory view cursor by `delta` bytes, scrolling the view as needed.
+// Movement into unmapped memory is ignored.
+func (ui *Ui) memMoveCursor(delta int64) {
+	cursor := ui.mem.cursor + uint64(delta)
+	if _, err := ui.dbg.ReadMem(cursor, 1); err != nil {
+		return
+	}
+
+	ui.mem.lock = ""
+	ui.mem.cursor = cursor
+
+	lineSize := ui.memLineSize(ui.mem)
+	viewLen := ui.memViewLen()
+	if cursor < ui.mem.addr {
+		ui.mem.addr = cursor &^ (lineSize - 1)
+	} else if cursor >= ui.mem.addr+viewLen {
+		ui.mem.addr = (cursor &^ (lineSize - 1)) - viewLen + lineSize
+	}
+}
+
+// Scroll the Memory view by `lines` lines, retaining the cursor's position
+// within the view. Scrolling into unmapped memory is ignored.
+func (ui *Ui) memScroll(lines int64) {
+	lineSize := ui.memLineSize(ui.mem)
+	delta := uint64(lines) * lineSize
+	if _, err := ui.dbg.ReadMem(ui.mem.addr+delta, lineSize); err != nil {
+		return
+	}
+
+	ui.mem.lock = ""
+	ui.mem.addr += delta
+	ui.mem.cursor += delta
+}
+
+// Move the Memory view to the address contained in the pointer under the
+// cursor
+func (ui *Ui) memFollowPointer() error {
+	addr, err := ui.dbg.ReadPointer(ui.mem.cursor)
+	if err != nil {
+		return err
+	}
+	return ui.memGoto(addr)
+}
+
+// Handle Memory view navigation keys. Returns false if `key` is not one.
+func (ui *Ui) handleMemKey(key gocui.Key) bool {
+	var err error
+
+	ptrSize := int64(ui.dbg.PointerSize())
+	lineSize := int64(ui.memLineSize(ui.mem))
+	pageLines := int64(ui.memViewLen())/lineSize - 1
+	if pageLines < 1 {
+		pageLines = 1
+	}
+
+	switch key {
+	case gocui.KeyPgup:
+		ui.memScroll(-pageLines)
+	case gocui.KeyPgdn:
+		ui.memScroll(pageLines)
+	case gocui.KeyCtrlP:
+		ui.memMoveCursor(-lineSize)
+	case gocui.KeyCtrlN:
+		ui.memMoveCursor(lineSize)
+	case gocui.KeyCtrlB:
+		ui.memMoveCursor(-ptrSize)
+	case gocui.KeyCtrlF:
+		ui.memMoveCursor(ptrSize)
+	case gocui.KeyCtrlG:
+		err = ui.memFollowPointer()
+	case gocui.KeyCtrlO:
+		err = ui.memBack()
+	case gocui.KeyCtrlD:
+		_, err = ui.diffNext(true)
+	case gocui.KeyCtrlW:
+		ui.selectNextMemPane()
+	case gocui.KeyCtrlT:
+		ui.mem.format = (ui.mem.format + 1) % len(memFormats)
+		ui.mem.pdata = []byte{}
+		ui.mem.addr &^= ui.memLineSize(ui.mem) - 1
+	default:
+		return false
+	}
+
+	if err != nil {
+		ui.appendConsole("\n" + ui.theme.ErrorMessage(err))
+	}
+
+	return true
 }
 
 func (ui *Ui) updateMemView(view *gocui.View) error {
+	return ui.updateMemPane(ui.panes[0], view)
+}
+
+// Redraw a memory pane
+func (ui *Ui) updateMemPane(m *MemInfo, view *gocui.View) error {
 	_, height := view.Size()
 
 	if height < 1 {
 		return errors.New("Memory view not large enough to draw")
 	}
 
-	dataLen := uint64(height * 16)
-	if uint64(len(ui.mem.data)) == dataLen && ui.mem.tainted {
-		if len(ui.mem.data) != len(ui.mem.pdata) {
-			ui.mem.pdata = make([]byte, len(ui.mem.data))
+	lineSize := ui.memLineSize(m)
+	dataLen := uint64(height) * lineSize
+	if uint64(len(m.data)) == dataLen && m.tainted {
+		if len(m.data) != len(m.pdata) {
+			m.pdata = make([]byte, len(m.data))
 		}
 
-		copy(ui.mem.pdata, ui.mem.data)
-		ui.mem.tainted = false
+		copy(m.pdata, m.data)
+		m.paddr = m.addr
+		m.tainted = false
 	}
 
-	tmp, err := ui.dbg.ReadMem(ui.mem.addr, dataLen)
+	// Center the view upon the locked expression, if any
+	if m.lock != "" {
+		if addr, err := ui.dbg.Evaluate(m.lock); err == nil {
+			top := addr &^ (lineSize - 1)
+			half := uint64(height/2) * lineSize
+			if top >= half {
+				top -= half
+			} else {
+				top = 0
+			}
+
+			m.addr = top
+			m.cursor = addr
+		}
+	}
+
+	tmp, err := ui.dbg.ReadMem(m.addr, dataLen)
 	if err != nil {
 		return err
 	}
-	ui.mem.data = tmp
+	m.data = tmp
+
+	if len(m.pdata) != len(m.data) {
+		m.pdata = make([]byte, len(m.data))
+		copy(m.pdata, m.data)
+		m.paddr = m.addr
+	}
 
-	if len(ui.mem.pdata) != len(ui.mem.data) {
-		ui.mem.pdata = make([]byte, len(ui.mem.data))
-		copy(ui.mem.pdata, ui.mem.data)
+	// Compare against the previous data at the same addresses, in case
+	// the view has moved
+	shown := *m
+	if m.paddr != m.addr {
+		shown.pdata = make([]byte, len(m.data))
+		for i := range m.data {
+			addr := m.addr + uint64(i)
+			if addr >= m.paddr && addr-m.paddr < uint64(len(m.pdata)) {
+				shown.pdata[i] = m.pdata[addr-m.paddr]
+			} else {
+				shown.pdata[i] = m.data[i]
+			}
+		}
+	}
+
+	// Mark the selected pane, when there is a choice
+	if len(ui.panes) > 1 && m == ui.mem {
+		view.Title = m.view + "[selected] "
 	}
 
 	view.Clear()
 	// TODO get address fmt (i.e., num bytes) from ui.dbg
-	fmt.Fprintf(view, "%s", ui.hexdump(ui.mem.addr, "%08x", ui.theme, ui.mem))
+	if memFormats[m.format].kind == 'x' {
+		fmt.Fprintf(view, "%s", ui.hexdump(m.addr, "%08x", ui.theme, shown))
+	} else {
+		fmt.Fprintf(view, "%s", ui.formatMem("%08x", shown))
+	}
 
 	return nil
 }
@@ -71,8 +386,7 @@ func (ui Ui) hexdump(addr uint64, addrFmt string, theme theme.Theme, m MemInfo)
 		// First set of 8 bytes
 		for j := i; j < (i + 8); j += 1 {
 			if j < count {
-				str := fmt.Sprintf("%02x ", m.data[j])
-				line += theme.ColorIfBytesDiffer(str, m.data[j], m.pdata[j])
+				line += ui.hexdumpByte(fmt.Sprintf("%02x", m.data[j]), addr+j, theme, m, j) + " "
 			} else {
 				line += "   "
 			}
@@ -83,8 +397,7 @@ func (ui Ui) hexdump(addr uint64, addrFmt string, theme theme.Theme, m MemInfo)
 		// Second set of 8 bytes
 		for j := i + 8; j < (i + 16); j += 1 {
 			if j < count {
-				str := fmt.Sprintf("%02x ", m.data[j])
-				line += theme.ColorIfBytesDiffer(str, m.data[j], m.pdata[j])
+				line += ui.hexdumpByte(fmt.Sprintf("%02x", m.data[j]), addr+j, theme, m, j) + " "
 			} else {
 				line += "   "
 			}
@@ -95,10 +408,9 @@ func (ui Ui) hexdump(addr uint64, addrFmt string, theme theme.Theme, m MemInfo)
 		for j = i; j < i+16; j += 1 {
 			if j < count {
 				if m.data[j] <= unicode.MaxASCII && unicode.IsPrint(rune(m.data[j])) {
-					str := fmt.Sprintf("%c", m.data[j])
-					line += theme.ColorIfBytesDiffer(str, m.data[j], m.pdata[j])
+					line += ui.hexdumpByte(fmt.Sprintf("%c", m.data[j]), addr+j, theme, m, j)
 				} else {
-					line += theme.ColorIfBytesDiffer(".", m.data[j], m.pdata[j])
+					line += ui.hexdumpByte(".", addr+j, theme, m, j)
 				}
 			}
 		}
@@ -109,3 +421,12 @@ func (ui Ui) hexdump(addr uint64, addrFmt string, theme theme.Theme, m MemInfo)
 
 	return dump
 }
+
+// Colorize the representation of the byte at index `i` of a hexdump, which
+// is located at `addr`, if it has changed or is under the cursor.
+func (ui Ui) hexdumpByte(str string, addr uint64, theme theme.Theme, m MemInfo, i uint64) string {
+	if m.name == ui.mem.name && addr >= m.cursor && addr < m.cursor+ui.dbg.PointerSize() {
+		return theme.ColorCursor(str)
+	}
+	return theme.ColorIfBytesDiffer(str, m.data[i], m.pdata[i])
+}
@@ -242,3 +242,40 @@ func parseValue(valStr string, e ae.Endianness) ([]byte, error) {
 
 	return []byte{}, fmt.Errorf("\"%s\" is not a valid value.", valStr)
 }
+
+// Evaluate an expression and return its value as pointer-sized bytes
+func (ui *Ui) pointerBytes(expr string, e ae.Endianness) ([]byte, error) {
+	value, err := ui.dbg.Evaluate(expr)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	if ui.dbg.PointerSize() == 8 {
+		return u64Endian(value, e), nil
+	}
+	return u32Endian(uint32(value), e), nil
+}
+
+// Parse a memory search pattern, which may be any value accepted by
+// parseValue(), a quoted ASCII string ("text"), a quoted UTF-16 string
+// (u"text"), or a hex sequence containing '?' wildcards ({de??beef}).
+func parseSearchPattern(s string, e ae.Endianness) (ae.SearchPattern, error) {
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		return ae.ParseHexPattern(s[1 : len(s)-1])
+	}
+
+	if len(s) >= 2 && strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"") {
+		return ae.NewSearchPattern([]byte(s[1 : len(s)-1])), nil
+	}
+
+	if len(s) >= 3 && strings.HasPrefix(s, "u\"") && strings.HasSuffix(s, "\"") {
+		return ae.NewUTF16SearchPattern(s[2:len(s)-1], e), nil
+	}
+
+	data, err := parseValue(s, e)
+	if err != nil {
+		return ae.SearchPattern{}, err
+	}
+
+	return ae.NewSearchPattern(data), nil
+}
@@ -35,21 +35,42 @@ func (ui *Ui) updateRegView(view *gocui.View) error {
 		copy(ui.regs.prev, ui.regs.curr)
 	}
 
+	pending := ui.pendingWrites()
+
 	view.Clear()
 	for i := 0; i < len(ui.regs.curr); i += 2 {
 		if i+1 < len(ui.regs.curr) {
 			fmt.Fprintf(view, " %s    %s\n",
-				ui.theme.ColorIfStringsDiffer(ui.regs.curr[i].String(),
-					ui.regs.prev[i].String()),
-				ui.theme.ColorIfStringsDiffer(ui.regs.curr[i+1].String(),
-					ui.regs.prev[i+1].String()))
-
+				ui.colorRegister(i, pending), ui.colorRegister(i+1, pending))
 		} else {
-			fmt.Fprintf(view, " %s\n",
-				ui.theme.ColorIfStringsDiffer(ui.regs.curr[i].String(),
-					ui.regs.prev[i].String()))
+			fmt.Fprintf(view, " %s\n", ui.colorRegister(i, pending))
 		}
 	}
 
 	return nil
 }
+
+// Returns the registers that the instruction at the PC will modify, if its
+// condition passes
+func (ui *Ui) pendingWrites() map[string]bool {
+	ret := make(map[string]bool)
+
+	if p, err := ui.dbg.PreviewInstruction(); err == nil && p.Executes {
+		for _, name := range p.Instr.Detail.RegsWritten {
+			ret[name] = true
+		}
+	}
+
+	return ret
+}
+
+// Colorize the register at index `i` if it changed, or will be modified by
+// the instruction at the PC
+func (ui *Ui) colorRegister(i int, pending map[string]bool) string {
+	curr, prev := ui.regs.curr[i].String(), ui.regs.prev[i].String()
+
+	if curr == prev && pending[ui.regs.curr[i].Name()] {
+		return ui.theme.ColorPendingWrite(curr)
+	}
+	return ui.theme.ColorIfStringsDiffer(curr, prev)
+}
@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Name of the script automatically run from the current working directory
+const RcFile = ".aemularirc"
+
+// Limit on nested "source" commands, which guards against a script
+// that (directly or indirectly) sources itself
+const maxScriptDepth = 16
+
+// Strip excess whitespace from a line of a script. An empty string is
+// returned for blank lines and comments, which begin with a '#'. Elsewhere,
+// a '#' is part of the command (e.g., an immediate in "asm pc mov r0, #1").
+func scriptLine(line string) string {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "#") {
+		return ""
+	}
+
+	return strings.Join(strings.Fields(line), " ")
+}
+
+// Run each command in the specified script file, in order, via the same
+// dispatcher used for interactively entered commands. Execution stops at
+// the first command that fails; the returned error identifies its location.
+// Command output is written to `out` as each command completes.
+func (ui *Ui) RunScript(filename string, out func(string)) error {
+	if ui.scriptDepth >= maxScriptDepth {
+		return fmt.Errorf("Scripts nested too deeply (> %d) at %s", maxScriptDepth, filename)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ui.scriptDepth++
+	defer func() { ui.scriptDepth-- }()
+
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scriptLine(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		output, _, err := ui.handleCommand(line)
+		if output != "" {
+			out(output)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", filename, lineNum, err.Error())
+		}
+
+		if ui.quit {
+			break
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Run the project-local .aemularirc file, if present, followed by each of
+// the specified scripts. Stops at the first script that fails.
+func (ui *Ui) RunStartupScripts(filenames []string, loadRc bool, out func(string)) error {
+	if loadRc {
+		if _, err := os.Stat(RcFile); err == nil {
+			filenames = append([]string{RcFile}, filenames...)
+		}
+	}
+
+	for _, filename := range filenames {
+		if err := ui.RunScript(filename, out); err != nil {
+			return err
+		}
+
+		if ui.quit {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Returns true if a script has requested that the program exit
+func (ui *Ui) QuitRequested() bool {
+	return ui.quit
+}
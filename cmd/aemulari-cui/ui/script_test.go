@@ -0,0 +1,28 @@
+package ui
+
+import "testing"
+
+func TestScriptLine(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"", ""},
+		{"   \t ", ""},
+		{"# A comment", ""},
+		{"   # An indented comment", ""},
+		{"break   0x10008", "break 0x10008"},
+		{"\tstep 10 ", "step 10"},
+
+		// A '#' elsewhere is part of the command
+		{"asm pc mov r0, #1; bx lr", "asm pc mov r0, #1; bx lr"},
+		{"find code \"#include\"", "find code \"#include\""},
+		{"mw 0x80000 \"a#b\"", "mw 0x80000 \"a#b\""},
+	}
+
+	for _, test := range tests {
+		if line := scriptLine(test.line); line != test.expected {
+			t.Errorf("%q: got %q, expected %q", test.line, line, test.expected)
+		}
+	}
+}
@@ -21,6 +21,9 @@ const cmdSuccessColor = 70
 const cmdErrorColor = errorColor
 const breakpointColor = 124
 const currentInstrColor = 48
+const coveredInstrColor = 242
+const pendingWriteColor = 214
+const previewColor = 110
 
 func CreateDefaultTheme(regNames *regexp.Regexp) (theme DefaultTheme) {
 	theme.regNames = regNames
@@ -46,6 +49,14 @@ func (d DefaultTheme) ColorAddress(fmtspec string, addr uint64) string {
 	return colorizeFg(addrColor, fmt.Sprintf(fmtspec, addr))
 }
 
+func (d DefaultTheme) ColorPendingWrite(str string) string {
+	return colorizeFg(pendingWriteColor, str)
+}
+
+func (d DefaultTheme) ColorCursor(str string) string {
+	return reverse(str)
+}
+
 func (d DefaultTheme) ColorOpcode(opcode string) string {
 	return colorizeFg(opcodeColor, opcode)
 }
@@ -65,6 +76,10 @@ func (d DefaultTheme) ColorOperands(operands string) string {
 	return string(d.immediate.ReplaceAll(coloredOperands, immRepl))
 }
 
+func (d DefaultTheme) ColorPreview(preview string) string {
+	return colorizeFg(previewColor, preview)
+}
+
 func (d DefaultTheme) ArmedBreakpointSymbol() string {
 	return colorizeFg(breakpointColor, "B")
 }
@@ -77,6 +92,10 @@ func (d DefaultTheme) CurrentInstructionSymbol() string {
 	return colorizeFg(currentInstrColor, ">")
 }
 
+func (d DefaultTheme) CoveredInstructionSymbol() string {
+	return colorizeFg(coveredInstrColor, "*")
+}
+
 func (d DefaultTheme) ColorModifiedInstruction(line string) string {
 	return colorizeFg(differsColor, line)
 }
@@ -16,6 +16,14 @@ func (n NoTheme) ColorAddress(fmtspec string, addr uint64) string {
 	return fmt.Sprintf(fmtspec, addr)
 }
 
+func (n NoTheme) ColorPendingWrite(str string) string {
+	return str
+}
+
+func (n NoTheme) ColorCursor(str string) string {
+	return str
+}
+
 func (n NoTheme) ColorOpcode(opcode string) string {
 	return opcode
 }
@@ -28,6 +36,10 @@ func (n NoTheme) ColorOperands(operands string) string {
 	return operands
 }
 
+func (n NoTheme) ColorPreview(preview string) string {
+	return preview
+}
+
 func (n NoTheme) ArmedBreakpointSymbol() string {
 	return "@"
 }
@@ -40,6 +52,10 @@ func (n NoTheme) CurrentInstructionSymbol() string {
 	return ">"
 }
 
+func (n NoTheme) CoveredInstructionSymbol() string {
+	return "*"
+}
+
 func (n NoTheme) ColorModifiedInstruction(line string) string {
 	return line
 }
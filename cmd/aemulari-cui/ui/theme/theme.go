@@ -22,6 +22,20 @@ type Theme interface {
 	// Colorize a code address (e.g., memory view, disassembly view)
 	ColorAddress(fmtspec string, addr uint64) string
 
+	/**************************************************************************
+	 * Registers View
+	 *************************************************************************/
+
+	// Highlight a register that the instruction at the PC will modify
+	ColorPendingWrite(str string) string
+
+	/**************************************************************************
+	 * Memory View
+	 *************************************************************************/
+
+	// Highlight the bytes under the cursor
+	ColorCursor(str string) string
+
 	/**************************************************************************
 	 * Disassembly View
 	 *************************************************************************/
@@ -35,6 +49,9 @@ type Theme interface {
 	// Return colorized current instruction symbol
 	CurrentInstructionSymbol() string
 
+	// Return colorized symbol denoting an instruction that has been executed
+	CoveredInstructionSymbol() string
+
 	// Colorize (highlight) andisassembled instruction that has been modified
 	ColorModifiedInstruction(line string) string
 
@@ -47,6 +64,9 @@ type Theme interface {
 	// Color an instruction's operands
 	ColorOperands(operands string) string
 
+	// Color the expected effect (e.g., memory accessed) of the instruction at the PC
+	ColorPreview(preview string) string
+
 	/**************************************************************************
 	 * Commands View
 	 *************************************************************************/
@@ -79,6 +99,11 @@ func New(name string, regNames *regexp.Regexp) (Theme, error) {
 	return NoTheme{}, fmt.Errorf("\"%s\" is not a valid colorscheme.", name)
 }
 
+// Reverse the foreground and background colors
+func reverse(s string) string {
+	return fmt.Sprintf("\x1b[7m%s\x1b[0m", s)
+}
+
 // Colorize the foreground (text)
 func colorizeFg(color uint8, s string) string {
 	return fmt.Sprintf("\x1b[38;5;%dm%s\x1b[0m", color, s)
@@ -1,9 +1,13 @@
 package ui
 
 import (
+	"bytes"
+	"errors"
+
 	"github.com/jroimartin/gocui"
 
 	ae "../../../aemulari.v0"
+	"../../internal/scripting"
 	"./theme"
 )
 
@@ -11,20 +15,75 @@ type Ui struct {
 	g     *gocui.Gui
 	views Views
 
-	dbg *ae.Debugger
-	pc  uint64
+	arch *ae.Architecture
+	dbg  *ae.Debugger
+	pc   uint64
 
 	disasm DisassemblyInfo
 	regs   RegInfo
 	flags  FlagInfo
-	mem    MemInfo
+	mem    *MemInfo   // Selected memory pane
+	panes  []*MemInfo // All memory panes, starting with the main Memory view
 	hist   CommandHistory
 
+	watches WatchInfo
+	mark    *ae.Snapshot // Memory contents captured by "diff mark"
+
 	theme theme.Theme
 
+	scripts     []string // Scripts to run at startup
+	starScripts []string // Starlark scripts to run at startup
+	loadRc      bool     // Run .aemularirc at startup, if present
+	scriptDepth int      // Current nesting depth of running scripts
+
+	starlark    *scripting.Interpreter // Created upon first use
+	starlarkOut bytes.Buffer           // Output of Starlark print() calls
+
 	quit bool
 }
 
+// Returned by commands that require the console UI when run headless
+var errHeadless = errors.New("This command is not available without the console UI.")
+
+// Create a Ui that has no console, for use in running commands (e.g., from
+// scripts) in batch mode. Commands that require the console UI will fail.
+func CreateHeadless(arch *ae.Architecture, dbg *ae.Debugger) (*Ui, error) {
+	var ui Ui
+	var err error
+
+	ui.theme, err = theme.New("none", (*arch).RegisterRegexp())
+	if err != nil {
+		return nil, err
+	}
+
+	ui.arch = arch
+	ui.dbg = dbg
+	if reg, err := ui.dbg.ReadRegByName("pc"); err != nil {
+		return nil, err
+	} else {
+		ui.pc = reg.Value
+	}
+
+	ui.initializeMemPanes()
+	return &ui, nil
+}
+
+// Retrieve the Starlark interpreter, creating it if necessary
+func (ui *Ui) interpreter() *scripting.Interpreter {
+	if ui.starlark == nil {
+		ui.starlark = scripting.New(ui.dbg, &ui.starlarkOut)
+	}
+	return ui.starlark
+}
+
+// Run .aemularirc, if present, and then the specified command scripts,
+// followed by Starlark scripts, once the console UI has started.
+func (ui *Ui) SetStartupScripts(filenames, starlarkFiles []string, loadRc bool) {
+	ui.scripts = filenames
+	ui.starScripts = starlarkFiles
+	ui.loadRc = loadRc
+}
+
 func Create(arch *ae.Architecture, dbg *ae.Debugger) (*Ui, error) {
 	var ui Ui
 
@@ -53,6 +112,7 @@ func Create(arch *ae.Architecture, dbg *ae.Debugger) (*Ui, error) {
 		return nil, err
 	}
 
+	ui.arch = arch
 	ui.dbg = dbg
 	if reg, err := ui.dbg.ReadRegByName("pc"); err != nil {
 		return nil, err
@@ -60,7 +120,7 @@ func Create(arch *ae.Architecture, dbg *ae.Debugger) (*Ui, error) {
 		ui.pc = reg.Value
 	}
 
-	ui.mem.addr = ui.pc
+	ui.initializeMemPanes()
 	ui.update(ui.g)
 
 	return &ui, nil
@@ -72,7 +132,9 @@ func (ui *Ui) quitRequest(gui *gocui.Gui, view *gocui.View) error {
 }
 
 func (ui *Ui) Close() {
-	ui.g.Close()
+	if ui.g != nil {
+		ui.g.Close()
+	}
 }
 
 func (ui *Ui) showStartupText() {
@@ -87,8 +149,56 @@ func (ui *Ui) showStartupText() {
 
 }
 
+// Carry out commands sent by external tools. These are handed off to the
+// gocui main loop, as the Debugger may not be used concurrently.
+func (ui *Ui) handleToolSyncCommands() {
+	cmds := ui.dbg.ToolSyncCommands()
+	if cmds == nil {
+		return
+	}
+
+	for c := range cmds {
+		c := c
+		ui.g.Update(func(g *gocui.Gui) error {
+			ui.regs.tainted = true
+			ui.appendConsole("\nExternal tool: " + c.String())
+
+			if err := ui.dbg.ApplyToolSyncCommand(c); err != nil {
+				ui.appendConsole("\n" + ui.theme.ErrorMessage(err))
+			} else if rv, err := ui.dbg.ReadRegByName("pc"); err == nil {
+				ui.pc = rv.Value
+			}
+
+			return nil
+		})
+	}
+}
+
 func (ui *Ui) Run() error {
 	ui.showStartupText()
+
+	err := ui.RunStartupScripts(ui.scripts, ui.loadRc, func(output string) {
+		ui.appendConsole("\n" + output)
+	})
+
+	for _, filename := range ui.starScripts {
+		if err != nil || ui.quit {
+			break
+		}
+
+		if output, _, cmdErr := ui.handleCommand("script " + filename); cmdErr != nil {
+			err = cmdErr
+		} else if output != "" {
+			ui.appendConsole("\n" + output)
+		}
+	}
+
+	if err != nil {
+		ui.appendConsole("\n" + ui.theme.ErrorMessage(err))
+	}
+
+	go ui.handleToolSyncCommands()
+
 	if err := ui.g.MainLoop(); err != nil && err != gocui.ErrQuit {
 		return err
 	}
@@ -97,7 +207,7 @@ func (ui *Ui) Run() error {
 }
 
 func (ui *Ui) update(gui *gocui.Gui) error {
-	for _, view := range ui.views {
+	for _, view := range ui.views.ordered() {
 		view.Update(gui)
 	}
 
@@ -52,9 +52,14 @@ const vDisasm = " Disassembly "
 const vReg = " Registers "
 const vFlags = " Flags "
 const vMem = " Memory "
+const vWatches = " Watches "
+const vCallStack = " Call Stack "
 const vConsole = " Console "
 const vCommands = " Commands "
 
+// Fraction of the height below the Registers view shared by memory panes
+const memAreaHeight = 0.70
+
 /* Set in View.width and View.height  to indicate the view should fill the
  * remaining width or height of the GUI region. */
 const fillRemaining = 0.0
@@ -144,6 +149,46 @@ func (v *View) Update(gui *gocui.Gui) error {
 	return nil
 }
 
+// Returns the views in an order such that each is positioned after the views
+// it is pinned below or to the right of.
+func (views Views) ordered() []View {
+	var ret []View
+	placed := make(map[string]bool)
+
+	for len(ret) < len(views) {
+		progress := false
+
+		for name, v := range views {
+			if placed[name] {
+				continue
+			}
+
+			// Views pinned to a nonexistent view are placed as-is
+			_, haveBelow := views[v.below]
+			_, haveRightOf := views[v.rightOf]
+			if (haveBelow && !placed[v.below]) || (haveRightOf && !placed[v.rightOf]) {
+				continue
+			}
+
+			ret = append(ret, v)
+			placed[name] = true
+			progress = true
+		}
+
+		// Break dependency cycles by placing the remaining views arbitrarily
+		if !progress {
+			for name, v := range views {
+				if !placed[name] {
+					ret = append(ret, v)
+					placed[name] = true
+				}
+			}
+		}
+	}
+
+	return ret
+}
+
 func (ui *Ui) initializeViews(addrFmt string, numRegs int) {
 	testStr := fmt.Sprintf(addrFmt, 0)
 	leftSideMaxWidth := 72 + len(testStr)
@@ -179,7 +224,7 @@ func (ui *Ui) initializeViews(addrFmt string, numRegs int) {
 			x:         0.0,
 			below:     vReg,
 			prefWidth: float32(leftSideMaxWidth),
-			height:    0.70,
+			height:    memAreaHeight,
 			UpdateCb:  ui.updateMemView,
 			ui:        ui,
 		},
@@ -199,15 +244,35 @@ func (ui *Ui) initializeViews(addrFmt string, numRegs int) {
 			rightOf:  vMem,
 			y:        0.0,
 			width:    fillRemaining,
-			height:   0.65,
+			height:   0.60,
 			UpdateCb: ui.updateDisasmView,
 			ui:       ui,
 		},
 
+		vWatches: View{
+			name:     vWatches,
+			rightOf:  vMem,
+			below:    vDisasm,
+			width:    0.5,
+			height:   0.40,
+			UpdateCb: ui.updateWatchesView,
+			ui:       ui,
+		},
+
+		vCallStack: View{
+			name:     vCallStack,
+			rightOf:  vWatches,
+			below:    vDisasm,
+			width:    fillRemaining,
+			height:   0.40,
+			UpdateCb: ui.updateCallStackView,
+			ui:       ui,
+		},
+
 		vConsole: View{
 			name:     vConsole,
 			rightOf:  vCommands,
-			below:    vDisasm,
+			below:    vWatches,
 			width:    fillRemaining,
 			height:   fillRemaining,
 			UpdateCb: ui.updateConsoleView,
@@ -215,3 +280,34 @@ func (ui *Ui) initializeViews(addrFmt string, numRegs int) {
 		},
 	}
 }
+
+// Stack all memory panes in the space allotted to the Memory view, giving
+// each an equal share, and place the Commands view below the last of them.
+func (ui *Ui) layoutMemPanes() {
+	main := ui.views[vMem]
+	share := memAreaHeight / float32(len(ui.panes))
+	below := main.below
+
+	for i, m := range ui.panes {
+		v := main
+		v.name = m.view
+		v.below = below
+
+		// Each height is a fraction of the space remaining below `below`
+		v.height = share / (1.0 - float32(i)*share)
+
+		if i > 0 {
+			pane := m
+			v.UpdateCb = func(view *gocui.View) error {
+				return ui.updateMemPane(pane, view)
+			}
+		}
+
+		ui.views[m.view] = v
+		below = m.view
+	}
+
+	cmds := ui.views[vCommands]
+	cmds.below = below
+	ui.views[vCommands] = cmds
+}
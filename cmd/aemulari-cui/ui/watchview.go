@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/jroimartin/gocui"
+)
+
+// Maximum number of characters of an expression shown in the Watches view
+const watchExprWidth = 24
+
+type Watch struct {
+	expr string
+	curr string // Current value, or an error message
+	prev string // Value prior to the last command that may have changed it
+}
+
+type WatchInfo struct {
+	list    []*Watch
+	tainted bool // Track if watched values may have changed
+}
+
+// Evaluate a watch expression, returning its value or an error message
+func (ui *Ui) evaluateWatch(w *Watch) string {
+	value, err := ui.dbg.EvaluateValue(w.expr)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return value.String()
+}
+
+// Add an expression to the watch list
+func (ui *Ui) addWatch(expr string) (*Watch, error) {
+	if _, err := ui.dbg.EvaluateValue(expr); err != nil {
+		return nil, err
+	}
+
+	w := &Watch{expr: expr}
+	w.curr = ui.evaluateWatch(w)
+	w.prev = w.curr
+
+	ui.watches.list = append(ui.watches.list, w)
+	return w, nil
+}
+
+// Remove the watch at index `i` of the watch list
+func (ui *Ui) removeWatch(i int) error {
+	if i < 0 || i >= len(ui.watches.list) {
+		return fmt.Errorf("There is no watch #%d.", i)
+	}
+
+	ui.watches.list = append(ui.watches.list[:i], ui.watches.list[i+1:]...)
+	return nil
+}
+
+func (ui *Ui) updateWatchesView(view *gocui.View) error {
+	for _, w := range ui.watches.list {
+		if ui.watches.tainted {
+			w.prev = w.curr
+		}
+		w.curr = ui.evaluateWatch(w)
+	}
+	ui.watches.tainted = false
+
+	view.Clear()
+	for i, w := range ui.watches.list {
+		expr := w.expr
+		if len(expr) > watchExprWidth {
+			expr = expr[:watchExprWidth-3] + "..."
+		}
+
+		fmt.Fprintf(view, " %2d  %-*s  %s\n", i, watchExprWidth, expr,
+			ui.theme.ColorIfStringsDiffer(w.curr, w.prev))
+	}
+
+	return nil
+}
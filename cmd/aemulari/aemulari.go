@@ -1,14 +1,28 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"time"
 
 	ae "../../aemulari.v0"
+	"../../aemulari.v0/fuzz"
+	"../../aemulari.v0/remote"
+	"../aemulari-cui/ui"
 	"../internal/cmdline"
+	"../internal/expect"
+	"../internal/gdbstub"
+	"../internal/scripting"
 	"../internal/util"
 )
 
@@ -17,22 +31,132 @@ type hexdumpRequest struct {
 	addr, length uint64
 }
 
+// Process exit status, reflecting how execution stopped
+const (
+	exitCompleted   = 0
+	exitError       = 1
+	exitBreakpoint  = 2
+	exitException   = 3
+	exitInterrupted = 4
+	exitExpectation = 5
+	exitFault       = 6
+)
+
+// Document written by --output json
+type jsonReport struct {
+	Stop             jsonStop         `json:"stop"`
+	InstructionCount uint64           `json:"instruction_count"`
+	Registers        []jsonRegister   `json:"registers"`
+	Memory           []jsonMemory     `json:"memory"`
+	Breakpoints      []jsonBreakpoint `json:"breakpoints"`
+	Diffs            []jsonDiff       `json:"diffs,omitempty"`
+	Errors           []string         `json:"errors,omitempty"`
+	Expectations     []expect.Failure `json:"expectation_failures,omitempty"`
+}
+
+type jsonStop struct {
+	Reason      string         `json:"reason"`
+	PC          uint64         `json:"pc"`
+	Exception   *jsonException `json:"exception,omitempty"`
+	Fault       *jsonFault     `json:"fault,omitempty"`
+	Breakpoints []int          `json:"breakpoints,omitempty"` // IDs of breakpoints at PC
+	Error       string         `json:"error,omitempty"`       // Why execution failed
+}
+
+type jsonException struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Signal      int    `json:"signal"`
+}
+
+type jsonFault struct {
+	Access      string `json:"access"`
+	Address     uint64 `json:"address"`
+	Size        int    `json:"size"`
+	Unmapped    bool   `json:"unmapped"`
+	Description string `json:"description"`
+}
+
+type jsonRegister struct {
+	Name  string            `json:"name"`
+	Value uint64            `json:"value"`
+	Size  uint              `json:"size"`
+	Flags map[string]uint64 `json:"flags,omitempty"`
+}
+
+type jsonMemory struct {
+	Name     string `json:"name,omitempty"`
+	Address  uint64 `json:"address"`
+	Size     uint64 `json:"size"`
+	Encoding string `json:"encoding"`
+	Data     string `json:"data"`
+}
+
+type jsonDiff struct {
+	Name     string          `json:"name"`
+	Changed  uint64          `json:"changed"` // Total number of bytes changed
+	Encoding string          `json:"encoding"`
+	Ranges   []jsonDiffRange `json:"ranges"`
+}
+
+type jsonDiffRange struct {
+	Address  uint64 `json:"address"`
+	Size     uint64 `json:"size"`
+	Original string `json:"original"`
+	Current  string `json:"current"`
+}
+
+type jsonBreakpoint struct {
+	ID      int    `json:"id"`
+	Address uint64 `json:"address"`
+	Enabled bool   `json:"enabled"`
+	Hits    uint   `json:"hits"`
+}
+
 var usageText string = "" +
 	"aemulari -- Batch execution of the aemulari debugger (v" + ae.Version + ")\n" +
 	"Usage: %s [options]\n" +
+	"       aemulari fuzz [options]    (See \"aemulari fuzz --help\")\n" +
 	"\n" +
 	"Options:\n" +
 	cmdline.FlagStr_arch +
 	cmdline.FlagStr_regs +
 	cmdline.FlagStr_mem +
 	cmdline.FlagStr_breakpoint +
+	cmdline.FlagStr_symbols +
+	cmdline.FlagStr_patch +
+	cmdline.FlagStr_call +
 	cmdline.FlagStr_printRegs +
 	cmdline.FlagStr_printHexdump +
+	cmdline.FlagStr_diff +
+	cmdline.FlagStr_output +
+	cmdline.FlagStr_expect +
+	cmdline.FlagStr_trace +
+	cmdline.FlagStr_coverage +
+	cmdline.FlagStr_gdb +
+	cmdline.FlagStr_serve +
+	cmdline.FlagStr_script +
+	cmdline.FlagStr_starlark +
+	cmdline.FlagStr_config +
 	cmdline.FlagStr_help +
 	cmdline.Details_arch +
 	cmdline.Details_mem +
+	cmdline.Details_patch +
+	cmdline.Details_script +
+	cmdline.Details_config +
+	cmdline.Details_call +
+	cmdline.Details_exitStatus +
 	cmdline.Notes +
 	" - Execution terminates when an exception occurs or a when breakpoint is hit.\n" +
+	" - When --gdb is used, execution is controlled by the GDB client. Outputs are\n" +
+	"     produced once the client detaches or kills the target.\n" +
+	" - When --serve is used, execution is controlled by JSON-RPC clients. Outputs\n" +
+	"     are produced once a client sends a Debugger.Quit request.\n" +
+	" - With --output json, output from scripts is written to stderr so that\n" +
+	"     stdout contains only the JSON document.\n" +
+	" - Scripts are run after the debugger is configured, prior to execution.\n" +
+	"     If a script runs the \"quit\" command, execution is skipped. Unlike\n" +
+	"     aemulari-cui, " + ui.RcFile + " is not loaded automatically.\n" +
 	"\n" +
 	"Examples:\n" +
 	"  Run myprogram.bin and then print the state of registers upon termination\n" +
@@ -43,6 +167,82 @@ var usageText string = "" +
 	"  the \"mydata\" region to a file named mydata.bin.\n" +
 	"    aemulari -m code:0x48000000:0x4000:rx:./myprogram.bin \\\n" +
 	"      -m mydata:0x80000000:0x4000:rw::./mydata.bin\n" +
+	"\n" +
+	"  Execute myprogram.bin and record a JSON trace of the instructions executed\n" +
+	"  in the first 0x100 bytes of the code region.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin -t trace.jsonl \\\n" +
+	"      --trace-format json --trace-range 0x10000:0x100\n" +
+	"\n" +
+	"  Debug myprogram.bin with gdb-multiarch, via \"target remote :1234\".\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin -g 1234\n" +
+	"\n" +
+	"  Control myprogram.bin from a script, via JSON-RPC over a UNIX socket.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin \\\n" +
+	"      --serve unix:/tmp/aemulari.sock\n" +
+	"\n" +
+	"  Run myprogram.bin until the breakpoint at 0x10214 and write the final\n" +
+	"  state of registers and the \"mydata\" region as JSON, for use by a test.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin \\\n" +
+	"      -m mydata:0x80000:0x100:rw -b 0x10214 -d mydata -o json\n" +
+	"\n" +
+	"  Run count.arm.bin as a unit test, checking its final register values.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./count.arm.bin \\\n" +
+	"      --expect-stop exception:bkpt --expect r0=127 --expect r4=0x2f4\n" +
+	"\n" +
+	"  Call the checksum function in firmware.bin with a 4-byte buffer, using\n" +
+	"  symbols produced by nm, and print the registers once it returns.\n" +
+	"    aemulari -m code:0x10000:0x8000:rx:./firmware.bin --symbols fw.syms \\\n" +
+	"      --call \"checksum hex:00112233 4\" --expect-stop return -R\n" +
+	"\n" +
+	"  Configure memory and breakpoints via the same script used with\n" +
+	"  aemulari-cui, then run myprogram.bin and print the registers.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin -x setup.cmds -R\n" +
+	"\n" +
+	"  Emulate peripherals via callbacks defined in a Starlark script.\n" +
+	"    aemulari -m code:0x10000:0x1000:rx:./myprogram.bin \\\n" +
+	"      -m periph:0x40000000:0x1000:rw --starlark periph.star\n" +
+	"\n"
+
+var fuzzUsageText string = "" +
+	"aemulari fuzz -- Coverage-guided fuzzing via the aemulari debugger (v" + ae.Version + ")\n" +
+	"Usage: %s fuzz [options]\n" +
+	"\n" +
+	"Options:\n" +
+	cmdline.FlagStr_arch +
+	cmdline.FlagStr_regs +
+	cmdline.FlagStr_mem +
+	cmdline.FlagStr_symbols +
+	cmdline.FlagStr_patch +
+	cmdline.FlagStr_call +
+	cmdline.FlagStr_fuzz +
+	cmdline.FlagStr_script +
+	cmdline.FlagStr_starlark +
+	cmdline.FlagStr_config +
+	cmdline.FlagStr_help +
+	cmdline.Details_arch +
+	cmdline.Details_mem +
+	cmdline.Details_patch +
+	cmdline.Details_call +
+	cmdline.Details_fuzz +
+	cmdline.Notes +
+	" - Scripts are run once, before fuzzing begins. Starlark callbacks remain\n" +
+	"     in effect for each input.\n" +
+	" - Statistics are written to stderr periodically and upon completion.\n" +
+	" - The exit status is 3 if any crashes were found, 1 upon an error, and\n" +
+	"     0 otherwise.\n" +
+	"\n" +
+	"Examples:\n" +
+	"  Fuzz the parse function in firmware.bin, passing each input's address and\n" +
+	"  length as its arguments, with seed inputs from the seeds directory.\n" +
+	"    aemulari fuzz -m code:0x10000:0x8000:rx:./firmware.bin \\\n" +
+	"      -m input:0x20000000:0x400:rw --input input --symbols fw.syms \\\n" +
+	"      --call \"parse @input @len\" --corpus seeds\n" +
+	"\n" +
+	"  Fuzz myprogram.bin from its initial PC, with each input's length in r1,\n" +
+	"  stopping after 100000 inputs.\n" +
+	"    aemulari fuzz -m code:0x10000:0x1000:rx:./myprogram.bin \\\n" +
+	"      -m data:0x80000:0x1000:rw --input 0x80000:0x100 --len-reg r1 \\\n" +
+	"      --iterations 100000\n" +
 	"\n"
 
 // Output the final states of registers, if requested  to do so
@@ -93,34 +293,40 @@ func parseHexdumpRequests(args cmdline.ArgMap, dbg *ae.Debugger) ([]hexdumpReque
 	return requests, nil
 }
 
+// Read the memory described by a hexdumpRequest
+func read_hexdump(r hexdumpRequest, dbg *ae.Debugger) (uint64, []byte, error) {
+	if len(r.name) != 0 {
+		addr, data, err := dbg.ReadMemRegion(r.name)
+		if err != nil {
+			err = fmt.Errorf("Failed to read memory region named \"%s\": %s",
+				r.name, err.Error())
+		}
+		return addr, data, err
+	}
+
+	data, err := dbg.ReadMem(r.addr, r.length)
+	if err != nil {
+		err = fmt.Errorf("Failed to read %d bytes of memory at 0x%08x: %s",
+			r.length, r.addr, err.Error())
+	}
+	return r.addr, data, err
+}
+
 // Print hex dumps of memory regions, if asked to do so.
 func print_hexdumps(regions []hexdumpRequest, dbg *ae.Debugger) {
 	var failures []string
 	var header string
-	var addr uint64
-	var data []byte
-	var err error
 
 	for _, r := range regions {
 		name := ""
 		if len(r.name) != 0 {
 			name = "(" + r.name + ")"
-			addr, data, err = dbg.ReadMemRegion(r.name)
-			if err != nil {
-				f := fmt.Sprintf("Failed to read memory region named \"%s\": %s",
-					r.name, err.Error())
-				failures = append(failures, f)
-				continue
-			}
-		} else {
-			addr = r.addr
-			data, err = dbg.ReadMem(addr, r.length)
-			if err != nil {
-				f := fmt.Sprintf("Failed to read %d bytes of memory at 0x%08x: %s",
-					r.length, r.addr, err.Error())
-				failures = append(failures, f)
-				continue
-			}
+		}
+
+		addr, data, err := read_hexdump(r, dbg)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
 		}
 
 		header = fmt.Sprintf(" Memory Region at 0x%08x %s", addr, name)
@@ -133,6 +339,374 @@ func print_hexdumps(regions []hexdumpRequest, dbg *ae.Debugger) {
 	}
 }
 
+// Commands sent by external tools (see --sync) are not supported here, as
+// nothing may use the Debugger while it runs. Discard them, so that their
+// reception doesn't stall once the command channel fills.
+func discard_toolsync_commands(dbg *ae.Debugger) {
+	cmds := dbg.ToolSyncCommands()
+	if cmds == nil {
+		return
+	}
+
+	go func() {
+		for range cmds {
+		}
+	}()
+}
+
+// Check that --diff regions are mapped, and that --diff-ips has a single region
+func check_diff_args(args cmdline.ArgMap, dbg *ae.Debugger) error {
+	names := args.GetStrings("diff")
+	for _, name := range names {
+		if !dbg.IsMapped(name) {
+			return fmt.Errorf("No memory region named \"%s\" is mapped.", name)
+		}
+	}
+
+	if args.Contains("diff-ips") && len(names) != 1 {
+		return errors.New("--diff-ips requires a single --diff region.")
+	}
+
+	return nil
+}
+
+// Compare each --diff region with its input file
+func read_diffs(args cmdline.ArgMap, dbg *ae.Debugger) ([]ae.RegionDiff, error) {
+	var diffs []ae.RegionDiff
+
+	for _, name := range args.GetStrings("diff") {
+		diff, err := dbg.DiffRegion(name)
+		if err != nil {
+			return diffs, err
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return diffs, nil
+}
+
+// Print the changes made to --diff regions
+func print_diffs(diffs []ae.RegionDiff) {
+	for _, diff := range diffs {
+		name := diff.Region.Name()
+		if len(diff.Ranges) == 0 {
+			fmt.Printf(" No changes to memory region \"%s\"\n\n", name)
+			continue
+		}
+
+		fmt.Printf(" Changes to memory region \"%s\": %d byte(s) in %d range(s)\n",
+			name, diff.Changed(), len(diff.Ranges))
+
+		for _, c := range diff.Ranges {
+			fmt.Printf("  0x%08x  %s -> %s\n", c.Address,
+				hex.EncodeToString(c.Original), hex.EncodeToString(c.Current))
+		}
+		fmt.Println()
+	}
+}
+
+// Write the --diff changes as an IPS patch, if requested
+func write_ips(args cmdline.ArgMap, diffs []ae.RegionDiff) error {
+	if !args.Contains("diff-ips") || len(diffs) != 1 {
+		return nil
+	}
+
+	// Don't leave a partial file behind if the changes can't be represented
+	var patch bytes.Buffer
+	if err := diffs[0].WriteIPS(&patch); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(args.GetString("diff-ips", ""), patch.Bytes(), 0644)
+}
+
+// Encode memory contents for json output, per --dump-encoding
+func encode_memory(encoding string, data []byte) string {
+	if encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hex.EncodeToString(data)
+}
+
+// Write the final state of the debugger as a single JSON document
+func write_json_report(w io.Writer, args cmdline.ArgMap, regions []hexdumpRequest,
+	diffs []ae.RegionDiff, exception ae.Exception, failures []expect.Failure,
+	runErr error, dbg *ae.Debugger) error {
+	var report jsonReport
+
+	report.Expectations = failures
+
+	pc, err := dbg.ReadRegByName("pc")
+	if err != nil {
+		return err
+	}
+
+	report.Stop.Reason = dbg.StopReason().String()
+	report.Stop.PC = pc.Value
+	report.InstructionCount = dbg.InstructionCount()
+
+	if runErr != nil {
+		report.Stop.Reason = ae.StopError.String()
+		report.Stop.Error = runErr.Error()
+	}
+
+	if exception.Occurred() {
+		report.Stop.Exception = &jsonException{
+			Kind:        exception.Kind(),
+			Description: exception.String(),
+			Signal:      exception.Signal(),
+		}
+	}
+
+	if fault, faulted := dbg.MemoryFault(); faulted {
+		report.Stop.Fault = &jsonFault{
+			Access:      fault.Access,
+			Address:     fault.Address,
+			Size:        fault.Size,
+			Unmapped:    fault.Unmapped,
+			Description: fault.String(),
+		}
+	}
+
+	if dbg.StopReason() == ae.StopBreakpoint {
+		for _, bp := range dbg.GetBreakpointsAt(pc.Value) {
+			report.Stop.Breakpoints = append(report.Stop.Breakpoints, bp.ID)
+		}
+	}
+
+	regs, err := dbg.ReadRegAll()
+	if err != nil {
+		return err
+	}
+
+	report.Registers = []jsonRegister{}
+	for _, r := range regs {
+		entry := jsonRegister{Name: r.Name(), Value: r.Value, Size: r.Size()}
+		for _, f := range r.Flags() {
+			if entry.Flags == nil {
+				entry.Flags = make(map[string]uint64)
+			}
+			entry.Flags[f.Name] = f.Value
+		}
+		report.Registers = append(report.Registers, entry)
+	}
+
+	encoding := args.GetString("dump-encoding", "hex")
+
+	report.Memory = []jsonMemory{}
+	for _, r := range regions {
+		addr, data, err := read_hexdump(r, dbg)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+
+		entry := jsonMemory{
+			Name:     r.name,
+			Address:  addr,
+			Size:     uint64(len(data)),
+			Encoding: encoding,
+		}
+
+		entry.Data = encode_memory(encoding, data)
+		report.Memory = append(report.Memory, entry)
+	}
+
+	for _, diff := range diffs {
+		entry := jsonDiff{
+			Name:     diff.Region.Name(),
+			Changed:  diff.Changed(),
+			Encoding: encoding,
+			Ranges:   []jsonDiffRange{},
+		}
+
+		for _, c := range diff.Ranges {
+			entry.Ranges = append(entry.Ranges, jsonDiffRange{
+				Address:  c.Address,
+				Size:     uint64(len(c.Current)),
+				Original: encode_memory(encoding, c.Original),
+				Current:  encode_memory(encoding, c.Current),
+			})
+		}
+
+		report.Diffs = append(report.Diffs, entry)
+	}
+
+	report.Breakpoints = []jsonBreakpoint{}
+	for _, bp := range dbg.GetBreakpoints() {
+		report.Breakpoints = append(report.Breakpoints, jsonBreakpoint{
+			ID:      bp.ID,
+			Address: bp.Address,
+			Enabled: bp.Enabled(),
+			Hits:    bp.HitCount(),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// Parse --expect, --expect-mem, and --expect-stop conditions
+func parse_expectations(args cmdline.ArgMap, dbg *ae.Debugger) (*expect.Set, error) {
+	var set expect.Set
+
+	for _, spec := range args.GetStrings("expect") {
+		if err := set.AddRegister(spec, dbg); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range args.GetStrings("expect-mem") {
+		if err := set.AddMemory(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if args.Contains("expect-stop") {
+		if err := set.SetStop(args.GetString("expect-stop", "")); err != nil {
+			return nil, err
+		}
+	}
+
+	return &set, nil
+}
+
+// Map the reason execution stopped to the process exit status
+func exit_status(reason ae.StopReason) int {
+	switch reason {
+	case ae.StopBreakpoint:
+		return exitBreakpoint
+	case ae.StopException:
+		return exitException
+	case ae.StopMemoryFault:
+		return exitFault
+	case ae.StopInterrupted, ae.StopBudget:
+		return exitInterrupted
+	case ae.StopError:
+		return exitError
+	default:
+		return exitCompleted
+	}
+}
+
+// Begin recording an instruction trace, if requested to do so.
+// Returns the trace output file, which the caller must close, or nil.
+func start_trace(args cmdline.ArgMap, dbg *ae.Debugger) (*os.File, error) {
+	var cfg ae.TraceConfig
+	var err error
+
+	if !args.Contains("trace") {
+		return nil, nil
+	}
+
+	cfg.Format, err = ae.ParseTraceFormat(args.GetString("trace-format", "text"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range args.GetStrings("trace-range") {
+		r, err := ae.ParseAddressRange(s)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Ranges = append(cfg.Ranges, r)
+	}
+
+	f, err := os.Create(args.GetString("trace", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Output = f
+	if err = dbg.StartTrace(cfg); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Write basic block coverage information, if requested to do so.
+func write_coverage(args cmdline.ArgMap, dbg *ae.Debugger) error {
+	if !args.Contains("coverage") {
+		return nil
+	}
+
+	format, err := ae.ParseCoverageFormat(args.GetString("coverage-format", "drcov"))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(args.GetString("coverage", ""))
+	if err != nil {
+		return err
+	}
+
+	err = dbg.WriteCoverage(f, format)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Run command scripts, if any were provided. Returns true if a script
+// requested that the program exit prior to execution.
+func run_scripts(args cmdline.ArgMap, arch *ae.Architecture, dbg *ae.Debugger, out io.Writer) (bool, error) {
+	scripts := args.GetStrings("script")
+	if len(scripts) == 0 {
+		return false, nil
+	}
+
+	cmds, err := ui.CreateHeadless(arch, dbg)
+	if err != nil {
+		return false, err
+	}
+
+	err = cmds.RunStartupScripts(scripts, false, func(output string) {
+		fmt.Fprintln(out, output)
+	})
+
+	return cmds.QuitRequested(), err
+}
+
+// Run Starlark scripts, if any were provided. Returns the interpreter, which
+// retains any callbacks the scripts registered, or nil.
+func run_starlark(args cmdline.ArgMap, dbg *ae.Debugger, out io.Writer) (*scripting.Interpreter, error) {
+	scripts := args.GetStrings("starlark")
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+
+	interp := scripting.New(dbg, out)
+	for _, filename := range scripts {
+		if err := interp.RunFile(filename); err != nil {
+			return interp, err
+		}
+	}
+
+	return interp, nil
+}
+
+// Call the function specified via --call and report its return values
+func call_function(args cmdline.ArgMap, dbg *ae.Debugger, out io.Writer) (ae.Exception, error) {
+	fields := strings.Fields(args.GetString("call", ""))
+
+	addr, callArgs, err := cmdline.ParseCall(fields, dbg)
+	if err != nil {
+		return ae.Exception{}, err
+	}
+
+	result, err := dbg.Call(addr, callArgs...)
+	if err != nil && result.Reason != ae.StopMemoryFault {
+		return result.Exception, err
+	}
+
+	fmt.Fprintln(out, cmdline.FormatCallResult(result))
+	return result.Exception, nil
+}
+
 // Step `instr-count` instructions
 func step(args cmdline.ArgMap, dbg *ae.Debugger) (ae.Exception, error) {
 	var ex ae.Exception
@@ -147,49 +721,397 @@ func step(args cmdline.ArgMap, dbg *ae.Debugger) (ae.Exception, error) {
 	return dbg.Step(count)
 }
 
+// Parse the --input region, specified by name or as <addr:size>
+func parse_fuzz_input(args cmdline.ArgMap, dbg *ae.Debugger) (uint64, uint64, error) {
+	spec := args.GetString("input", "")
+	if spec == "" {
+		return 0, 0, errors.New("An input region must be specified via --input.")
+	}
+
+	for _, r := range dbg.Mapped() {
+		if r.Name() == spec {
+			addr, size := r.Region()
+			return addr, size, nil
+		}
+	}
+
+	fields := strings.Split(spec, ":")
+	if len(fields) != 2 {
+		return 0, 0, errors.New("Invalid input region: " + spec)
+	}
+
+	addr, err := dbg.ParseAddress(fields[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size, err := strconv.ParseUint(fields[1], 0, 64)
+	if err != nil || size == 0 {
+		return 0, 0, errors.New("Invalid input region size: " + fields[1])
+	}
+
+	return addr, size, nil
+}
+
+// Parse the --call function used when fuzzing, in which the arguments
+// "@input" and "@len" are replaced by each input's address and length.
+func parse_fuzz_call(args cmdline.ArgMap, dbg *ae.Debugger) (uint64, func(input, length uint64) []uint64, error) {
+	var inputArgs, lenArgs []int
+
+	fields := strings.Fields(args.GetString("call", ""))
+	for i, f := range fields {
+		switch f {
+		case "@input":
+			inputArgs = append(inputArgs, i-1)
+			fields[i] = "0"
+		case "@len":
+			lenArgs = append(lenArgs, i-1)
+			fields[i] = "0"
+		}
+	}
+
+	addr, callArgs, err := cmdline.ParseCall(fields, dbg)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return addr, func(input, length uint64) []uint64 {
+		for _, i := range inputArgs {
+			callArgs[i] = input
+		}
+		for _, i := range lenArgs {
+			callArgs[i] = length
+		}
+		return callArgs
+	}, nil
+}
+
+// Parse a numeric option, returning `defaultVal` if it was not specified
+func parse_u64(args cmdline.ArgMap, name string, defaultVal uint64) (uint64, error) {
+	if !args.Contains(name) {
+		return defaultVal, nil
+	}
+
+	value, err := strconv.ParseUint(args.GetString(name, ""), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid --%s value: %s", name, args.GetString(name, ""))
+	}
+
+	return value, nil
+}
+
+// Fuzz the target described by the command line arguments, until the
+// requested number of iterations complete or SIGINT is received.
+func run_fuzzer(args cmdline.ArgMap, arch *ae.Architecture, dbg *ae.Debugger) (fuzz.Stats, error) {
+	var cfg fuzz.Config
+	var fuzzCfg fuzz.FuzzerConfig
+	var stats fuzz.Stats
+	var err error
+
+	quit, err := run_scripts(args, arch, dbg, os.Stderr)
+	if err != nil || quit {
+		return stats, err
+	}
+
+	interp, err := run_starlark(args, dbg, os.Stderr)
+	if err != nil {
+		return stats, err
+	}
+
+	if cfg.InputAddr, cfg.MaxLen, err = parse_fuzz_input(args, dbg); err != nil {
+		return stats, err
+	}
+
+	cfg.LengthReg = args.GetString("len-reg", "")
+
+	if cfg.Budget, err = parse_u64(args, "budget", 100000); err != nil {
+		return stats, err
+	}
+
+	if args.Contains("call") {
+		if cfg.CallAddr, cfg.Args, err = parse_fuzz_call(args, dbg); err != nil {
+			return stats, err
+		}
+	}
+
+	fuzzCfg.CorpusDir = args.GetString("corpus", "")
+	fuzzCfg.CrashDir = args.GetString("crashes", "crashes")
+	fuzzCfg.Log = os.Stderr
+
+	if fuzzCfg.Iterations, err = parse_u64(args, "iterations", 0); err != nil {
+		return stats, err
+	}
+
+	seed, err := parse_u64(args, "seed", uint64(time.Now().UnixNano()))
+	if err != nil {
+		return stats, err
+	}
+	fuzzCfg.Seed = int64(seed)
+	fmt.Fprintf(os.Stderr, "Random seed: %d\n", seed)
+
+	harness, err := fuzz.NewHarness(dbg, cfg)
+	if err != nil {
+		return stats, err
+	}
+
+	fuzzer, err := fuzz.NewFuzzer(harness, fuzzCfg)
+	if err != nil {
+		return stats, err
+	}
+
+	// Stop cleanly upon Ctrl-C, so that statistics are reported
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	go func() {
+		if _, ok := <-interrupt; ok {
+			fuzzer.Stop()
+			dbg.Interrupt()
+		}
+	}()
+
+	err = fuzzer.Run()
+	if err == nil && interp != nil {
+		err = interp.CallbackError()
+	}
+
+	return fuzzer.Stats(), err
+}
+
+// Entry point for "aemulari fuzz"
+func fuzz_main() int {
+	supportedFlags := cmdline.SupportedFlags{
+		cmdline.Flag_arch,
+		cmdline.Flag_reg,
+		cmdline.Flag_mem,
+		cmdline.Flag_symbols,
+		cmdline.Flag_patch,
+		cmdline.Flag_call,
+		cmdline.Flag_fuzzInput,
+		cmdline.Flag_lenReg,
+		cmdline.Flag_budget,
+		cmdline.Flag_corpus,
+		cmdline.Flag_crashes,
+		cmdline.Flag_iterations,
+		cmdline.Flag_seed,
+		cmdline.Flag_script,
+		cmdline.Flag_starlark,
+		cmdline.Flag_config,
+	}
+
+	args, arch, dbg := cmdline.Parse(supportedFlags, fuzzUsageText)
+	defer dbg.Close()
+
+	discard_toolsync_commands(dbg)
+
+	stats, err := run_fuzzer(args, arch, dbg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	} else if stats.UniqueCrashes != 0 {
+		return exitException
+	}
+
+	return exitCompleted
+}
+
 func main() {
 	var exception ae.Exception
+	var traceFile *os.File
+	var interp *scripting.Interpreter
+	var quit bool
+	var served bool
+	var jsonOutput bool
+	var scriptOut io.Writer = os.Stdout
+	var exitCode int = exitError
+	var expectations *expect.Set
+	var failures []expect.Failure
+	var diffs []ae.RegionDiff
 	var err error
 
+	if len(os.Args) > 1 && os.Args[1] == "fuzz" {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		os.Exit(fuzz_main())
+	}
+
 	supportedFlags := cmdline.SupportedFlags{
 		cmdline.Flag_arch,
 		cmdline.Flag_reg,
 		cmdline.Flag_mem,
 		cmdline.Flag_instrcount,
 		cmdline.Flag_breakpoint,
+		cmdline.Flag_symbols,
+		cmdline.Flag_patch,
+		cmdline.Flag_call,
 		cmdline.Flag_printRegs,
 		cmdline.Flag_hexdump,
+		cmdline.Flag_diff,
+		cmdline.Flag_diffIps,
+		cmdline.Flag_output,
+		cmdline.Flag_dumpEncoding,
+		cmdline.Flag_expect,
+		cmdline.Flag_expectMem,
+		cmdline.Flag_expectStop,
+		cmdline.Flag_trace,
+		cmdline.Flag_traceFormat,
+		cmdline.Flag_traceRange,
+		cmdline.Flag_coverage,
+		cmdline.Flag_coverageFormat,
+		cmdline.Flag_gdb,
+		cmdline.Flag_serve,
+		cmdline.Flag_script,
+		cmdline.Flag_starlark,
+		cmdline.Flag_config,
 	}
 
 	// Fetch an initialized debugger and any unhandled args.
-	args, _, dbg := cmdline.Parse(supportedFlags, usageText)
+	args, arch, dbg := cmdline.Parse(supportedFlags, usageText)
+	discard_toolsync_commands(dbg)
 
 	// Finish remaining argument parsing tasks
+	jsonOutput = args.GetString("output", "text") == "json"
+	if jsonOutput {
+		scriptOut = os.Stderr
+	}
+
 	hexdumpRequests, err := parseHexdumpRequests(args, dbg)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		goto cleanup
 	}
 
+	if err = check_diff_args(args, dbg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		goto cleanup
+	}
+
+	expectations, err = parse_expectations(args, dbg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		goto cleanup
+	}
+
+	traceFile, err = start_trace(args, dbg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		goto cleanup
+	}
+
+	if args.Contains("coverage") {
+		dbg.StartCoverage()
+	}
+
+	quit, err = run_scripts(args, arch, dbg, scriptOut)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		goto cleanup
+	}
+
+	interp, err = run_starlark(args, dbg, scriptOut)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		goto cleanup
+	}
+
 	// Execute our program
-	if args.Contains("instr-count") {
+	if quit || (interp != nil && interp.Executed()) {
+		// A script has requested that we skip execution, or has run
+		// the program itself.
+	} else if args.Contains("gdb") {
+		err = gdbstub.Serve(args.GetString("gdb", ""), *arch, dbg, os.Stderr)
+		served = true
+	} else if args.Contains("serve") {
+		err = remote.Serve(args.GetString("serve", ""), dbg, os.Stderr)
+		served = true
+	} else if args.Contains("call") {
+		exception, err = call_function(args, dbg, scriptOut)
+	} else if args.Contains("instr-count") {
 		exception, err = step(args, dbg)
 	} else {
 		exception, err = dbg.Continue()
 	}
 
+	// An invalid memory access stops execution, as an exception does
+	if err != nil && dbg.StopReason() == ae.StopMemoryFault {
+		err = nil
+	}
+
+	// Report errors raised by Starlark callbacks during execution
+	if interp != nil && err == nil {
+		err = interp.CallbackError()
+	}
+
+	if err == nil {
+		// Execution stopped at a client's request, rather than on its own
+		if served {
+			exitCode = exitCompleted
+		} else {
+			exitCode = exit_status(dbg.StopReason())
+		}
+		failures, err = expectations.Check(dbg, exception)
+	}
+
 	if err == nil {
-		if exception.Occurred() {
-			fmt.Println("Execution terminated due to exception: %s\n", exception.String())
+		if len(failures) != 0 {
+			fmt.Fprintln(os.Stderr, "Expectations not met:")
+			for _, f := range failures {
+				fmt.Fprint(os.Stderr, f.String())
+			}
+			exitCode = exitExpectation
+		} else if !expectations.Empty() {
+			exitCode = exitCompleted
 		}
 
 		// Output information requested by cmdline args
-		print_registers(args, dbg)
-		print_hexdumps(hexdumpRequests, dbg)
+		diffs, err = read_diffs(args, dbg)
+		if err == nil && jsonOutput {
+			err = write_json_report(os.Stdout, args, hexdumpRequests, diffs, exception, failures, nil, dbg)
+		} else if err == nil {
+			if exception.Occurred() {
+				fmt.Printf("Execution terminated due to exception: %s\n", exception.String())
+			} else if fault, faulted := dbg.MemoryFault(); faulted {
+				fmt.Printf("Execution terminated due to invalid memory access: %s\n", fault.String())
+			}
+
+			print_registers(args, dbg)
+			print_hexdumps(hexdumpRequests, dbg)
+			print_diffs(diffs)
+		}
+
+		if err == nil {
+			err = write_ips(args, diffs)
+		}
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write output: "+err.Error())
+			exitCode = exitError
+		}
+
+		if err = write_coverage(args, dbg); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write coverage information: "+err.Error())
+			exitCode = exitError
+		}
 	} else {
 		fmt.Fprintln(os.Stderr, err)
+
+		// Consumers of the JSON report still need to learn of the failure
+		if jsonOutput {
+			if err = write_json_report(os.Stdout, args, hexdumpRequests, nil, exception, nil, err, dbg); err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to write output: "+err.Error())
+			}
+		}
 	}
 
 cleanup:
+	if traceFile != nil {
+		if err := dbg.StopTrace(); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write instruction trace: "+err.Error())
+			exitCode = exitError
+		}
+		traceFile.Close()
+	}
+
 	dbg.Close()
+	os.Exit(exitCode)
 }
@@ -0,0 +1,77 @@
+package cmdline
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ae "../../../aemulari.v0"
+)
+
+// Parse a function call specification of the form <addr|symbol> [args...],
+// allocating any string or buffer arguments in the Debugger's scratch region.
+// Returns the function address and argument values.
+func ParseCall(fields []string, dbg *ae.Debugger) (uint64, []uint64, error) {
+	var args []uint64
+
+	if len(fields) == 0 {
+		return 0, nil, errors.New("No function address or symbol was specified.")
+	}
+
+	addr, err := dbg.ParseAddress(fields[0])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, f := range fields[1:] {
+		value, err := parseCallArg(f, dbg)
+		if err != nil {
+			return 0, nil, err
+		}
+		args = append(args, value)
+	}
+
+	return addr, args, nil
+}
+
+func parseCallArg(arg string, dbg *ae.Debugger) (uint64, error) {
+	switch {
+	case strings.HasPrefix(arg, "str:"):
+		return dbg.AllocData(append([]byte(arg[4:]), 0))
+
+	case strings.HasPrefix(arg, "hex:"):
+		data, err := hex.DecodeString(arg[4:])
+		if err != nil || len(data) == 0 {
+			return 0, fmt.Errorf("Invalid hex buffer argument: %s", arg)
+		}
+		return dbg.AllocData(data)
+
+	case strings.HasPrefix(arg, "buf:"):
+		size, err := strconv.ParseUint(arg[4:], 0, 64)
+		if err != nil || size == 0 {
+			return 0, fmt.Errorf("Invalid buffer size: %s", arg)
+		}
+		return dbg.Alloc(size)
+
+	default:
+		return dbg.ParseAddress(arg)
+	}
+}
+
+// Return a string describing the outcome of a function call, including
+// its return values.
+func FormatCallResult(result ae.CallResult) string {
+	var values []string
+
+	if !result.Returned {
+		return result.String()
+	}
+
+	for i, v := range result.Return {
+		values = append(values, fmt.Sprintf("ret%d = 0x%08x", i, v))
+	}
+
+	return "Returned: " + strings.Join(values, ", ")
+}
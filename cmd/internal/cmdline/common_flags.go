@@ -50,9 +50,181 @@ var Flag_hexdump *Flag = &Flag{
 	ValueReqt:  Required,
 }
 
+var Flag_diff *Flag = &Flag{
+	Long:       "--diff",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_diffIps *Flag = &Flag{
+	Long:       "--diff-ips",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
 var Flag_sync *Flag = &Flag{
-	Short:		"-S",
-	Long:		"--sync",
-	Occurrence:	Once,
-	ValueReqt:	None,
+	Short:      "-S",
+	Long:       "--sync",
+	Occurrence: Once,
+	ValueReqt:  Optional,
+}
+
+var Flag_trace *Flag = &Flag{
+	Short:      "-t",
+	Long:       "--trace",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_traceFormat *Flag = &Flag{
+	Long:        "--trace-format",
+	Occurrence:  Once,
+	ValueReqt:   Required,
+	ValidValues: []string{"text", "json"},
+}
+
+var Flag_traceRange *Flag = &Flag{
+	Long:       "--trace-range",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_coverage *Flag = &Flag{
+	Short:      "-c",
+	Long:       "--coverage",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_coverageFormat *Flag = &Flag{
+	Long:        "--coverage-format",
+	Occurrence:  Once,
+	ValueReqt:   Required,
+	ValidValues: []string{"drcov", "list"},
+}
+
+var Flag_gdb *Flag = &Flag{
+	Short:      "-g",
+	Long:       "--gdb",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_config *Flag = &Flag{
+	Short:      "-C",
+	Long:       "--config",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_script *Flag = &Flag{
+	Short:      "-x",
+	Long:       "--script",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_starlark *Flag = &Flag{
+	Long:       "--starlark",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_serve *Flag = &Flag{
+	Long:       "--serve",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_output *Flag = &Flag{
+	Short:       "-o",
+	Long:        "--output",
+	Occurrence:  Once,
+	ValueReqt:   Required,
+	ValidValues: []string{"text", "json"},
+}
+
+var Flag_dumpEncoding *Flag = &Flag{
+	Long:        "--dump-encoding",
+	Occurrence:  Once,
+	ValueReqt:   Required,
+	ValidValues: []string{"hex", "base64"},
+}
+
+var Flag_expect *Flag = &Flag{
+	Long:       "--expect",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_expectMem *Flag = &Flag{
+	Long:       "--expect-mem",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_expectStop *Flag = &Flag{
+	Long:       "--expect-stop",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_symbols *Flag = &Flag{
+	Long:       "--symbols",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_patch *Flag = &Flag{
+	Long:       "--patch",
+	Occurrence: Multiple,
+	ValueReqt:  Required,
+}
+
+var Flag_call *Flag = &Flag{
+	Long:       "--call",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_fuzzInput *Flag = &Flag{
+	Long:       "--input",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_lenReg *Flag = &Flag{
+	Long:       "--len-reg",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_budget *Flag = &Flag{
+	Long:       "--budget",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_corpus *Flag = &Flag{
+	Long:       "--corpus",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_crashes *Flag = &Flag{
+	Long:       "--crashes",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_iterations *Flag = &Flag{
+	Long:       "--iterations",
+	Occurrence: Once,
+	ValueReqt:  Required,
+}
+
+var Flag_seed *Flag = &Flag{
+	Long:       "--seed",
+	Occurrence: Once,
+	ValueReqt:  Required,
 }
@@ -0,0 +1,376 @@
+package cmdline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+
+	ae "../../../aemulari.v0"
+)
+
+// A numeric configuration value. This may be specified as an integer or as
+// a string, which permits hex values in formats that lack them (e.g., JSON).
+type Number uint64
+
+func parseNumber(s string) (Number, error) {
+	v, err := strconv.ParseUint(strings.TrimSpace(s), 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid numeric value: %s", s)
+	}
+	return Number(v), nil
+}
+
+// Numbers are written as hex strings
+func (n Number) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("0x%x", uint64(n))), nil
+}
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	var err error
+	var s string
+
+	if len(b) > 0 && b[0] == '"' {
+		if err = json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else {
+		s = string(b)
+	}
+
+	*n, err = parseNumber(s)
+	return err
+}
+
+func (n *Number) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	v, err := parseNumber(s)
+	*n = v
+	return err
+}
+
+func (n *Number) UnmarshalTOML(value interface{}) error {
+	var err error
+
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("Invalid numeric value: %d", v)
+		}
+		*n = Number(v)
+	case string:
+		*n, err = parseNumber(v)
+	default:
+		err = fmt.Errorf("Invalid numeric value: %v", value)
+	}
+
+	return err
+}
+
+// Memory region configuration
+type RegionConfig struct {
+	Name        string `json:"name" yaml:"name" toml:"name"`
+	Base        Number `json:"base" yaml:"base" toml:"base"`
+	Size        Number `json:"size" yaml:"size" toml:"size"`
+	Perms       string `json:"perms,omitempty" yaml:"perms,omitempty" toml:"perms,omitempty"`
+	Input       string `json:"input,omitempty" yaml:"input,omitempty" toml:"input,omitempty"`
+	InputOffset Number `json:"offset,omitempty" yaml:"offset,omitempty" toml:"offset,omitempty"`
+	InputFormat string `json:"format,omitempty" yaml:"format,omitempty" toml:"format,omitempty"`
+	Output      string `json:"output,omitempty" yaml:"output,omitempty" toml:"output,omitempty"`
+}
+
+// Project or session configuration, loaded via --config
+type Config struct {
+	Arch        string            `json:"arch,omitempty" yaml:"arch,omitempty" toml:"arch,omitempty"`
+	Regions     []RegionConfig    `json:"regions,omitempty" yaml:"regions,omitempty" toml:"regions,omitempty"`
+	Registers   map[string]Number `json:"registers,omitempty" yaml:"registers,omitempty" toml:"registers,omitempty"`
+	Breakpoints []Number          `json:"breakpoints,omitempty" yaml:"breakpoints,omitempty" toml:"breakpoints,omitempty"`
+	Sync        string            `json:"sync,omitempty" yaml:"sync,omitempty" toml:"sync,omitempty"`
+	Symbols     []string          `json:"symbols,omitempty" yaml:"symbols,omitempty" toml:"symbols,omitempty"`
+	Patches     []string          `json:"patches,omitempty" yaml:"patches,omitempty" toml:"patches,omitempty"`
+	Scripts     []string          `json:"scripts,omitempty" yaml:"scripts,omitempty" toml:"scripts,omitempty"`
+	Starlark    []string          `json:"starlark,omitempty" yaml:"starlark,omitempty" toml:"starlark,omitempty"`
+}
+
+// Configuration file formats, determined by file extension
+type configFormat int
+
+const (
+	configJSON configFormat = iota
+	configYAML
+	configTOML
+)
+
+func configFormatOf(filename string) (configFormat, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return configJSON, nil
+	case ".yaml", ".yml":
+		return configYAML, nil
+	case ".toml":
+		return configTOML, nil
+	default:
+		return configJSON, fmt.Errorf("Unsupported configuration file type: %s "+
+			"(expected .json, .yaml, .yml, or .toml)", filename)
+	}
+}
+
+// Load a configuration file. The format is determined by the file extension.
+// Relative paths to input, output, and script files are interpreted
+// relative to the directory containing the configuration file. Unknown keys
+// are rejected, so that misspelled settings aren't silently ignored.
+func LoadConfig(filename string) (*Config, error) {
+	var cfg Config
+
+	format, err := configFormatOf(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case configJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	case configYAML:
+		err = yaml.UnmarshalStrict(data, &cfg)
+	case configTOML:
+		var md toml.MetaData
+		if md, err = toml.Decode(string(data), &cfg); err == nil {
+			err = undecodedTOMLKeys(md)
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", filename, err.Error())
+	}
+
+	cfg.resolvePaths(filepath.Dir(filename))
+	return &cfg, nil
+}
+
+// Returns an error listing keys that don't correspond to a Config field
+func undecodedTOMLKeys(md toml.MetaData) error {
+	var keys []string
+	for _, key := range md.Undecoded() {
+		keys = append(keys, key.String())
+	}
+
+	if len(keys) > 0 {
+		return fmt.Errorf("Unknown keys: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// Interpret relative paths as relative to `dir`
+func (c *Config) resolvePaths(dir string) {
+	c.mapPaths(func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	})
+}
+
+// Replace each input, output, symbol, patch, and script file path with the
+// result of `fn`. The path lists are copied, rather than modified in place.
+func (c *Config) mapPaths(fn func(path string) string) {
+	apply := func(path string) string {
+		if path == "" {
+			return path
+		}
+		return fn(path)
+	}
+
+	applyAll := func(paths []string) []string {
+		if paths == nil {
+			return nil
+		}
+
+		ret := make([]string, len(paths))
+		for i, path := range paths {
+			ret[i] = apply(path)
+		}
+		return ret
+	}
+
+	regions := make([]RegionConfig, len(c.Regions))
+	for i, r := range c.Regions {
+		r.Input = apply(r.Input)
+		r.Output = apply(r.Output)
+		regions[i] = r
+	}
+
+	if c.Regions != nil {
+		c.Regions = regions
+	}
+
+	c.Symbols = applyAll(c.Symbols)
+	c.Patches = applyAll(c.Patches)
+	c.Scripts = applyAll(c.Scripts)
+	c.Starlark = applyAll(c.Starlark)
+}
+
+// Returns `path`, which may be relative to the working directory, relative to
+// `dir` instead. An absolute path is returned if this isn't possible.
+func relativePath(dir, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	if rel, err := filepath.Rel(dir, abs); err == nil {
+		return rel
+	}
+	return abs
+}
+
+// Write the configuration to a file. The format is determined by the
+// file extension. Relative paths are rewritten to be relative to the
+// directory containing the file, as LoadConfig() expects.
+func (c *Config) Save(filename string) error {
+	var data []byte
+
+	format, err := configFormatOf(filename)
+	if err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	saved := *c
+	saved.mapPaths(func(path string) string {
+		if filepath.IsAbs(path) {
+			return path
+		}
+		return relativePath(dir, path)
+	})
+
+	switch format {
+	case configJSON:
+		data, err = json.MarshalIndent(saved, "", "  ")
+		data = append(data, '\n')
+	case configYAML:
+		data, err = yaml.Marshal(saved)
+	case configTOML:
+		var buf bytes.Buffer
+		err = toml.NewEncoder(&buf).Encode(saved)
+		data = buf.Bytes()
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// Create the memory region described by a RegionConfig
+func (r RegionConfig) MemRegion() (ae.MemRegion, error) {
+	perms := r.Perms
+	if perms == "" {
+		perms = "rwx"
+	}
+
+	region, err := ae.NewMemRegionFromFields(r.Name, uint64(r.Base), uint64(r.Size),
+		perms, r.Input, r.Output)
+	if err != nil {
+		return region, err
+	}
+
+	format, err := ae.ParseInputFormat(r.InputFormat)
+	if err != nil {
+		return region, err
+	}
+
+	err = region.SetInputOptions(uint64(r.InputOffset), format)
+	return region, err
+}
+
+// Returns register assignments in the <name>=<value> form accepted by
+// Architecture.ParseRegisters(), sorted by name
+func (c *Config) registerStrings() []string {
+	var ret []string
+	for name, value := range c.Registers {
+		ret = append(ret, fmt.Sprintf("%s=0x%x", name, uint64(value)))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Capture the current state of a Debugger as a Config, suitable for saving
+// and later restoring via --config.
+func SessionConfig(arch ae.Architecture, dbg *ae.Debugger) (*Config, error) {
+	var cfg Config
+
+	cfg.Arch = arch.Spec()
+
+	for _, r := range dbg.Mapped() {
+		base, size := r.Region()
+		input, offset, format := r.InputFile()
+
+		rc := RegionConfig{
+			Name:   r.Name(),
+			Base:   Number(base),
+			Size:   Number(size),
+			Perms:  r.Permissions().String(),
+			Input:  input,
+			Output: r.OutputFile(),
+		}
+
+		if input != "" {
+			rc.InputOffset = Number(offset)
+			if format != ae.InputRaw {
+				rc.InputFormat = format.String()
+			}
+		}
+
+		cfg.Regions = append(cfg.Regions, rc)
+	}
+
+	regs, err := dbg.ReadRegAll()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.Registers = make(map[string]Number)
+	for _, r := range regs {
+		cfg.Registers[r.Name()] = Number(r.Value)
+	}
+
+	seen := make(map[uint64]bool)
+	for _, bp := range dbg.GetBreakpoints() {
+		if !seen[bp.Address] {
+			cfg.Breakpoints = append(cfg.Breakpoints, Number(bp.Address))
+			seen[bp.Address] = true
+		}
+	}
+
+	cfg.Symbols = dbg.SymbolFiles()
+	cfg.Patches = dbg.PatchFiles()
+
+	if syncCfg, enabled := dbg.ToolSyncConfig(); enabled {
+		cfg.Sync = syncCfg.String()
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,95 @@
+package cmdline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Relative paths are saved relative to the configuration file, so that they
+// refer to the same files once loaded, regardless of where it was saved
+func TestSaveRelativePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aemulari-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	abs, err := filepath.Abs("code.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{
+		Regions: []RegionConfig{{Name: "code", Input: "code.bin", Output: "/tmp/out.bin"}},
+		Symbols: []string{"code.syms"},
+	}
+
+	filename := filepath.Join(dir, "session", "s.json")
+	if err = os.Mkdir(filepath.Dir(filename), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = cfg.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Regions[0].Input != "code.bin" {
+		t.Errorf("Save() modified the configuration: %s", cfg.Regions[0].Input)
+	}
+
+	loaded, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if input, _ := filepath.Abs(loaded.Regions[0].Input); input != abs {
+		t.Errorf("Input file loaded as %s, expected %s", input, abs)
+	}
+
+	if output := loaded.Regions[0].Output; output != "/tmp/out.bin" {
+		t.Errorf("Output file loaded as %s, expected /tmp/out.bin", output)
+	}
+
+	if syms, _ := filepath.Abs(loaded.Symbols[0]); syms != filepath.Join(filepath.Dir(abs), "code.syms") {
+		t.Errorf("Symbol file loaded as %s", syms)
+	}
+}
+
+// Unknown keys are rejected in every format, rather than silently ignored
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aemulari-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name     string
+		contents string
+		valid    bool
+	}{
+		{"valid.json", `{"arch": "arm", "registers": {"sp": "0x8000"}, "regions": [{"name": "code", "base": 65536, "size": 4096}]}`, true},
+		{"key.json", `{"arch": "arm", "breakpoint": ["0x10000"]}`, false},
+		{"region.json", `{"regions": [{"name": "code", "base": 65536, "size": 4096, "perm": "rx"}]}`, false},
+
+		{"valid.yaml", "arch: arm\nregisters:\n  sp: 0x8000\n", true},
+		{"key.yaml", "arch: arm\nbreakpoint: [0x10000]\n", false},
+
+		{"valid.toml", "arch = \"arm\"\n[registers]\nsp = \"0x8000\"\n[[regions]]\nname = \"code\"\nbase = 65536\nsize = 4096\n", true},
+		{"key.toml", "arch = \"arm\"\nbreakpoint = [\"0x10000\"]\n", false},
+		{"region.toml", "[[regions]]\nname = \"code\"\nbase = 65536\nsize = 4096\nperm = \"rx\"\n", false},
+	}
+
+	for _, test := range tests {
+		filename := filepath.Join(dir, test.name)
+		if err = ioutil.WriteFile(filename, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = LoadConfig(filename); (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error status: %v", test.name, err)
+		}
+	}
+}
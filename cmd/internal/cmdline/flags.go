@@ -47,7 +47,8 @@ func (s *SupportedFlags) Add(f *Flag) *SupportedFlags {
 // Retrieve a Flag by its short or long form
 func (s *SupportedFlags) lookup(flag string) *Flag {
 	for _, elt := range *s {
-		if flag == elt.Short || flag == elt.Long {
+		// Not all flags have a short form
+		if (flag == elt.Short && elt.Short != "") || flag == elt.Long {
 			return elt
 		}
 	}
@@ -43,12 +43,221 @@ const FlagStr_printHexdump = "" +
 	"                <addr:size>    completes. The region may be specified by name or\n" +
 	"                               by an address and size.\n"
 
+const FlagStr_diff = "" +
+	"      --diff <name>           List the changes made to a memory region, relative\n" +
+	"                               to its input file (or zeros, if it has none),\n" +
+	"                               after execution completes.\n" +
+	"      --diff-ips <file>       Write the changes listed by a single --diff as an\n" +
+	"                               IPS patch, which applies to the region's input\n" +
+	"                               file. Only raw binary input files are supported.\n"
+
+const FlagStr_symbols = "" +
+	"      --symbols <file>        Load symbols from a file containing lines of the\n" +
+	"                               form \"<addr> [type] <name>\" (e.g., nm output).\n"
+
+const FlagStr_patch = "" +
+	"      --patch <file>          Apply the patches in <file> once memory is loaded,\n" +
+	"                               and again upon each reset. See \"Patch Files\".\n"
+
+const Details_patch = "" +
+	"\nPatch Files:\n" +
+	"  Each line of a patch file modifies memory at an address, given in hex, as\n" +
+	"  either replacement bytes or assembly code:\n" +
+	"\n" +
+	"    <address> <original bytes> <new bytes>\n" +
+	"    <address> <original bytes> asm <instruction>[; instruction] ...\n" +
+	"\n" +
+	"  Loading fails unless memory contains the <original bytes>, in hex, which\n" +
+	"  may instead be \"*\" to skip this check. Text following a '#' is ignored,\n" +
+	"  other than within assembly code. For example:\n" +
+	"\n" +
+	"    0x10024 0a000003 00f020e3    # Skip the checksum test\n" +
+	"    0x10100 * asm mov r0, #0; bx lr\n"
+
+const FlagStr_call = "" +
+	"      --call <func> [args]    Call the function at an address or symbol with\n" +
+	"                               the specified arguments, rather than executing\n" +
+	"                               from the initial PC. See \"Function Calls\".\n"
+
+const Details_call = "" +
+	"\nFunction Calls:\n" +
+	"  Functions are called per the architecture's calling convention (the AAPCS\n" +
+	"  for Arm). For Arm, bit 0 of the address selects Thumb state. Arguments may\n" +
+	"  be numbers, symbols, or the following, which are allocated in a \"scratch\"\n" +
+	"  region and passed by address. The scratch region also holds the stack and\n" +
+	"  the return address, so it must be executable. It is mapped automatically\n" +
+	"  if not specified.\n" +
+	"\n" +
+	"    str:<text>     NUL-terminated string\n" +
+	"    hex:<bytes>    Buffer initialized with the specified hex bytes\n" +
+	"    buf:<size>     Zeroed buffer of <size> bytes\n" +
+	"\n" +
+	"  The function runs until it returns, at which point all registers other\n" +
+	"  than the return value registers (r0 and r1 for Arm) are restored.\n"
+
+const FlagStr_output = "" +
+	"  -o, --output <fmt>          Output format: text (default), json\n" +
+	"                               The json format writes a single document\n" +
+	"                               containing the stop reason, registers,\n" +
+	"                               --hexdump regions, --diff changes, instruction\n" +
+	"                               count, and breakpoint hit counts. If execution\n" +
+	"                               fails, the stop reason is \"error\".\n" +
+	"      --dump-encoding <enc>   Encoding of memory in json output: hex (default),\n" +
+	"                               base64\n"
+
+const FlagStr_expect = "" +
+	"      --expect <reg>=<value>  Fail unless a register has the specified value\n" +
+	"                               once execution completes.\n" +
+	"      --expect-mem <addr>=<hex>\n" +
+	"                               Fail unless memory at <addr> contains the\n" +
+	"                               specified bytes (e.g., 0x80000=deadbeef).\n" +
+	"      --expect-stop <reason>  Fail unless execution stopped for the specified\n" +
+	"                               reason: breakpoint[:addr], exception[:kind],\n" +
+	"                               step, end, return, or fault. Exception kinds\n" +
+	"                               include bkpt, udef, swi, data-abort, and\n" +
+	"                               prefetch-abort.\n"
+
+const Details_exitStatus = "" +
+	"\nExit Status:\n" +
+	"  When expectations are specified, 0 indicates that all were met.\n" +
+	"\n" +
+	"  0    Execution completed: the instruction count was reached, execution\n" +
+	"         reached the end of the code region, a --call function returned,\n" +
+	"         or a script or client ended the session.\n" +
+	"  1    An error occurred.\n" +
+	"  2    Execution stopped at a breakpoint.\n" +
+	"  3    A processor exception occurred.\n" +
+	"  4    Execution was interrupted (e.g., by a GDB client), or exhausted\n" +
+	"         its instruction budget.\n" +
+	"  5    One or more --expect, --expect-mem, or --expect-stop conditions\n" +
+	"         were not met.\n" +
+	"  6    An invalid memory access occurred.\n"
+
+const FlagStr_trace = "" +
+	"  -t, --trace <file>          Record a trace of each executed instruction,\n" +
+	"                               its opcode, and changed registers to <file>.\n" +
+	"      --trace-format <fmt>    Trace format: text (default), json\n" +
+	"                               The json format writes one object per line.\n" +
+	"      --trace-range <addr:size>\n" +
+	"                               Only trace instructions within the specified\n" +
+	"                               range. May be specified multiple times.\n"
+
+const FlagStr_coverage = "" +
+	"  -c, --coverage <file>       Write basic block coverage information to <file>.\n" +
+	"      --coverage-format <fmt> Coverage format: drcov (default), list\n" +
+	"                               The drcov format may be loaded by Lighthouse\n" +
+	"                               and Cartographer. The list format contains one\n" +
+	"                               block address per line.\n"
+
+const FlagStr_gdb = "" +
+	"  -g, --gdb <[host:]port>     Wait for a connection from a GDB Remote Serial\n" +
+	"                               Protocol client (e.g., gdb-multiarch) and let\n" +
+	"                               it control execution. If no host is specified,\n" +
+	"                               only local connections are accepted.\n"
+
+const FlagStr_config = "" +
+	"  -C, --config <file>         Load settings from a .json, .yaml, or .toml file.\n" +
+	"                               Command line options override its values.\n"
+
+const Details_config = "" +
+	"\nConfiguration Files:\n" +
+	"  A configuration file may specify any of the following items. Numeric values\n" +
+	"  may be integers or strings (e.g., \"0x10000\"). Relative paths are relative\n" +
+	"  to the directory containing the configuration file.\n" +
+	"\n" +
+	"    arch: arm:thumb\n" +
+	"    regions:\n" +
+	"      - name: code\n" +
+	"        base: 0x10000\n" +
+	"        size: 0x1000\n" +
+	"        perms: rx               # Default: rwx\n" +
+	"        input: firmware.hex\n" +
+	"        format: ihex            # raw (default) or ihex\n" +
+	"        offset: 0x0             # Offset into a raw input file\n" +
+	"        output: code_out.bin\n" +
+	"    registers: { sp: 0x20008000, r0: 1 }\n" +
+	"    breakpoints: [ 0x10214 ]\n" +
+	"    sync: msg:udp:127.0.0.1:1080\n" +
+	"    symbols: [ firmware.syms ]\n" +
+	"    patches: [ mods.patch ]\n" +
+	"    scripts: [ setup.cmds ]      # Run before any --script files\n" +
+	"    starlark: [ periph.star ]    # Run before any --starlark files\n" +
+	"\n" +
+	"  Regions specified via --mem replace file regions of the same name. Registers\n" +
+	"  specified via --reg take precedence, and breakpoints are combined.\n"
+
+const FlagStr_script = "" +
+	"  -x, --script <file>         Run the commands in <file> before execution.\n" +
+	"                               May be specified multiple times.\n"
+
+const FlagStr_starlark = "" +
+	"      --starlark <file>       Run a Starlark script at startup. In batch mode,\n" +
+	"                               no further execution occurs if the script\n" +
+	"                               executes code itself via step() or cont().\n"
+
+const Details_script = "" +
+	"\nCommand Scripts:\n" +
+	"  Scripts contain aemulari-cui commands (e.g., map, breakpoint, rw), one per\n" +
+	"  line. Lines beginning with a '#' are treated as comments and blank lines\n" +
+	"  are ignored. A script stops at the first command that fails, and the\n" +
+	"  failing file and line number are reported. Scripts may run other scripts\n" +
+	"  via the \"source <file>\" command.\n"
+
+const FlagStr_serve = "" +
+	"      --serve <address>       Serve JSON-RPC requests that control the\n" +
+	"                               debugger until a client sends Debugger.Quit.\n" +
+	"                               <address> may be [tcp:][host:]port,\n" +
+	"                               unix:<path>, or http:[host]:port.\n"
+
+const FlagStr_fuzz = "" +
+	"      --input <region>        Memory region into which each input is written.\n" +
+	"              <addr:size>      Its size is the maximum input length.\n" +
+	"      --len-reg <reg>         Register set to the length of each input.\n" +
+	"      --budget <count>        Maximum instructions executed per input, after\n" +
+	"                               which the input is considered a hang.\n" +
+	"                               (default: 100000)\n" +
+	"      --corpus <dir>          Directory of seed inputs. Inputs that reach new\n" +
+	"                               basic blocks are added to it.\n" +
+	"      --crashes <dir>         Directory to which crashing and hanging inputs\n" +
+	"                               are saved. (default: crashes)\n" +
+	"      --iterations <count>    Number of inputs to execute. (default: until\n" +
+	"                               interrupted via Ctrl-C)\n" +
+	"      --seed <value>          Random number generator seed.\n" +
+	"                               (default: current time)\n"
+
+const Details_fuzz = "" +
+	"\nFuzzing:\n" +
+	"  Each input is written to the --input region, after which execution starts\n" +
+	"  from the initial PC, or the --call function, with the state of registers\n" +
+	"  and writable memory restored from the time fuzzing began. The --call\n" +
+	"  arguments \"@input\" and \"@len\" are replaced by the input's address and\n" +
+	"  length. An exception or invalid memory access is considered a crash.\n" +
+	"\n" +
+	"  For each distinct crash (stop reason and PC), the crashes directory will\n" +
+	"  contain crash-<sha1>.bin, a description (.txt), and an instruction trace\n" +
+	"  (.trace). Hanging inputs are saved as hang-<sha1>.bin.\n"
+
 const FlagStr_help = "" +
 	"  -h, --help                  Show this text and exit.\n"
 
 const FlagStr_sync = "" +
-	"  -S, --sync                  Enable synchronization to external tools.\n" +
-	"                               (Currently sends PC addr to localhost:1080)\n"
+	"  -S, --sync [spec]           Enable synchronization to external tools.\n" +
+	"                               See \"External Tool Synchronization\" below.\n"
+
+const Details_sync = "" +
+	"\nExternal Tool Synchronization:\n" +
+	"  The destination and protocol used to synchronize with external tools is\n" +
+	"  specified using the following syntax:\n" +
+	"\n" +
+	"    [protocol:]<network>:<address>\n" +
+	"\n" +
+	"  - [protocol] may be one of the following. The default is \"addrsync\".\n" +
+	"      addrsync  Send the PC as 8 little-endian bytes, for use with AddressSync.\n" +
+	"      msg       Send PC, register, and breakpoint updates, and accept\n" +
+	"                  breakpoint and jump commands from the external tool.\n" +
+	"  - <network> may be one of: udp, tcp, unix, unixgram\n" +
+	"  - <address> is a host:port pair, or the path of a unix socket.\n" +
+	"  - If no [spec] is provided, addrsync:udp:127.0.0.1:1080 is used.\n"
 
 const Notes = "" +
 	"\nNotes:\n" +
@@ -35,6 +35,18 @@ func Parse(flags SupportedFlags, usage string) (ArgMap, *ae.Architecture, *ae.De
 		os.Exit(1)
 	}
 
+	// Values from a configuration file, if provided, are overridden by
+	// those specified on the command line
+	fileCfg := &Config{}
+	if args.Contains("config") {
+		fileCfg, err = LoadConfig(args.GetString("config", ""))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	args.remove("config")
+
 	// Aggregate and convert breakpoints to uint64 addresses
 	breakpoints, err := args.GetU64List("break")
 	if err != nil {
@@ -43,8 +55,12 @@ func Parse(flags SupportedFlags, usage string) (ArgMap, *ae.Architecture, *ae.De
 	}
 	args.remove("break")
 
+	for _, b := range fileCfg.Breakpoints {
+		breakpoints = append(breakpoints, uint64(b))
+	}
+
 	// Aggregate memory regions
-	dbgCfg.Mem, err = ae.NewMemRegionSet(args.GetStrings("mem"))
+	dbgCfg.Mem, err = mergeMemRegions(fileCfg, args.GetStrings("mem"))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -52,7 +68,12 @@ func Parse(flags SupportedFlags, usage string) (ArgMap, *ae.Architecture, *ae.De
 	args.remove("mem")
 
 	// Determine which architecture we're emulating
-	arch, err := ae.NewArchitecture(args.GetString("arch", "arm"))
+	defaultArch := "arm"
+	if fileCfg.Arch != "" {
+		defaultArch = fileCfg.Arch
+	}
+
+	arch, err := ae.NewArchitecture(args.GetString("arch", defaultArch))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -60,14 +81,39 @@ func Parse(flags SupportedFlags, usage string) (ArgMap, *ae.Architecture, *ae.De
 	args.remove("arch")
 
 	// Parse user-provided initial register values for the configured architecture
-	dbgCfg.Regs, err = arch.ParseRegisters(args.GetStrings("reg"))
+	dbgCfg.Regs, err = mergeRegisters(arch, fileCfg, args.GetStrings("reg"))
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 	args.remove("reg")
 
-	dbgCfg.EnToolSync = args.Contains("sync")
+	syncSpec := fileCfg.Sync
+	if args.Contains("sync") {
+		syncSpec = args.GetString("sync", "")
+	}
+
+	dbgCfg.EnToolSync = args.Contains("sync") || fileCfg.Sync != ""
+	dbgCfg.ToolSync, err = ae.ParseToolSyncConfig(syncSpec)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	args.remove("sync")
+
+	// Patch files from the configuration file are applied first
+	dbgCfg.PatchFiles = append(fileCfg.Patches, args.GetStrings("patch")...)
+	args.remove("patch")
+
+	// Scripts from the configuration file run before those specified
+	// on the command line
+	if len(fileCfg.Scripts) > 0 {
+		args["script"] = append(fileCfg.Scripts, args.GetStrings("script")...)
+	}
+
+	if len(fileCfg.Starlark) > 0 {
+		args["starlark"] = append(fileCfg.Starlark, args.GetStrings("starlark")...)
+	}
 
 	// Create the debugger and set any initial breakpoints
 	dbg, err := ae.NewDebugger(arch, dbgCfg)
@@ -80,5 +126,71 @@ func Parse(flags SupportedFlags, usage string) (ArgMap, *ae.Architecture, *ae.De
 		dbg.SetBreakpoint(b)
 	}
 
+	// Symbol files from the configuration file are loaded first
+	for _, filename := range append(fileCfg.Symbols, args.GetStrings("symbols")...) {
+		if err = dbg.LoadSymbols(filename); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			dbg.Close()
+			os.Exit(1)
+		}
+	}
+	args.remove("symbols")
+
 	return args, &arch, dbg
 }
+
+// Combine memory regions from a configuration file with those specified
+// on the command line. The latter replace file regions of the same name.
+func mergeMemRegions(fileCfg *Config, specs []string) (ae.MemRegionSet, error) {
+	regions, err := ae.NewMemRegionSet(specs)
+	if err != nil {
+		return regions, err
+	}
+
+	for _, rc := range fileCfg.Regions {
+		if regions.Contains(rc.Name) {
+			continue
+		}
+
+		r, err := rc.MemRegion()
+		if err != nil {
+			return regions, err
+		}
+
+		if err = regions.Add(r); err != nil {
+			return regions, err
+		}
+	}
+
+	return regions, nil
+}
+
+// Combine initial register values from a configuration file with those
+// specified on the command line. The latter take precedence.
+func mergeRegisters(arch ae.Architecture, fileCfg *Config, specs []string) ([]ae.Register, error) {
+	fromFile, err := arch.ParseRegisters(fileCfg.registerStrings())
+	if err != nil {
+		return nil, err
+	}
+
+	regs, err := arch.ParseRegisters(specs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range fromFile {
+		overridden := false
+		for _, o := range regs {
+			if o.Name() == r.Name() {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			regs = append(regs, r)
+		}
+	}
+
+	return regs, nil
+}
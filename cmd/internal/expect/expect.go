@@ -0,0 +1,253 @@
+// Package expect checks the final state of a Debugger against expected
+// register values, memory contents, and stop conditions, allowing small
+// routines to be run as unit tests.
+package expect
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	ae "../../../aemulari.v0"
+)
+
+type regExpectation struct {
+	name  string
+	value uint64
+}
+
+type memExpectation struct {
+	addr uint64
+	data []byte
+}
+
+type stopExpectation struct {
+	reason string // StopReason name
+	detail string // Exception kind or breakpoint address, if specified
+}
+
+// A set of expectations describing the state of the Debugger after execution
+type Set struct {
+	regs []regExpectation
+	mem  []memExpectation
+	stop *stopExpectation
+}
+
+// Describes an expectation that was not met
+type Failure struct {
+	Item     string `json:"item"` // Register name, memory address, or "stop"
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Marker   string `json:"-"` // Optional line indicating where Actual differs
+}
+
+// Returns true if no expectations have been added
+func (s *Set) Empty() bool {
+	return len(s.regs) == 0 && len(s.mem) == 0 && s.stop == nil
+}
+
+// Add an expected register value, specified as <name>=<value>
+func (s *Set) AddRegister(spec string, dbg *ae.Debugger) error {
+	fields := strings.SplitN(spec, "=", 2)
+	if len(fields) != 2 {
+		return fmt.Errorf("Invalid register expectation (expected <name>=<value>): %s", spec)
+	}
+
+	name := strings.TrimSpace(fields[0])
+	if _, err := dbg.ReadRegByName(name); err != nil {
+		return err
+	}
+
+	value, err := strconv.ParseUint(strings.TrimSpace(fields[1]), 0, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid expected value for %s: %s", name, fields[1])
+	}
+
+	s.regs = append(s.regs, regExpectation{name, value})
+	return nil
+}
+
+// Add expected memory contents, specified as <addr>=<hex bytes>
+func (s *Set) AddMemory(spec string) error {
+	fields := strings.SplitN(spec, "=", 2)
+	if len(fields) != 2 {
+		return fmt.Errorf("Invalid memory expectation (expected <addr>=<hex bytes>): %s", spec)
+	}
+
+	addr, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 0, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid memory expectation address: %s", fields[0])
+	}
+
+	hexStr := strings.TrimPrefix(strings.Replace(fields[1], " ", "", -1), "0x")
+	data, err := hex.DecodeString(hexStr)
+	if err != nil || len(data) == 0 {
+		return fmt.Errorf("Invalid expected memory contents: %s", fields[1])
+	}
+
+	s.mem = append(s.mem, memExpectation{addr, data})
+	return nil
+}
+
+// Set the expected stop condition, specified as <reason>[:<detail>]. The
+// detail may be an exception kind (e.g., exception:bkpt) or a breakpoint
+// address (e.g., breakpoint:0x10214).
+func (s *Set) SetStop(spec string) error {
+	fields := strings.SplitN(spec, ":", 2)
+	stop := &stopExpectation{reason: fields[0]}
+
+	valid := false
+	for r := ae.StopNone; r <= ae.StopError; r++ {
+		if r.String() == stop.reason {
+			valid = true
+			break
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("Invalid stop reason: %s", fields[0])
+	}
+
+	if len(fields) == 2 {
+		switch stop.reason {
+		case ae.StopException.String():
+			stop.detail = fields[1]
+		case ae.StopBreakpoint.String():
+			addr, err := strconv.ParseUint(fields[1], 0, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid breakpoint address: %s", fields[1])
+			}
+			stop.detail = fmt.Sprintf("0x%x", addr)
+		default:
+			return fmt.Errorf("The \"%s\" stop reason does not accept a qualifier.", stop.reason)
+		}
+	}
+
+	s.stop = stop
+	return nil
+}
+
+// Check the state of the Debugger against all expectations, following
+// execution that resulted in `exception`. Returns the expectations that
+// were not met.
+func (s *Set) Check(dbg *ae.Debugger, exception ae.Exception) ([]Failure, error) {
+	var failures []Failure
+
+	if s.stop != nil {
+		f, err := s.stop.check(dbg, exception)
+		if err != nil {
+			return failures, err
+		} else if f != nil {
+			failures = append(failures, *f)
+		}
+	}
+
+	for _, e := range s.regs {
+		reg, err := dbg.ReadRegByName(e.name)
+		if err != nil {
+			return failures, err
+		}
+
+		if reg.Value != e.value {
+			digits := int(reg.Size()+3) / 4
+			failures = append(failures, Failure{
+				Item:     e.name,
+				Expected: fmt.Sprintf("0x%0*x", digits, e.value),
+				Actual:   fmt.Sprintf("0x%0*x", digits, reg.Value),
+			})
+		}
+	}
+
+	for _, e := range s.mem {
+		if f := e.check(dbg); f != nil {
+			failures = append(failures, *f)
+		}
+	}
+
+	return failures, nil
+}
+
+func (e *stopExpectation) check(dbg *ae.Debugger, exception ae.Exception) (*Failure, error) {
+	reason := dbg.StopReason()
+	actual := reason.String()
+
+	if e.detail != "" {
+		switch reason {
+		case ae.StopException:
+			actual += ":" + exception.Kind()
+		case ae.StopBreakpoint:
+			pc, err := dbg.ReadRegByName("pc")
+			if err != nil {
+				return nil, err
+			}
+			actual += fmt.Sprintf(":0x%x", pc.Value)
+		}
+	}
+
+	expected := e.reason
+	if e.detail != "" {
+		expected += ":" + e.detail
+	}
+
+	if actual == expected {
+		return nil, nil
+	}
+
+	if reason == ae.StopException && e.detail == "" {
+		actual += " (" + exception.String() + ")"
+	}
+
+	return &Failure{Item: "stop", Expected: expected, Actual: actual}, nil
+}
+
+func (e *memExpectation) check(dbg *ae.Debugger) *Failure {
+	item := fmt.Sprintf("memory at 0x%08x", e.addr)
+	expected := hexBytes(e.data)
+
+	data, err := dbg.ReadMem(e.addr, uint64(len(e.data)))
+	if err != nil {
+		return &Failure{Item: item, Expected: expected, Actual: "<" + err.Error() + ">"}
+	}
+
+	var marker []string
+	mismatch := false
+	for i := range data {
+		if data[i] != e.data[i] {
+			marker = append(marker, "^^")
+			mismatch = true
+		} else {
+			marker = append(marker, "  ")
+		}
+	}
+
+	if !mismatch {
+		return nil
+	}
+
+	return &Failure{
+		Item:     item,
+		Expected: expected,
+		Actual:   hexBytes(data),
+		Marker:   strings.TrimRight(strings.Join(marker, " "), " "),
+	}
+}
+
+// Format bytes as space-separated hex pairs
+func hexBytes(data []byte) string {
+	var pairs []string
+	for _, b := range data {
+		pairs = append(pairs, fmt.Sprintf("%02x", b))
+	}
+	return strings.Join(pairs, " ")
+}
+
+// Return a string describing each failure, showing expected and actual
+// values on consecutive lines so that differences are easy to spot.
+func (f Failure) String() string {
+	s := fmt.Sprintf("  %s\n    expected: %s\n    actual:   %s\n", f.Item, f.Expected, f.Actual)
+	if f.Marker != "" {
+		s += "              " + f.Marker + "\n"
+	}
+	return s
+}
@@ -0,0 +1,673 @@
+// Package gdbstub exposes a Debugger via the GDB Remote Serial Protocol,
+// allowing it to be driven by gdb-multiarch, IDA, Ghidra, or any other
+// debugger client that speaks the protocol.
+//
+// See: https://sourceware.org/gdb/onlinedocs/gdb/Remote-Protocol.html
+package gdbstub
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	ae "../../../aemulari.v0"
+)
+
+const (
+	sigint  = 2
+	sigtrap = 5
+	sigsegv = 11
+)
+
+// Maximum packet size we advertise to the client
+const maxPacketSize = 0x4000
+
+// Target description attributes for each supported architecture
+type targetInfo struct {
+	arch    string // <architecture> value
+	feature string // Name of the core register feature
+}
+
+var targets = map[string]targetInfo{
+	"arm": {"arm", "org.gnu.gdb.arm.core"},
+}
+
+// A Stub services requests from a single GDB client connection
+type Stub struct {
+	dbg  *ae.Debugger
+	arch ae.Architecture
+	conn net.Conn
+	log  io.Writer
+
+	packets     chan string // Packets received from the client
+	running     int32       // Non-zero while the target is executing
+	interrupted int32       // Set when the client requests a break
+
+	lastStop  string // Most recent stop reply
+	targetXML string // Target description
+}
+
+// Listen for a single GDB client connection on `addr` and service its
+// requests until it detaches or kills the target. If `addr` contains only a
+// port number, the stub will listen on the loopback interface.
+// Status messages are written to `log`.
+func Serve(addr string, arch ae.Architecture, dbg *ae.Debugger, log io.Writer) error {
+	if _, err := strconv.ParseUint(addr, 10, 16); err == nil {
+		addr = "localhost:" + addr
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(log, "Waiting for GDB connection on %s\n", listener.Addr())
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(log, "Accepted GDB connection from %s\n", conn.RemoteAddr())
+
+	stub, err := newStub(conn, arch, dbg, log)
+	if err != nil {
+		return err
+	}
+
+	return stub.run()
+}
+
+func newStub(conn net.Conn, arch ae.Architecture, dbg *ae.Debugger, log io.Writer) (*Stub, error) {
+	s := &Stub{
+		dbg:      dbg,
+		arch:     arch,
+		conn:     conn,
+		log:      log,
+		packets:  make(chan string),
+		lastStop: fmt.Sprintf("S%02x", sigtrap),
+	}
+
+	xml, err := s.buildTargetXML()
+	if err != nil {
+		return nil, err
+	}
+	s.targetXML = xml
+
+	return s, nil
+}
+
+// Service packets until the client goes away, detaches, or kills the target
+func (s *Stub) run() error {
+	go s.receive()
+
+	for pkt := range s.packets {
+		reply, done := s.handle(pkt)
+		if done && reply == "" {
+			return nil
+		}
+
+		if err := s.send(reply); err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+
+	fmt.Fprintln(s.log, "GDB client disconnected.")
+	return nil
+}
+
+// Read packets from the client and forward them to run() for handling.
+// Interrupt requests are handled immediately, as run() will be blocked
+// while the target executes.
+func (s *Stub) receive() {
+	defer close(s.packets)
+
+	r := bufio.NewReader(s.conn)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+
+		switch c {
+		case 0x03:
+			if atomic.LoadInt32(&s.running) != 0 {
+				atomic.StoreInt32(&s.interrupted, 1)
+				s.dbg.Interrupt()
+			}
+
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+
+			sum := make([]byte, 2)
+			if _, err = io.ReadFull(r, sum); err != nil {
+				return
+			}
+
+			payload := data[:len(data)-1]
+			expected, err := strconv.ParseUint(string(sum), 16, 8)
+			if err != nil || uint8(expected) != checksum(payload) {
+				s.conn.Write([]byte("-"))
+				continue
+			}
+
+			s.conn.Write([]byte("+"))
+			s.packets <- payload
+
+		default:
+			// Acknowledgements ('+' and '-') of our own packets are ignored;
+			// we're running over a reliable transport.
+		}
+	}
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// Escape characters that may not appear within a packet's payload
+func escape(data string) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '#', '$', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Reverse the escaping applied to binary data (e.g., in an X packet)
+func unescape(data string) []byte {
+	var ret []byte
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			ret = append(ret, data[i]^0x20)
+		} else {
+			ret = append(ret, data[i])
+		}
+	}
+	return ret
+}
+
+func (s *Stub) send(payload string) error {
+	pkt := fmt.Sprintf("$%s#%02x", payload, checksum(payload))
+	_, err := s.conn.Write([]byte(pkt))
+	return err
+}
+
+// Handle a single packet, returning the reply and whether the session is done
+func (s *Stub) handle(pkt string) (string, bool) {
+	if len(pkt) == 0 {
+		return "", false
+	}
+
+	switch {
+	case pkt == "?":
+		return s.lastStop, false
+	case pkt[0] == 'g':
+		return s.readRegisters(), false
+	case pkt[0] == 'G':
+		return s.writeRegisters(pkt[1:]), false
+	case pkt[0] == 'p':
+		return s.readRegister(pkt[1:]), false
+	case pkt[0] == 'P':
+		return s.writeRegister(pkt[1:]), false
+	case pkt[0] == 'm':
+		return s.readMemory(pkt[1:]), false
+	case pkt[0] == 'M':
+		return s.writeMemory(pkt[1:], false), false
+	case pkt[0] == 'X':
+		return s.writeMemory(pkt[1:], true), false
+	case pkt[0] == 'Z' || pkt[0] == 'z':
+		return s.breakpoint(pkt), false
+	case pkt[0] == 'c':
+		return s.resume(pkt[1:], false), false
+	case pkt[0] == 's':
+		return s.resume(pkt[1:], true), false
+	case pkt == "vCont?":
+		return "vCont;c;C;s;S", false
+	case strings.HasPrefix(pkt, "vCont;"):
+		return s.vCont(pkt[len("vCont;"):]), false
+	case strings.HasPrefix(pkt, "qSupported"):
+		return fmt.Sprintf("PacketSize=%x;qXfer:features:read+;vContSupported+",
+			maxPacketSize), false
+	case strings.HasPrefix(pkt, "qXfer:features:read:"):
+		return s.readFeatures(pkt[len("qXfer:features:read:"):]), false
+	case pkt == "qAttached":
+		return "1", false
+	case pkt == "qC":
+		return "QC1", false
+	case pkt == "qfThreadInfo":
+		return "m1", false
+	case pkt == "qsThreadInfo":
+		return "l", false
+	case pkt[0] == 'H' || pkt[0] == 'T':
+		// There's only ever a single thread
+		return "OK", false
+	case pkt[0] == 'D':
+		fmt.Fprintln(s.log, "GDB client detached.")
+		return "OK", true
+	case pkt[0] == 'k':
+		fmt.Fprintln(s.log, "GDB client killed the target.")
+		return "", true
+	}
+
+	// An empty response indicates an unsupported packet
+	return "", false
+}
+
+func (s *Stub) endianness() ae.Endianness {
+	e, err := s.dbg.Endianness()
+	if err != nil {
+		return ae.LittleEndian
+	}
+	return e
+}
+
+// Encode a register value as hex, in target byte order
+func (s *Stub) encodeRegister(r ae.Register) string {
+	buf := make([]byte, 8)
+	if s.endianness() == ae.BigEndian {
+		binary.BigEndian.PutUint64(buf, r.Value)
+		buf = buf[8-r.Size()/8:]
+	} else {
+		binary.LittleEndian.PutUint64(buf, r.Value)
+		buf = buf[:r.Size()/8]
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Decode a register value in target byte order
+func (s *Stub) decodeRegister(r *ae.Register, data []byte) error {
+	value, err := decodeValue(data, r.Size()/8, s.endianness())
+	if err != nil {
+		return err
+	}
+	r.Value = value
+	return nil
+}
+
+// Decode a `size`-byte value, which `data` must contain exactly
+func decodeValue(data []byte, size uint, order ae.Endianness) (uint64, error) {
+	if uint(len(data)) != size || size > 8 {
+		return 0, fmt.Errorf("Expected a %d-byte register value, got %d bytes.", size, len(data))
+	}
+
+	buf := make([]byte, 8)
+	if order == ae.BigEndian {
+		copy(buf[8-size:], data)
+		return binary.BigEndian.Uint64(buf), nil
+	}
+
+	copy(buf, data)
+	return binary.LittleEndian.Uint64(buf), nil
+}
+
+func (s *Stub) readRegisters() string {
+	regs, err := s.dbg.ReadRegAll()
+	if err != nil {
+		return "E01"
+	}
+
+	var ret string
+	for _, r := range regs {
+		ret += s.encodeRegister(r)
+	}
+	return ret
+}
+
+func (s *Stub) writeRegisters(data string) string {
+	regs, err := s.dbg.ReadRegAll()
+	if err != nil {
+		return "E01"
+	}
+
+	raw, err := hex.DecodeString(data)
+	if err != nil {
+		return "E01"
+	}
+
+	// Values must be supplied for all registers, as returned by readRegisters()
+	var total int
+	for _, r := range regs {
+		total += int(r.Size() / 8)
+	}
+
+	if len(raw) != total {
+		return "E01"
+	}
+
+	for _, r := range regs {
+		size := int(r.Size() / 8)
+		if err := s.decodeRegister(&r, raw[:size]); err != nil {
+			return "E01"
+		}
+		raw = raw[size:]
+
+		if err := s.dbg.WriteReg(r); err != nil {
+			return "E01"
+		}
+	}
+
+	return "OK"
+}
+
+// Look up a register by its index (in hex) in the target description
+func (s *Stub) registerAt(index string) (ae.Register, error) {
+	var reg ae.Register
+
+	n, err := strconv.ParseUint(index, 16, 32)
+	if err != nil {
+		return reg, err
+	}
+
+	regs, err := s.dbg.ReadRegAll()
+	if err != nil {
+		return reg, err
+	}
+
+	if n >= uint64(len(regs)) {
+		return reg, fmt.Errorf("Invalid register number: %d", n)
+	}
+
+	return regs[n], nil
+}
+
+func (s *Stub) readRegister(index string) string {
+	r, err := s.registerAt(index)
+	if err != nil {
+		return "E01"
+	}
+	return s.encodeRegister(r)
+}
+
+func (s *Stub) writeRegister(args string) string {
+	fields := strings.SplitN(args, "=", 2)
+	if len(fields) != 2 {
+		return "E01"
+	}
+
+	r, err := s.registerAt(fields[0])
+	if err != nil {
+		return "E01"
+	}
+
+	data, err := hex.DecodeString(fields[1])
+	if err != nil {
+		return "E01"
+	}
+
+	if err = s.decodeRegister(&r, data); err != nil {
+		return "E01"
+	}
+
+	if err = s.dbg.WriteReg(r); err != nil {
+		return "E01"
+	}
+
+	return "OK"
+}
+
+// Parse an "addr,length" pair
+func parseAddrLen(s string) (uint64, uint64, error) {
+	fields := strings.SplitN(s, ",", 2)
+	if len(fields) != 2 {
+		return 0, 0, errors.New("Expected addr,length")
+	}
+
+	addr, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length, err := strconv.ParseUint(fields[1], 16, 64)
+	return addr, length, err
+}
+
+func (s *Stub) readMemory(args string) string {
+	addr, length, err := parseAddrLen(args)
+	if err != nil {
+		return "E01"
+	}
+
+	if length > maxPacketSize/2 {
+		length = maxPacketSize / 2
+	}
+
+	data, err := s.dbg.ReadMem(addr, length)
+	if err != nil {
+		return "E0e" // EFAULT
+	}
+
+	return hex.EncodeToString(data)
+}
+
+// Handle M (hex data) and X (binary data) packets
+func (s *Stub) writeMemory(args string, binaryData bool) string {
+	var data []byte
+	var err error
+
+	fields := strings.SplitN(args, ":", 2)
+	if len(fields) != 2 {
+		return "E01"
+	}
+
+	addr, length, err := parseAddrLen(fields[0])
+	if err != nil {
+		return "E01"
+	}
+
+	if binaryData {
+		data = unescape(fields[1])
+	} else if data, err = hex.DecodeString(fields[1]); err != nil {
+		return "E01"
+	}
+
+	if uint64(len(data)) != length {
+		return "E01"
+	}
+
+	if length != 0 {
+		if err = s.dbg.WriteMem(addr, data); err != nil {
+			return "E0e" // EFAULT
+		}
+	}
+
+	return "OK"
+}
+
+// Handle Z/z packets: Z<type>,<addr>,<kind>
+func (s *Stub) breakpoint(pkt string) string {
+	fields := strings.Split(pkt[1:], ",")
+	if len(fields) < 2 {
+		return "E01"
+	}
+
+	// Only software and hardware breakpoints are supported.
+	// Watchpoints (types 2, 3, and 4) are reported as unsupported.
+	if fields[0] != "0" && fields[0] != "1" {
+		return ""
+	}
+
+	addr, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return "E01"
+	}
+
+	if pkt[0] == 'Z' {
+		if len(s.dbg.GetBreakpointsAt(addr)) == 0 {
+			s.dbg.SetBreakpoint(addr)
+		}
+	} else {
+		s.dbg.DeleteBreakpointsAt(addr)
+	}
+
+	return "OK"
+}
+
+// Handle a vCont request. Only the first action is honored, as there's
+// only a single thread.
+func (s *Stub) vCont(actions string) string {
+	action := strings.Split(actions, ";")[0]
+	action = strings.SplitN(action, ":", 2)[0]
+
+	switch {
+	case strings.HasPrefix(action, "c"), strings.HasPrefix(action, "C"):
+		return s.resume("", false)
+	case strings.HasPrefix(action, "s"), strings.HasPrefix(action, "S"):
+		return s.resume("", true)
+	}
+
+	return "E01"
+}
+
+// Continue or step execution, optionally from the specified address
+func (s *Stub) resume(addrStr string, step bool) string {
+	var ex ae.Exception
+	var err error
+
+	if addrStr != "" {
+		addr, err := strconv.ParseUint(addrStr, 16, 64)
+		if err != nil {
+			return "E01"
+		}
+
+		if err = s.dbg.WriteRegByName("pc", addr); err != nil {
+			return "E01"
+		}
+	}
+
+	atomic.StoreInt32(&s.interrupted, 0)
+	atomic.StoreInt32(&s.running, 1)
+
+	if step {
+		ex, err = s.dbg.Step(1)
+	} else {
+		ex, err = s.dbg.Continue()
+	}
+
+	atomic.StoreInt32(&s.running, 0)
+
+	s.lastStop = s.stopReply(ex, err, step)
+	return s.lastStop
+}
+
+func (s *Stub) stopReply(ex ae.Exception, err error, step bool) string {
+	if s.dbg.StopReason() == ae.StopMemoryFault {
+		fault, _ := s.dbg.MemoryFault()
+		fmt.Fprintln(s.log, "Halted due to invalid memory access: "+fault.String())
+		return fmt.Sprintf("S%02x", sigsegv)
+	}
+
+	if err != nil {
+		fmt.Fprintln(s.log, "Execution error: "+err.Error())
+		return fmt.Sprintf("S%02x", sigtrap)
+	}
+
+	if atomic.LoadInt32(&s.interrupted) != 0 {
+		return fmt.Sprintf("S%02x", sigint)
+	}
+
+	if ex.Occurred() {
+		fmt.Fprintln(s.log, "Halted due to exception: "+ex.String())
+		return fmt.Sprintf("S%02x", ex.Signal())
+	}
+
+	// Execution halts at the end of the code region if it doesn't hit
+	// a breakpoint first. There's nothing further to run.
+	if !step && s.dbg.StopReason() == ae.StopEndOfCode {
+		fmt.Fprintln(s.log, "Execution reached the end of the code region.")
+		return "W00"
+	}
+
+	return fmt.Sprintf("S%02x", sigtrap)
+}
+
+// Handle qXfer:features:read:<annex>:<offset>,<length>
+func (s *Stub) readFeatures(args string) string {
+	fields := strings.SplitN(args, ":", 2)
+	if len(fields) != 2 {
+		return "E01"
+	}
+
+	if fields[0] != "target.xml" {
+		return "E00"
+	}
+
+	offset, length, err := parseAddrLen(fields[1])
+	if err != nil {
+		return "E01"
+	}
+
+	if offset >= uint64(len(s.targetXML)) {
+		return "l"
+	}
+
+	end := offset + length
+	if end >= uint64(len(s.targetXML)) {
+		return "l" + escape(s.targetXML[offset:])
+	}
+
+	return "m" + escape(s.targetXML[offset:end])
+}
+
+// Generate a target description from the architecture's register definitions
+func (s *Stub) buildTargetXML() (string, error) {
+	info, found := targets[s.arch.Name()]
+	if !found {
+		return "", fmt.Errorf("The GDB stub does not support the %s architecture.", s.arch.Name())
+	}
+
+	regs, err := s.dbg.ReadRegAll()
+	if err != nil {
+		return "", err
+	}
+
+	xml := "<?xml version=\"1.0\"?>\n" +
+		"<!DOCTYPE target SYSTEM \"gdb-target.dtd\">\n" +
+		"<target version=\"1.0\">\n" +
+		"  <architecture>" + info.arch + "</architecture>\n" +
+		"  <feature name=\"" + info.feature + "\">\n"
+
+	for i, r := range regs {
+		regType := "uint" + strconv.Itoa(int(r.Size()))
+		switch r.Name() {
+		case "pc":
+			regType = "code_ptr"
+		case "sp":
+			regType = "data_ptr"
+		}
+
+		xml += fmt.Sprintf("    <reg name=\"%s\" bitsize=\"%d\" regnum=\"%d\" type=\"%s\"/>\n",
+			r.Name(), r.Size(), i, regType)
+	}
+
+	xml += "  </feature>\n" +
+		"</target>\n"
+
+	return xml, nil
+}
@@ -0,0 +1,120 @@
+package gdbstub
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"testing"
+
+	ae "../../../aemulari.v0"
+)
+
+func TestReceive(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	s := &Stub{conn: server, packets: make(chan string)}
+	go s.receive()
+
+	tests := []struct {
+		packet  string
+		ack     byte
+		payload string
+	}{
+		{fmt.Sprintf("$m10000,4#%02x", checksum("m10000,4")), '+', "m10000,4"},
+		{"$m10000,4#00", '-', ""},
+		{"$g#zz", '-', ""},
+
+		// Acknowledgements of our own packets are ignored
+		{fmt.Sprintf("+$?#%02x", checksum("?")), '+', "?"},
+	}
+
+	ack := make([]byte, 1)
+	for _, test := range tests {
+		if _, err := client.Write([]byte(test.packet)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.Read(ack); err != nil {
+			t.Fatal(err)
+		} else if ack[0] != test.ack {
+			t.Errorf("%s: got \"%c\", expected \"%c\"", test.packet, ack[0], test.ack)
+		}
+
+		if test.ack == '+' {
+			if payload := <-s.packets; payload != test.payload {
+				t.Errorf("%s: got payload \"%s\", expected \"%s\"", test.packet, payload, test.payload)
+			}
+		}
+	}
+
+	// The packet channel is closed when the client goes away
+	server.Close()
+	if _, ok := <-s.packets; ok {
+		t.Error("Packet channel remains open after the connection closed")
+	}
+}
+
+func TestParseAddrLen(t *testing.T) {
+	tests := []struct {
+		args   string
+		addr   uint64
+		length uint64
+		valid  bool
+	}{
+		{"10000,4", 0x10000, 4, true},
+		{"ffffffff,100", 0xffffffff, 0x100, true},
+		{"10000", 0, 0, false},
+		{"10000,", 0, 0, false},
+		{"xyz,4", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		addr, length, err := parseAddrLen(test.args)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error status: %v", test.args, err)
+		} else if test.valid && (addr != test.addr || length != test.length) {
+			t.Errorf("%s: got 0x%x,0x%x", test.args, addr, length)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	data := "a#b$c}d*e"
+	escaped := escape(data)
+	if escaped != "a}\x03b}\x04c}]d}\x0ae" {
+		t.Errorf("Unexpected escaping: %q", escaped)
+	}
+
+	if unescaped := unescape(escaped); !bytes.Equal(unescaped, []byte(data)) {
+		t.Errorf("Round trip yielded %q", unescaped)
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		data  []byte
+		size  uint
+		order ae.Endianness
+		value uint64
+		valid bool
+	}{
+		{[]byte{0x78, 0x56, 0x34, 0x12}, 4, ae.LittleEndian, 0x12345678, true},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, 4, ae.BigEndian, 0x12345678, true},
+
+		// Wrong-length values are rejected, rather than truncated or padded
+		{[]byte{0x78, 0x56}, 4, ae.LittleEndian, 0, false},
+		{[]byte{0x78, 0x56, 0x34, 0x12, 0x00}, 4, ae.LittleEndian, 0, false},
+		{make([]byte, 9), 4, ae.BigEndian, 0, false},
+		{make([]byte, 16), 16, ae.BigEndian, 0, false},
+	}
+
+	for _, test := range tests {
+		value, err := decodeValue(test.data, test.size, test.order)
+		if (err == nil) != test.valid {
+			t.Errorf("%x: unexpected error status: %v", test.data, err)
+		} else if value != test.value {
+			t.Errorf("%x: got 0x%x, expected 0x%x", test.data, value, test.value)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+// Package scripting embeds a Starlark interpreter with bindings to the
+// Debugger API, allowing users to implement breakpoint callbacks, emulate
+// peripherals, and drive execution without recompiling aemulari.
+package scripting
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	ae "../../../aemulari.v0"
+)
+
+// Summary of available built-ins, suitable for inclusion in help text
+const Builtins = "" +
+	"  read_reg(name)                      Return the value of a register\n" +
+	"  write_reg(name, value)              Write a value to a register\n" +
+	"  regs()                              Return a dict of all register values\n" +
+	"  read_mem(addr, size)                Return memory contents as bytes\n" +
+	"  write_mem(addr, data)               Write bytes to memory\n" +
+	"  read_u8/u16/u32/u64(addr)           Read a target-endian integer\n" +
+	"  write_u8/u16/u32/u64(addr, value)   Write a target-endian integer\n" +
+	"  step(count=1)                       Execute instructions\n" +
+	"  cont()                              Continue execution\n" +
+	"  set_breakpoint(addr, callback=None) Set a breakpoint; returns its ID\n" +
+	"  delete_breakpoint(id)               Delete a breakpoint\n" +
+	"  hook_mem(addr, size, callback,      Invoke callback(access) upon reads\n" +
+	"           access=\"rw\")               and/or writes; returns a hook ID\n" +
+	"  unhook_mem(id)                      Remove a memory hook\n" +
+	"\n" +
+	"  step() and cont() return a description of the exception that halted\n" +
+	"  execution, or None. Breakpoint callbacks receive the breakpoint ID and\n" +
+	"  must return True to halt execution. Memory hook callbacks receive a\n" +
+	"  struct with type (\"read\" or \"write\"), address, size, and value fields.\n" +
+	"  A read hook may write to the accessed address to supply the value read.\n"
+
+// Starlark interpreter bound to a Debugger. Globals defined by one script
+// remain available to those that are run later.
+type Interpreter struct {
+	dbg     *ae.Debugger
+	thread  *starlark.Thread
+	globals starlark.StringDict
+
+	inCallback bool  // A callback is running in the context of a hook
+	cbErr      error // First error raised by a callback
+	executed   bool  // A script has run code via step() or cont()
+}
+
+// Create an Interpreter that operates upon `dbg`.
+// Output from the print() built-in is written to `out`.
+func New(dbg *ae.Debugger, out io.Writer) *Interpreter {
+	i := &Interpreter{dbg: dbg}
+
+	i.thread = &starlark.Thread{
+		Name: "aemulari",
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(out, msg)
+		},
+	}
+
+	i.globals = starlark.StringDict{
+		"read_reg":          starlark.NewBuiltin("read_reg", i.readReg),
+		"write_reg":         starlark.NewBuiltin("write_reg", i.writeReg),
+		"regs":              starlark.NewBuiltin("regs", i.regs),
+		"read_mem":          starlark.NewBuiltin("read_mem", i.readMem),
+		"write_mem":         starlark.NewBuiltin("write_mem", i.writeMem),
+		"read_u8":           starlark.NewBuiltin("read_u8", i.readInt(1)),
+		"read_u16":          starlark.NewBuiltin("read_u16", i.readInt(2)),
+		"read_u32":          starlark.NewBuiltin("read_u32", i.readInt(4)),
+		"read_u64":          starlark.NewBuiltin("read_u64", i.readInt(8)),
+		"write_u8":          starlark.NewBuiltin("write_u8", i.writeInt(1)),
+		"write_u16":         starlark.NewBuiltin("write_u16", i.writeInt(2)),
+		"write_u32":         starlark.NewBuiltin("write_u32", i.writeInt(4)),
+		"write_u64":         starlark.NewBuiltin("write_u64", i.writeInt(8)),
+		"step":              starlark.NewBuiltin("step", i.step),
+		"cont":              starlark.NewBuiltin("cont", i.cont),
+		"set_breakpoint":    starlark.NewBuiltin("set_breakpoint", i.setBreakpoint),
+		"delete_breakpoint": starlark.NewBuiltin("delete_breakpoint", i.deleteBreakpoint),
+		"hook_mem":          starlark.NewBuiltin("hook_mem", i.hookMem),
+		"unhook_mem":        starlark.NewBuiltin("unhook_mem", i.unhookMem),
+	}
+
+	return i
+}
+
+// Execute the Starlark script in the specified file
+func (i *Interpreter) RunFile(filename string) error {
+	return i.exec(filename, nil)
+}
+
+// Execute Starlark source code. `name` is used when reporting errors.
+func (i *Interpreter) Run(name, src string) error {
+	return i.exec(name, src)
+}
+
+func (i *Interpreter) exec(filename string, src interface{}) error {
+	globals, err := starlark.ExecFile(i.thread, filename, src, i.globals)
+
+	for name, value := range globals {
+		i.globals[name] = value
+	}
+
+	if cbErr := i.CallbackError(); err == nil {
+		err = cbErr
+	}
+
+	if evalErr, ok := err.(*starlark.EvalError); ok {
+		return errors.New(evalErr.Backtrace())
+	}
+
+	return err
+}
+
+// Returns and clears the first error raised by a callback since the last
+// call to this method. Callbacks run during execution, so errors cannot be
+// reported until the Debugger returns control to its caller.
+func (i *Interpreter) CallbackError() error {
+	err := i.cbErr
+	i.cbErr = nil
+	return err
+}
+
+// Returns true if any script has executed code via step() or cont()
+func (i *Interpreter) Executed() bool {
+	return i.executed
+}
+
+// Record an error raised by a callback, retaining only the first one
+func (i *Interpreter) callbackFailed(err error) {
+	if i.cbErr == nil {
+		if evalErr, ok := err.(*starlark.EvalError); ok {
+			err = errors.New(evalErr.Backtrace())
+		}
+		i.cbErr = err
+	}
+}
+
+// Invoke a user-supplied callback from within a Debugger hook
+func (i *Interpreter) callback(fn starlark.Callable, args starlark.Tuple) (starlark.Value, error) {
+	i.inCallback = true
+	defer func() { i.inCallback = false }()
+
+	return starlark.Call(i.thread, fn, args, nil)
+}
+
+/*******************************************************************************
+ * Argument conversion helpers
+ ******************************************************************************/
+
+func toU64(fn *starlark.Builtin, name string, v starlark.Int) (uint64, error) {
+	if u, ok := v.Uint64(); ok {
+		return u, nil
+	}
+
+	// Permit negative values, interpreted as two's complement
+	if s, ok := v.Int64(); ok {
+		return uint64(s), nil
+	}
+
+	return 0, fmt.Errorf("%s: %s is out of range", fn.Name(), name)
+}
+
+func (i *Interpreter) byteOrder() (binary.ByteOrder, error) {
+	e, err := i.dbg.Endianness()
+	if err != nil {
+		return nil, err
+	}
+
+	if e == ae.BigEndian {
+		return binary.BigEndian, nil
+	}
+	return binary.LittleEndian, nil
+}
+
+func exceptionValue(ex ae.Exception) starlark.Value {
+	if ex.Occurred() {
+		return starlark.String(ex.String())
+	}
+	return starlark.None
+}
+
+/*******************************************************************************
+ * Built-ins
+ ******************************************************************************/
+
+func (i *Interpreter) readReg(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var name string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &name); err != nil {
+		return nil, err
+	}
+
+	reg, err := i.dbg.ReadRegByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.MakeUint64(reg.Value), nil
+}
+
+func (i *Interpreter) writeReg(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var name string
+	var value starlark.Int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &name, &value); err != nil {
+		return nil, err
+	}
+
+	v, err := toU64(fn, "value", value)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.None, i.dbg.WriteRegByName(name, v)
+}
+
+func (i *Interpreter) regs(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+
+	regs, err := i.dbg.ReadRegAll()
+	if err != nil {
+		return nil, err
+	}
+
+	dict := starlark.NewDict(len(regs))
+	for _, r := range regs {
+		dict.SetKey(starlark.String(r.Name()), starlark.MakeUint64(r.Value))
+	}
+
+	return dict, nil
+}
+
+func (i *Interpreter) readMem(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var addr, size starlark.Int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &addr, &size); err != nil {
+		return nil, err
+	}
+
+	a, err := toU64(fn, "addr", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := toU64(fn, "size", size)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := i.dbg.ReadMem(a, s)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.Bytes(data), nil
+}
+
+func (i *Interpreter) writeMem(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var addr starlark.Int
+	var data starlark.Bytes
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &addr, &data); err != nil {
+		return nil, err
+	}
+
+	a, err := toU64(fn, "addr", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.None, i.dbg.WriteMem(a, []byte(data))
+}
+
+// Returns a built-in that reads a `size`-byte, target-endian integer
+func (i *Interpreter) readInt(size int) func(*starlark.Thread, *starlark.Builtin,
+	starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+
+	return func(thread *starlark.Thread, fn *starlark.Builtin,
+		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+		var addr starlark.Int
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &addr); err != nil {
+			return nil, err
+		}
+
+		a, err := toU64(fn, "addr", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := i.byteOrder()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := i.dbg.ReadMem(a, uint64(size))
+		if err != nil {
+			return nil, err
+		}
+
+		// Zero-extend to 8 bytes, with respect to endianness
+		buf := make([]byte, 8)
+		if order == binary.BigEndian {
+			copy(buf[8-size:], data)
+		} else {
+			copy(buf, data)
+		}
+
+		return starlark.MakeUint64(order.Uint64(buf)), nil
+	}
+}
+
+// Returns a built-in that writes a `size`-byte, target-endian integer
+func (i *Interpreter) writeInt(size int) func(*starlark.Thread, *starlark.Builtin,
+	starlark.Tuple, []starlark.Tuple) (starlark.Value, error) {
+
+	return func(thread *starlark.Thread, fn *starlark.Builtin,
+		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+		var addr, value starlark.Int
+		if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &addr, &value); err != nil {
+			return nil, err
+		}
+
+		a, err := toU64(fn, "addr", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := toU64(fn, "value", value)
+		if err != nil {
+			return nil, err
+		}
+
+		order, err := i.byteOrder()
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, 8)
+		order.PutUint64(buf, v)
+
+		if order == binary.BigEndian {
+			buf = buf[8-size:]
+		} else {
+			buf = buf[:size]
+		}
+
+		return starlark.None, i.dbg.WriteMem(a, buf)
+	}
+}
+
+func (i *Interpreter) step(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	count := 1
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs, "count?", &count); err != nil {
+		return nil, err
+	} else if i.inCallback {
+		return nil, fmt.Errorf("%s: may not be called from a callback", fn.Name())
+	}
+
+	i.executed = true
+	ex, err := i.dbg.Step(int64(count))
+	if err == nil {
+		err = i.CallbackError()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exceptionValue(ex), nil
+}
+
+func (i *Interpreter) cont(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	} else if i.inCallback {
+		return nil, fmt.Errorf("%s: may not be called from a callback", fn.Name())
+	}
+
+	i.executed = true
+	ex, err := i.dbg.Continue()
+	if err == nil {
+		err = i.CallbackError()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return exceptionValue(ex), nil
+}
+
+func (i *Interpreter) setBreakpoint(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var addr starlark.Int
+	var callback starlark.Value = starlark.None
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"addr", &addr, "callback?", &callback); err != nil {
+		return nil, err
+	}
+
+	if _, ok := callback.(starlark.Callable); !ok && callback != starlark.None {
+		return nil, fmt.Errorf("%s: callback must be callable or None", fn.Name())
+	}
+
+	a, err := toU64(fn, "addr", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	bp := i.dbg.SetBreakpoint(a)
+
+	if fn, ok := callback.(starlark.Callable); ok {
+		err = i.dbg.SetBreakpointCallback(bp.ID, func(d *ae.Debugger, bp ae.Breakpoint) bool {
+			ret, err := i.callback(fn, starlark.Tuple{starlark.MakeInt(bp.ID)})
+			if err != nil {
+				// Halt so the error can be reported
+				i.callbackFailed(err)
+				return true
+			}
+			return bool(ret.Truth())
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return starlark.MakeInt(bp.ID), nil
+}
+
+func (i *Interpreter) deleteBreakpoint(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var id int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &id); err != nil {
+		return nil, err
+	}
+
+	i.dbg.DeleteBreakpoint(id)
+	return starlark.None, nil
+}
+
+func (i *Interpreter) hookMem(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var addr, size starlark.Int
+	var callback starlark.Callable
+	var access string = "rw"
+
+	if err := starlark.UnpackArgs(fn.Name(), args, kwargs,
+		"addr", &addr, "size", &size, "callback", &callback, "access?", &access); err != nil {
+		return nil, err
+	}
+
+	a, err := toU64(fn, "addr", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := toU64(fn, "size", size)
+	if err != nil {
+		return nil, err
+	}
+
+	accessType, err := ae.ParseMemAccessType(access)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := i.dbg.AddMemoryHook(accessType, a, s, func(d *ae.Debugger, access ae.MemAccess) {
+		accessName := "read"
+		if access.Type == ae.MemAccessWrite {
+			accessName = "write"
+		}
+
+		arg := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+			"type":    starlark.String(accessName),
+			"address": starlark.MakeUint64(access.Address),
+			"size":    starlark.MakeInt(access.Size),
+			"value":   starlark.MakeUint64(access.Value),
+		})
+
+		if _, err := i.callback(callback, starlark.Tuple{arg}); err != nil {
+			// Halt so the error can be reported
+			i.callbackFailed(err)
+			d.Interrupt()
+		}
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return starlark.MakeInt(id), nil
+}
+
+func (i *Interpreter) unhookMem(thread *starlark.Thread, fn *starlark.Builtin,
+	args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+
+	var id int
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &id); err != nil {
+		return nil, err
+	}
+
+	return starlark.None, i.dbg.RemoveMemoryHook(id)
+}